@@ -0,0 +1,85 @@
+// Command mock-weather-server runs a fake weather API speaking the
+// OpenWeather, WeatherAPI.com and Open-Meteo (including geocoding) JSON
+// formats, for integration tests and demos without network access. Point the
+// service at it through the base URL overrides:
+//
+//	OPENWEATHER_BASE_URL=http://localhost:9090/openweathermap
+//	WEATHERAPI_BASE_URL=http://localhost:9090/weatherapi
+//	OPENMETEO_BASE_URL=http://localhost:9090/openmeteo
+//	GEOCODER_BASE_URL=http://localhost:9090/geocoding
+//
+// What it serves is scripted by a scenario: a built-in one or a YAML file,
+// see mock-scenario.example.yaml. It can be switched at runtime with
+// PUT /_mock/scenario and reloaded from its file on SIGHUP.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", envOr("MOCK_ADDR", ":9090"), "listen address (MOCK_ADDR)")
+	scenarioArg := flag.String("scenario", envOr("MOCK_SCENARIO", "fixed"), "built-in scenario name or scenario file (MOCK_SCENARIO)")
+	flag.Parse()
+
+	scenario, err := loadScenario(*scenarioArg)
+	if err != nil {
+		log.Fatalf("failed to load scenario: %v", err)
+	}
+
+	srv := newServer(scenario)
+	httpServer := &http.Server{
+		Addr:              *addr,
+		Handler:           srv.routes(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		log.Printf("mock: listening on %s; built-in scenarios: %v", *addr, builtinScenarioNames())
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("mock server stopped: %v", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Reload the scenario on SIGHUP, e.g. after editing its file.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			s, err := loadScenario(*scenarioArg)
+			if err != nil {
+				log.Printf("mock: reload failed; keeping the current scenario: %v", err)
+				continue
+			}
+			srv.setScenario(s)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Received termination signal, shutting down.")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("error during shutdown: %v", err)
+	}
+}
+
+// envOr returns the environment variable key, or def if it is unset.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
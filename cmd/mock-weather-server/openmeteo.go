@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// openMeteoCodes maps conditions to WMO weather codes.
+var openMeteoCodes = map[weather.Condition]int{
+	weather.ConditionClear:  0,
+	weather.ConditionCloudy: 3,
+	weather.ConditionRain:   63,
+	weather.ConditionSnow:   73,
+	weather.ConditionStorm:  95,
+	weather.ConditionMist:   45,
+}
+
+// openMeteoHourly are the supported hourly variables and their units.
+var openMeteoHourly = map[string]struct {
+	unit  string
+	value func(reading) any
+}{
+	"temperature_2m":       {"°C", func(r reading) any { return r.TemperatureC }},
+	"relative_humidity_2m": {"%", func(r reading) any { return r.HumidityPct }},
+	"pressure_msl":         {"hPa", func(r reading) any { return r.PressureHpa }},
+	"precipitation":        {"mm", func(r reading) any { return r.PrecipMm }},
+	"windspeed_10m":        {"m/s", func(r reading) any { return r.WindSpeedMS }},
+	"weathercode":          {"wmo code", func(r reading) any { return openMeteoCodes[r.Condition] }},
+}
+
+// openMeteoDaily are the supported daily variables and their units.
+var openMeteoDaily = map[string]struct {
+	unit  string
+	value func(day) any
+}{
+	"temperature_2m_max":            {"°C", func(d day) any { return d.TempMaxC }},
+	"temperature_2m_min":            {"°C", func(d day) any { return d.TempMinC }},
+	"temperature_2m_mean":           {"°C", func(d day) any { return d.TempAvgC }},
+	"precipitation_sum":             {"mm", func(d day) any { return d.TotalPrecipMm }},
+	"precipitation_probability_max": {"%", func(d day) any { return d.PrecipProbability }},
+	"windspeed_10m_max":             {"m/s", func(d day) any { return d.MaxWindSpeedMS }},
+	"weathercode":                   {"wmo code", func(d day) any { return openMeteoCodes[d.Condition] }},
+}
+
+func openMeteoError(_ int, message string) any {
+	return map[string]any{"error": true, "reason": message}
+}
+
+func openMeteoBadRequest(w http.ResponseWriter, format string, args ...any) {
+	writeJSON(w, http.StatusBadRequest, openMeteoError(http.StatusBadRequest, fmt.Sprintf(format, args...)))
+}
+
+// openMeteoForecast serves current_weather and the requested hourly and
+// daily variables for past_days (0-92) and forecast_days (0-16, default 7),
+// always in UTC and m/s.
+func (s *server) openMeteoForecast(w http.ResponseWriter, r *http.Request, gen *generator) {
+	q := r.URL.Query()
+
+	lat, lon, err := parseLatLon(q.Get("latitude"), q.Get("longitude"))
+	if err != nil {
+		openMeteoBadRequest(w, "Parameters latitude and longitude are required and must be valid coordinates")
+		return
+	}
+	forecastDays, err := queryInt(q.Get("forecast_days"), 7, 0, 16)
+	if err != nil {
+		openMeteoBadRequest(w, "Forecast days is invalid. Allowed range 0 to 16.")
+		return
+	}
+	pastDays, err := queryInt(q.Get("past_days"), 0, 0, 92)
+	if err != nil {
+		openMeteoBadRequest(w, "Past days is invalid. Allowed range 0 to 92.")
+		return
+	}
+	hourlyVars, dailyVars := splitList(q.Get("hourly")), splitList(q.Get("daily"))
+	for _, v := range hourlyVars {
+		if _, ok := openMeteoHourly[v]; !ok {
+			openMeteoBadRequest(w, "Cannot initialize SurfaceVariableWithoutTime from invalid String value %s for key hourly", v)
+			return
+		}
+	}
+	for _, v := range dailyVars {
+		if _, ok := openMeteoDaily[v]; !ok {
+			openMeteoBadRequest(w, "Cannot initialize DailyVariable from invalid String value %s for key daily", v)
+			return
+		}
+	}
+
+	key := fmt.Sprintf("%.4f,%.4f", lat, lon)
+	now := s.now().UTC()
+	body := map[string]any{
+		"latitude":              lat,
+		"longitude":             lon,
+		"generationtime_ms":     0.1,
+		"utc_offset_seconds":    0,
+		"timezone":              "UTC",
+		"timezone_abbreviation": "UTC",
+		"elevation":             200.0,
+	}
+
+	if q.Get("current_weather") == "true" {
+		cur := gen.current(key)
+		body["current_weather"] = map[string]any{
+			"time":          now.Truncate(15 * time.Minute).Format("2006-01-02T15:04"),
+			"interval":      900,
+			"temperature":   cur.TemperatureC,
+			"windspeed":     cur.WindSpeedMS,
+			"winddirection": 240,
+			"weathercode":   openMeteoCodes[cur.Condition],
+		}
+	}
+
+	if len(hourlyVars) == 0 && len(dailyVars) == 0 {
+		writeJSON(w, http.StatusOK, body)
+		return
+	}
+
+	start := now.Truncate(24*time.Hour).AddDate(0, 0, -pastDays)
+	days := pastDays + forecastDays
+	hours := gen.series(key, start, days*24)
+
+	if len(hourlyVars) > 0 {
+		hourly := map[string]any{}
+		units := map[string]string{"time": "iso8601"}
+		times := make([]string, len(hours))
+		for i := range hours {
+			times[i] = start.Add(time.Duration(i) * time.Hour).Format("2006-01-02T15:04")
+		}
+		hourly["time"] = times
+		for _, v := range hourlyVars {
+			variable := openMeteoHourly[v]
+			values := make([]any, len(hours))
+			for i, h := range hours {
+				values[i] = variable.value(h)
+			}
+			hourly[v], units[v] = values, variable.unit
+		}
+		body["hourly"], body["hourly_units"] = hourly, units
+	}
+
+	if len(dailyVars) > 0 {
+		summaries := make([]day, days)
+		dates := make([]string, days)
+		for d := range summaries {
+			summaries[d] = summarize(hours[d*24 : (d+1)*24])
+			dates[d] = start.AddDate(0, 0, d).Format("2006-01-02")
+		}
+		daily := map[string]any{"time": dates}
+		units := map[string]string{"time": "iso8601"}
+		for _, v := range dailyVars {
+			variable := openMeteoDaily[v]
+			values := make([]any, days)
+			for d, sum := range summaries {
+				values[d] = variable.value(sum)
+			}
+			daily[v], units[v] = values, variable.unit
+		}
+		body["daily"], body["daily_units"] = daily, units
+	}
+
+	writeJSON(w, http.StatusOK, body)
+}
+
+// geocodingSearch serves Open-Meteo's geocoding API from the scenario's
+// places. Like the real API it omits results when nothing matches.
+func (s *server) geocodingSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := strings.TrimSpace(q.Get("name"))
+	if name == "" {
+		openMeteoBadRequest(w, "Parameter name is required")
+		return
+	}
+	count, err := queryInt(q.Get("count"), 10, 1, 100)
+	if err != nil {
+		openMeteoBadRequest(w, "Parameter count must be between 1 and 100")
+		return
+	}
+
+	var results []map[string]any
+	for i, p := range s.places() {
+		if len(results) == count {
+			break
+		}
+		if strings.EqualFold(p.Name, name) {
+			results = append(results, map[string]any{
+				"id":           i + 1,
+				"name":         p.Name,
+				"latitude":     p.Latitude,
+				"longitude":    p.Longitude,
+				"country_code": p.CountryCode,
+				"country":      p.Country,
+			})
+		}
+	}
+
+	body := map[string]any{"generationtime_ms": 0.1}
+	if len(results) > 0 {
+		body["results"] = results
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// queryInt parses an optional integer query parameter within [lo, hi].
+func queryInt(v string, def, lo, hi int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	if n < lo || n > hi {
+		return 0, fmt.Errorf("%d out of range", n)
+	}
+	return n, nil
+}
+
+// splitList splits a comma-separated query parameter.
+func splitList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// openWeatherConditions maps conditions to OpenWeather's weather id, main
+// group and description.
+var openWeatherConditions = map[weather.Condition]struct {
+	id          int
+	main, descr string
+}{
+	weather.ConditionClear:  {800, "Clear", "clear sky"},
+	weather.ConditionCloudy: {803, "Clouds", "broken clouds"},
+	weather.ConditionRain:   {501, "Rain", "moderate rain"},
+	weather.ConditionSnow:   {601, "Snow", "snow"},
+	weather.ConditionStorm:  {211, "Thunderstorm", "thunderstorm"},
+	weather.ConditionMist:   {701, "Mist", "mist"},
+}
+
+func openWeatherError(status int, message string) any {
+	return map[string]any{"cod": status, "message": message}
+}
+
+// openWeatherPlace resolves the lat/lon or q query parameters. It writes an
+// error response and returns false if the request has no API key or location.
+func (s *server) openWeatherPlace(w http.ResponseWriter, r *http.Request) (Place, string, bool) {
+	q := r.URL.Query()
+	if q.Get("appid") == "" {
+		writeJSON(w, http.StatusUnauthorized, openWeatherError(http.StatusUnauthorized, "Invalid API key. Please see https://openweathermap.org/faq#error401 for more info."))
+		return Place{}, "", false
+	}
+
+	if lat, lon, err := parseLatLon(q.Get("lat"), q.Get("lon")); err == nil {
+		return Place{Name: "Mock Place", Latitude: lat, Longitude: lon}, fmt.Sprintf("%.4f,%.4f", lat, lon), true
+	}
+	if name := q.Get("q"); name != "" {
+		city, country, _ := strings.Cut(name, ",")
+		place, ok := lookupPlace(s.places(), city, country)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, openWeatherError(http.StatusNotFound, "city not found"))
+			return Place{}, "", false
+		}
+		return place, strings.ToLower(name), true
+	}
+
+	writeJSON(w, http.StatusBadRequest, map[string]any{"cod": "400", "message": "Nothing to geocode"})
+	return Place{}, "", false
+}
+
+func (s *server) openWeatherCurrent(w http.ResponseWriter, r *http.Request, gen *generator) {
+	place, key, ok := s.openWeatherPlace(w, r)
+	if !ok {
+		return
+	}
+
+	cur := gen.current(key)
+	body := map[string]any{
+		"coord":   map[string]any{"lon": place.Longitude, "lat": place.Latitude},
+		"weather": openWeatherWeather(cur.Condition),
+		"base":    "stations",
+		"main": map[string]any{
+			"temp":       cur.TemperatureC,
+			"feels_like": round1(cur.TemperatureC - cur.WindSpeedMS/2),
+			"pressure":   cur.PressureHpa,
+			"humidity":   cur.HumidityPct,
+		},
+		"wind": map[string]any{"speed": cur.WindSpeedMS, "deg": 240},
+		"dt":   s.now().Unix(),
+		"sys":  map[string]any{"country": place.CountryCode},
+		"name": place.Name,
+		"cod":  200,
+	}
+	addOpenWeatherPrecip(body, cur.Condition, "1h", cur.PrecipMm)
+	writeJSON(w, http.StatusOK, body)
+}
+
+// openWeatherForecast serves the 5-day forecast in 40 3-hour slots.
+func (s *server) openWeatherForecast(w http.ResponseWriter, r *http.Request, gen *generator) {
+	place, key, ok := s.openWeatherPlace(w, r)
+	if !ok {
+		return
+	}
+
+	const slots = 40
+	start := s.now().UTC().Truncate(3 * time.Hour).Add(3 * time.Hour)
+	hours := gen.series(key, start, slots*3)
+
+	list := make([]map[string]any, 0, slots)
+	for i := 0; i < slots; i++ {
+		slot := hours[i*3 : i*3+3]
+		h := slot[0]
+		var precip float64
+		var wet int
+		for _, sh := range slot {
+			precip += sh.PrecipMm
+			if sh.PrecipMm > 0 {
+				wet++
+			}
+		}
+
+		ts := start.Add(time.Duration(i*3) * time.Hour)
+		item := map[string]any{
+			"dt": ts.Unix(),
+			"main": map[string]any{
+				"temp":     h.TemperatureC,
+				"pressure": h.PressureHpa,
+				"humidity": h.HumidityPct,
+			},
+			"weather": openWeatherWeather(h.Condition),
+			"wind":    map[string]any{"speed": h.WindSpeedMS, "deg": 240},
+			"pop":     round1(float64(wet) / 3),
+			"dt_txt":  ts.Format("2006-01-02 15:04:05"),
+		}
+		addOpenWeatherPrecip(item, h.Condition, "3h", round1(precip))
+		list = append(list, item)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"cod":     "200",
+		"message": 0,
+		"cnt":     slots,
+		"list":    list,
+		"city": map[string]any{
+			"name":    place.Name,
+			"coord":   map[string]any{"lat": place.Latitude, "lon": place.Longitude},
+			"country": place.CountryCode,
+		},
+	})
+}
+
+func openWeatherWeather(c weather.Condition) []map[string]any {
+	ow := openWeatherConditions[c]
+	return []map[string]any{{"id": ow.id, "main": ow.main, "description": ow.descr}}
+}
+
+// addOpenWeatherPrecip adds the rain or snow block, which OpenWeather omits
+// when it is dry.
+func addOpenWeatherPrecip(body map[string]any, c weather.Condition, period string, mm float64) {
+	if mm <= 0 {
+		return
+	}
+	block := "rain"
+	if c == weather.ConditionSnow {
+		block = "snow"
+	}
+	body[block] = map[string]any{period: mm}
+}
+
+// parseLatLon parses a latitude and longitude pair.
+func parseLatLon(lat, lon string) (float64, float64, error) {
+	la, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	lo, err := strconv.ParseFloat(lon, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if la < -90 || la > 90 || lo < -180 || lo > 180 {
+		return 0, 0, fmt.Errorf("coordinates out of range")
+	}
+	return la, lo, nil
+}
+
+// lookupPlace finds a city by name and, if given, country code or name.
+func lookupPlace(places []Place, city, country string) (Place, bool) {
+	city, country = strings.TrimSpace(city), strings.TrimSpace(country)
+	for _, p := range places {
+		if strings.EqualFold(p.Name, city) &&
+			(country == "" || strings.EqualFold(p.CountryCode, country) || strings.EqualFold(p.Country, country)) {
+			return p, true
+		}
+	}
+	return Place{}, false
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+	"github.com/i474232898/weather-data-aggregation/internal/weather/providers"
+)
+
+// Value generation modes.
+const (
+	modeFixed      = "fixed"
+	modeRandomWalk = "random_walk"
+)
+
+// Scenario scripts the mock: the weather values it serves and the faults it
+// injects over time, for all providers or per provider.
+type Scenario struct {
+	Name     string `yaml:"name"`
+	Behavior `yaml:",inline"`
+	// Providers overrides values or phases for one provider (openweathermap,
+	// weatherapi or openmeteo). Settings it leaves out are inherited.
+	Providers map[string]Behavior `yaml:"-"`
+	// Places are the cities the geocoding API knows, in addition to
+	// defaultPlaces.
+	Places []Place `yaml:"places"`
+}
+
+// Behavior is what a provider serves: its values and its fault phases.
+type Behavior struct {
+	Values Values `yaml:"values"`
+	// Phases run one after another and repeat from the first once the last
+	// one ends. A phase without a duration lasts forever and must be last.
+	// Without phases, requests are always answered normally.
+	Phases []Phase `yaml:"phases"`
+}
+
+// Values are the weather values served. In random_walk mode they are the
+// starting point, and every request for the current weather of a location
+// moves its values by a random step, pulled back towards these values.
+type Values struct {
+	Mode         string  `yaml:"mode"`
+	TemperatureC float64 `yaml:"temperature_c"`
+	HumidityPct  float64 `yaml:"humidity_pct"`
+	WindSpeedMS  float64 `yaml:"wind_speed_ms"`
+	PressureHpa  float64 `yaml:"pressure_hpa"`
+	PrecipMm     float64 `yaml:"precip_mm"`
+	// Condition is clear, cloudy, rain, snow, storm or mist. In random_walk
+	// mode it only applies while there is no precipitation.
+	Condition weather.Condition `yaml:"condition"`
+	// Step is the standard deviation of a random walk step in °C; the other
+	// values move proportionally.
+	Step float64 `yaml:"step"`
+	Seed uint64  `yaml:"seed"`
+}
+
+// Phase is a period of injected faults.
+type Phase struct {
+	Name          string        `yaml:"name"`
+	Duration      time.Duration `yaml:"duration"`
+	Latency       time.Duration `yaml:"latency"`
+	LatencyJitter time.Duration `yaml:"latency_jitter"`
+	// ErrorRate is the probability, 0-1, that a request fails with Status.
+	ErrorRate float64 `yaml:"error_rate"`
+	// Status is the HTTP status of failed requests; 500 if unset.
+	Status int `yaml:"status"`
+	// RetryAfter is sent with failed 429 and 503 responses if set.
+	RetryAfter time.Duration `yaml:"retry_after"`
+	// MalformedRate is the probability, 0-1, that a successful request gets
+	// a truncated JSON body.
+	MalformedRate float64 `yaml:"malformed_rate"`
+}
+
+// Place is a city known to the geocoding API.
+type Place struct {
+	Name        string  `yaml:"name"`
+	CountryCode string  `yaml:"country_code"`
+	Country     string  `yaml:"country"`
+	Latitude    float64 `yaml:"latitude"`
+	Longitude   float64 `yaml:"longitude"`
+}
+
+// defaultPlaces are known to the geocoding API in every scenario.
+var defaultPlaces = []Place{
+	{"Kyiv", "UA", "Ukraine", 50.4501, 30.5234},
+	{"Bangkok", "TH", "Thailand", 13.7563, 100.5018},
+	{"London", "GB", "United Kingdom", 51.5074, -0.1278},
+	{"Paris", "FR", "France", 48.8566, 2.3522},
+	{"Berlin", "DE", "Germany", 52.52, 13.405},
+	{"Prague", "CZ", "Czechia", 50.0755, 14.4378},
+	{"New York", "US", "United States", 40.7128, -74.006},
+	{"Tokyo", "JP", "Japan", 35.6762, 139.6503},
+}
+
+// builtinScenarios are the scenarios that can be selected by name.
+var builtinScenarios = map[string]string{
+	"fixed": `
+values:
+  mode: fixed
+`,
+	"random-walk": `
+values:
+  mode: random_walk
+  step: 0.4
+`,
+	"slow": `
+phases:
+  - name: slow
+    latency: 1500ms
+    latency_jitter: 1s
+`,
+	"flaky": `
+values:
+  mode: random_walk
+phases:
+  - name: flaky
+    latency: 100ms
+    latency_jitter: 400ms
+    error_rate: 0.2
+    status: 503
+    malformed_rate: 0.05
+`,
+	"rate-limit": `
+phases:
+  - name: normal
+    duration: 40s
+  - name: 429 burst
+    duration: 20s
+    error_rate: 1
+    status: 429
+    retry_after: 10s
+`,
+	"outage": `
+phases:
+  - name: normal
+    duration: 1m
+  - name: 5xx storm
+    duration: 30s
+    error_rate: 0.9
+    status: 503
+`,
+	"malformed": `
+phases:
+  - name: malformed
+    malformed_rate: 0.5
+`,
+	"mixed": `
+values:
+  mode: random_walk
+providers:
+  openweathermap:
+    values:
+      temperature_c: 18
+  weatherapi:
+    phases:
+      - name: normal
+        duration: 30s
+      - name: 429 burst
+        duration: 15s
+        error_rate: 1
+        status: 429
+        retry_after: 5s
+  openmeteo:
+    phases:
+      - name: slow
+        latency: 2s
+        latency_jitter: 1s
+`,
+}
+
+// defaultScenario returns the settings a scenario file starts from.
+func defaultScenario() Scenario {
+	return Scenario{Behavior: Behavior{Values: Values{
+		Mode:         modeFixed,
+		TemperatureC: 15,
+		HumidityPct:  60,
+		WindSpeedMS:  3,
+		PressureHpa:  1013,
+		Condition:    weather.ConditionClear,
+		Step:         0.5,
+		Seed:         1,
+	}}}
+}
+
+// loadScenario returns the built-in scenario called nameOrPath, or else
+// reads the scenario file at that path.
+func loadScenario(nameOrPath string) (*Scenario, error) {
+	if src, ok := builtinScenarios[nameOrPath]; ok {
+		s, err := parseScenario(strings.NewReader(src))
+		if err != nil {
+			return nil, fmt.Errorf("built-in scenario %s: %w", nameOrPath, err)
+		}
+		s.Name = nameOrPath
+		return s, nil
+	}
+
+	data, err := os.ReadFile(nameOrPath)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a built-in scenario (%s) nor a readable file: %w",
+			nameOrPath, strings.Join(builtinScenarioNames(), ", "), err)
+	}
+	s, err := parseScenario(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("scenario %s: %w", nameOrPath, err)
+	}
+	if s.Name == "" {
+		s.Name = nameOrPath
+	}
+	return s, nil
+}
+
+func builtinScenarioNames() []string {
+	names := make([]string, 0, len(builtinScenarios))
+	for name := range builtinScenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseScenario decodes a YAML scenario over defaultScenario and validates
+// it. Unknown fields are errors. Provider blocks are decoded over the shared
+// settings, so they only need the settings that differ.
+func parseScenario(r io.Reader) (*Scenario, error) {
+	var doc struct {
+		Scenario  `yaml:",inline"`
+		Providers map[string]yaml.Node `yaml:"providers"`
+	}
+	doc.Scenario = defaultScenario()
+
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	s := doc.Scenario
+	for name, node := range doc.Providers {
+		if !providers.DefaultRegistry().Has(name) {
+			return nil, fmt.Errorf("providers.%s: unknown provider", name)
+		}
+		b := s.Behavior
+		b.Phases = append([]Phase(nil), b.Phases...)
+		if err := decodeStrict(&node, &b); err != nil {
+			return nil, fmt.Errorf("providers.%s: %w", name, err)
+		}
+		if s.Providers == nil {
+			s.Providers = make(map[string]Behavior)
+		}
+		s.Providers[name] = b
+	}
+
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// decodeStrict decodes node into v, rejecting unknown fields, which
+// yaml.Node.Decode does not.
+func decodeStrict(node *yaml.Node, v any) error {
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	return dec.Decode(v)
+}
+
+// validate reports every invalid setting.
+func (s *Scenario) validate() error {
+	var errs []error
+	s.Behavior.validate("", &errs)
+	for name, b := range s.Providers {
+		b.validate("providers."+name+".", &errs)
+	}
+	for i, p := range s.Places {
+		if p.Name == "" || p.Latitude < -90 || p.Latitude > 90 || p.Longitude < -180 || p.Longitude > 180 {
+			errs = append(errs, fmt.Errorf("places[%d]: a name and valid coordinates are required", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b Behavior) validate(prefix string, errs *[]error) {
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			*errs = append(*errs, fmt.Errorf(prefix+format, args...))
+		}
+	}
+
+	v := b.Values
+	check(v.Mode == modeFixed || v.Mode == modeRandomWalk, "values.mode: must be %s or %s, got %q", modeFixed, modeRandomWalk, v.Mode)
+	check(validCondition(v.Condition), "values.condition: unknown condition %q", v.Condition)
+	check(v.HumidityPct >= 0 && v.HumidityPct <= 100, "values.humidity_pct: must be 0-100")
+	check(v.WindSpeedMS >= 0, "values.wind_speed_ms: must not be negative")
+	check(v.PressureHpa > 0, "values.pressure_hpa: must be positive")
+	check(v.PrecipMm >= 0, "values.precip_mm: must not be negative")
+	check(v.Step >= 0, "values.step: must not be negative")
+
+	for i, p := range b.Phases {
+		check(p.Duration > 0 || i == len(b.Phases)-1, "phases[%d].duration: only the last phase may last forever", i)
+		check(p.Duration >= 0 && p.Latency >= 0 && p.LatencyJitter >= 0 && p.RetryAfter >= 0, "phases[%d]: durations must not be negative", i)
+		check(p.ErrorRate >= 0 && p.ErrorRate <= 1, "phases[%d].error_rate: must be 0-1", i)
+		check(p.MalformedRate >= 0 && p.MalformedRate <= 1, "phases[%d].malformed_rate: must be 0-1", i)
+		check(p.Status == 0 || (p.Status >= 400 && p.Status <= 599), "phases[%d].status: must be an HTTP error status", i)
+	}
+}
+
+func validCondition(c weather.Condition) bool {
+	switch c {
+	case weather.ConditionClear, weather.ConditionCloudy, weather.ConditionRain,
+		weather.ConditionSnow, weather.ConditionStorm, weather.ConditionMist:
+		return true
+	}
+	return false
+}
+
+// behavior returns the behavior of the provider called name.
+func (s *Scenario) behavior(name string) Behavior {
+	if b, ok := s.Providers[name]; ok {
+		return b
+	}
+	return s.Behavior
+}
+
+// phaseAt returns the phase active elapsed after the scenario started, and
+// false if there are no phases.
+func (b Behavior) phaseAt(elapsed time.Duration) (Phase, bool) {
+	if len(b.Phases) == 0 {
+		return Phase{}, false
+	}
+
+	last := b.Phases[len(b.Phases)-1]
+	if last.Duration > 0 {
+		var cycle time.Duration
+		for _, p := range b.Phases {
+			cycle += p.Duration
+		}
+		elapsed %= cycle
+	}
+	for _, p := range b.Phases {
+		if p.Duration == 0 || elapsed < p.Duration {
+			return p, true
+		}
+		elapsed -= p.Duration
+	}
+	return last, true
+}
+
+// latency returns the delay to inject into a request.
+func (p Phase) latency() time.Duration {
+	d := p.Latency
+	if p.LatencyJitter > 0 {
+		d += rand.N(p.LatencyJitter)
+	}
+	return d
+}
+
+// fails reports whether a request should fail, and with which status.
+func (p Phase) fails() (int, bool) {
+	if p.ErrorRate <= 0 || rand.Float64() >= p.ErrorRate {
+		return 0, false
+	}
+	if p.Status == 0 {
+		return 500, true
+	}
+	return p.Status, true
+}
+
+// malformed reports whether a response body should be truncated.
+func (p Phase) malformed() bool {
+	return p.MalformedRate > 0 && rand.Float64() < p.MalformedRate
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather/providers"
+)
+
+// server serves the provider APIs under one path prefix each, plus the
+// geocoding API and the scenario control endpoint.
+type server struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	scenario *Scenario
+	started  time.Time
+	gens     map[string]*generator
+	phases   map[string]string // active phase per provider, for logging
+}
+
+func newServer(s *Scenario) *server {
+	srv := &server{now: time.Now}
+	srv.setScenario(s)
+	return srv
+}
+
+// setScenario replaces the scenario, restarting its phases and walks.
+func (s *server) setScenario(sc *Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scenario = sc
+	s.started = s.now()
+	s.gens = make(map[string]*generator)
+	s.phases = make(map[string]string)
+	for _, name := range providers.DefaultRegistry().Names() {
+		s.gens[name] = newGenerator(sc.behavior(name).Values)
+	}
+	log.Printf("mock: scenario %s", sc.Name)
+}
+
+// state returns the active phase and the generator of the provider called
+// name.
+func (s *server) state(name string) (Phase, bool, *generator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	phase, ok := s.scenario.behavior(name).phaseAt(s.now().Sub(s.started))
+	if ok && s.phases[name] != phase.Name {
+		s.phases[name] = phase.Name
+		log.Printf("mock: %s: phase %q", name, phase.Name)
+	}
+	return phase, ok, s.gens[name]
+}
+
+// places returns the cities known to the geocoding API.
+func (s *server) places() []Place {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append(append([]Place(nil), s.scenario.Places...), defaultPlaces...)
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	ow := s.provider(providers.OpenWeatherName, openWeatherError)
+	mux.Handle("GET /openweathermap/weather", ow(s.openWeatherCurrent))
+	mux.Handle("GET /openweathermap/forecast", ow(s.openWeatherForecast))
+
+	wa := s.provider(providers.WeatherAPIName, weatherAPIError)
+	mux.Handle("GET /weatherapi/current.json", wa(s.weatherAPICurrent))
+	mux.Handle("GET /weatherapi/forecast.json", wa(s.weatherAPIForecast))
+	mux.Handle("GET /weatherapi/history.json", wa(s.weatherAPIHistory))
+
+	mux.Handle("GET /openmeteo/forecast", s.provider(providers.OpenMeteoName, openMeteoError)(s.openMeteoForecast))
+	mux.HandleFunc("GET /geocoding/search", s.geocodingSearch)
+
+	mux.HandleFunc("GET /_mock/scenario", s.getScenario)
+	mux.HandleFunc("PUT /_mock/scenario", s.putScenario)
+	return mux
+}
+
+// apiHandler serves one provider API request with the provider's generator.
+type apiHandler func(w http.ResponseWriter, r *http.Request, gen *generator)
+
+// errorBody builds a provider's error response body.
+type errorBody func(status int, message string) any
+
+// provider returns a middleware injecting the active phase's latency, errors
+// and malformed bodies into the requests of the provider called name.
+func (s *server) provider(name string, errBody errorBody) func(apiHandler) http.Handler {
+	return func(h apiHandler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			phase, ok, gen := s.state(name)
+			if !ok {
+				h(w, r, gen)
+				return
+			}
+
+			if d := phase.latency(); d > 0 {
+				select {
+				case <-time.After(d):
+				case <-r.Context().Done():
+					return
+				}
+			}
+
+			if status, fail := phase.fails(); fail {
+				if phase.RetryAfter > 0 && (status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable) {
+					w.Header().Set("Retry-After", strconv.Itoa(int(phase.RetryAfter.Seconds())))
+				}
+				writeJSON(w, status, errBody(status, http.StatusText(status)))
+				return
+			}
+
+			if phase.malformed() {
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				io.WriteString(w, `{"coord": {"lon": 14.43, "lat": 50.07`)
+				return
+			}
+
+			h(w, r, gen)
+		})
+	}
+}
+
+// getScenario reports the scenario and the active phase per provider.
+func (s *server) getScenario(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	sc, elapsed := s.scenario, s.now().Sub(s.started)
+	s.mu.Unlock()
+
+	phases := make(map[string]string)
+	for _, name := range providers.DefaultRegistry().Names() {
+		if p, ok := sc.behavior(name).phaseAt(elapsed); ok {
+			phases[name] = p.Name
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"scenario": sc.Name,
+		"elapsed":  elapsed.Round(time.Second).String(),
+		"phases":   phases,
+	})
+}
+
+// putScenario switches to the built-in scenario named by the name query
+// parameter, or else to the YAML scenario in the request body.
+func (s *server) putScenario(w http.ResponseWriter, r *http.Request) {
+	var (
+		sc  *Scenario
+		err error
+	)
+	if name := r.URL.Query().Get("name"); name != "" {
+		if _, ok := builtinScenarios[name]; !ok {
+			http.Error(w, "unknown built-in scenario "+name+"; one of "+strings.Join(builtinScenarioNames(), ", "), http.StatusNotFound)
+			return
+		}
+		sc, err = loadScenario(name)
+	} else {
+		sc, err = parseScenario(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err == nil && sc.Name == "" {
+			sc.Name = "custom"
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.setScenario(sc)
+	s.getScenario(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+	"github.com/i474232898/weather-data-aggregation/internal/weather/providers"
+)
+
+// startMock serves the scenario given as YAML and returns the providers,
+// pointed at it through their base URLs, without retries.
+func startMock(t *testing.T, scenario string) (*httptest.Server, []weather.Provider) {
+	t.Helper()
+
+	sc, err := parseScenario(strings.NewReader(scenario))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sc.Name = t.Name()
+	srv := httptest.NewServer(newServer(sc).routes())
+	t.Cleanup(srv.Close)
+
+	noRetries := providers.BackoffConfig{MaxRetries: 0, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond}
+	geocoder := providers.NewOpenMeteoGeocoder(http.DefaultClient, providers.WithBaseURL(srv.URL+"/geocoding"))
+	set := providers.NewSet(providers.DefaultRegistry(), providers.Deps{Geocoder: geocoder})
+	provs, err := set.Build(map[string]providers.Config{
+		providers.OpenWeatherName: {APIKey: "mock", BaseURL: srv.URL + "/openweathermap", Backoff: noRetries},
+		providers.WeatherAPIName:  {APIKey: "mock", BaseURL: srv.URL + "/weatherapi", Backoff: noRetries},
+		providers.OpenMeteoName:   {BaseURL: srv.URL + "/openmeteo", Backoff: noRetries},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(provs) != 3 {
+		t.Fatalf("expected 3 providers, got %d", len(provs))
+	}
+	return srv, provs
+}
+
+// TestProvidersReadMockResponses verifies that the real providers parse every
+// endpoint the mock serves, for a city geocoded by the mock.
+func TestProvidersReadMockResponses(t *testing.T) {
+	_, provs := startMock(t, `
+values:
+  temperature_c: 21.5
+  condition: cloudy
+`)
+	ctx := context.Background()
+	loc := weather.Location{City: "Kyiv", Country: "UA"}
+	now := time.Now().UTC()
+
+	for _, p := range provs {
+		cur, err := p.Fetch(ctx, loc)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", p.Name(), err)
+		}
+		if cur.TemperatureC == nil || *cur.TemperatureC != 21.5 || cur.Condition != weather.ConditionCloudy {
+			t.Fatalf("%s: unexpected reading: %+v", p.Name(), cur)
+		}
+
+		days, err := p.(weather.ForecastProvider).FetchForecast(ctx, loc, 3)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", p.Name(), err)
+		}
+		if len(days) == 0 || len(days) > 3 || days[0].TempMaxC == nil || *days[0].TempMaxC != 21.5 {
+			t.Fatalf("%s: unexpected forecast: %+v", p.Name(), days)
+		}
+
+		hours, err := p.(weather.HourlyForecastProvider).FetchHourlyForecast(ctx, loc, 12)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", p.Name(), err)
+		}
+		if len(hours) == 0 {
+			t.Fatalf("%s: expected hourly readings", p.Name())
+		}
+
+		if hp, ok := p.(weather.HistoryProvider); ok {
+			past, err := hp.FetchHistory(ctx, loc, now.Add(-6*time.Hour), now)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", p.Name(), err)
+			}
+			if len(past) < 5 {
+				t.Fatalf("%s: expected the last 6 hours, got %d readings", p.Name(), len(past))
+			}
+		}
+	}
+}
+
+// TestScenarioFaults verifies that failure phases surface as provider errors
+// with the scripted status and that malformed bodies fail to decode.
+func TestScenarioFaults(t *testing.T) {
+	_, provs := startMock(t, `
+phases:
+  - name: 429 burst
+    error_rate: 1
+    status: 429
+    retry_after: 1s
+providers:
+  openmeteo:
+    phases:
+      - name: malformed
+        malformed_rate: 1
+`)
+	loc := weather.Location{Lat: weather.Float64(50.45), Lon: weather.Float64(30.52)}
+
+	for _, p := range provs {
+		_, err := p.Fetch(context.Background(), loc)
+		if err == nil {
+			t.Fatalf("%s: expected an error", p.Name())
+		}
+
+		var perr *weather.ProviderError
+		if p.Name() == providers.OpenMeteoName {
+			if errors.As(err, &perr) && perr.StatusCode != 0 {
+				t.Fatalf("%s: expected a decoding error, got %v", p.Name(), err)
+			}
+			continue
+		}
+		if !errors.As(err, &perr) || perr.StatusCode != http.StatusTooManyRequests || !perr.Retryable {
+			t.Fatalf("%s: expected a retryable 429, got %v", p.Name(), err)
+		}
+	}
+}
+
+// TestScenarioPhases verifies phase selection over a looping timeline,
+// provider overrides inheriting the shared settings, and validation.
+func TestScenarioPhases(t *testing.T) {
+	sc, err := parseScenario(strings.NewReader(`
+values:
+  mode: random_walk
+  temperature_c: 5
+phases:
+  - name: normal
+    duration: 30s
+  - name: storm
+    duration: 10s
+    error_rate: 0.5
+providers:
+  weatherapi:
+    values:
+      temperature_c: 30
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		elapsed time.Duration
+		want    string
+	}{
+		{0, "normal"},
+		{35 * time.Second, "storm"},
+		{45 * time.Second, "normal"},
+		{79 * time.Second, "storm"},
+	} {
+		if p, _ := sc.behavior(providers.OpenWeatherName).phaseAt(tc.elapsed); p.Name != tc.want {
+			t.Fatalf("phase at %v: expected %s, got %s", tc.elapsed, tc.want, p.Name)
+		}
+	}
+
+	wa := sc.behavior(providers.WeatherAPIName)
+	if wa.Values.TemperatureC != 30 || wa.Values.Mode != modeRandomWalk || len(wa.Phases) != 2 {
+		t.Fatalf("expected the weatherapi block over the shared settings, got %+v", wa)
+	}
+
+	_, err = parseScenario(strings.NewReader(`
+values:
+  mode: sine
+phases:
+  - name: forever
+  - name: never
+    error_rate: 2
+`))
+	for _, want := range []string{"values.mode", "phases[0].duration", "phases[1].error_rate"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %q, got %v", want, err)
+		}
+	}
+
+	for _, name := range builtinScenarioNames() {
+		if _, err := loadScenario(name); err != nil {
+			t.Errorf("built-in scenario %s: unexpected error: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// reading is one generated observation.
+type reading struct {
+	TemperatureC float64
+	HumidityPct  float64
+	WindSpeedMS  float64
+	PressureHpa  float64
+	PrecipMm     float64 // per hour
+	Condition    weather.Condition
+}
+
+// generator produces the values of one provider. In random_walk mode each
+// location walks on its own.
+type generator struct {
+	values Values
+
+	mu    sync.Mutex
+	walks map[string]*walk
+}
+
+type walk struct {
+	rng   *rand.Rand
+	state reading
+}
+
+func newGenerator(values Values) *generator {
+	return &generator{values: values, walks: make(map[string]*walk)}
+}
+
+// base returns the configured values as a reading.
+func (g *generator) base() reading {
+	v := g.values
+	return reading{
+		TemperatureC: v.TemperatureC,
+		HumidityPct:  v.HumidityPct,
+		WindSpeedMS:  v.WindSpeedMS,
+		PressureHpa:  v.PressureHpa,
+		PrecipMm:     v.PrecipMm,
+		Condition:    v.Condition,
+	}
+}
+
+// current returns the current values for the location identified by key,
+// taking a random walk step first in random_walk mode.
+func (g *generator) current(key string) reading {
+	if g.values.Mode != modeRandomWalk {
+		return g.base()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	w, ok := g.walks[key]
+	if !ok {
+		w = &walk{rng: rand.New(rand.NewPCG(g.values.Seed, hashKey(key))), state: g.base()}
+		g.walks[key] = w
+	}
+	w.state = g.step(w.rng, w.state)
+	return w.state
+}
+
+// series returns n hourly values for the location identified by key, from
+// start. In random_walk mode they walk on from the current values with a
+// random source seeded by the location and start, so repeated requests for
+// the same hours agree.
+func (g *generator) series(key string, start time.Time, n int) []reading {
+	out := make([]reading, n)
+	if g.values.Mode != modeRandomWalk {
+		for i := range out {
+			out[i] = g.base()
+		}
+		return out
+	}
+
+	g.mu.Lock()
+	state := g.base()
+	if w, ok := g.walks[key]; ok {
+		state = w.state
+	}
+	g.mu.Unlock()
+
+	rng := rand.New(rand.NewPCG(g.values.Seed^uint64(start.Unix()), hashKey(key)))
+	for i := range out {
+		state = g.step(rng, state)
+		out[i] = state
+	}
+	return out
+}
+
+// step moves r by a random step, pulled back a tenth of the way towards the
+// configured values so that walks do not drift off.
+func (g *generator) step(rng *rand.Rand, r reading) reading {
+	base, s := g.base(), g.values.Step
+	move := func(v, target, sd, lo, hi float64) float64 {
+		v += (target-v)*0.1 + rng.NormFloat64()*sd
+		return round1(math.Min(hi, math.Max(lo, v)))
+	}
+
+	r.TemperatureC = move(r.TemperatureC, base.TemperatureC, s, -60, 60)
+	r.HumidityPct = move(r.HumidityPct, base.HumidityPct, 3*s, 5, 100)
+	r.WindSpeedMS = move(r.WindSpeedMS, base.WindSpeedMS, 0.5*s, 0, 40)
+	r.PressureHpa = move(r.PressureHpa, base.PressureHpa, s, 950, 1060)
+
+	r.PrecipMm, r.Condition = 0, base.Condition
+	if r.HumidityPct > 85 {
+		r.PrecipMm = round1(math.Abs(rng.NormFloat64()) * (r.HumidityPct - 80) / 10)
+	}
+	switch {
+	case r.PrecipMm > 0 && r.TemperatureC <= 0:
+		r.Condition = weather.ConditionSnow
+	case r.PrecipMm > 0:
+		r.Condition = weather.ConditionRain
+	case base.Condition == weather.ConditionRain || base.Condition == weather.ConditionSnow:
+		r.Condition = weather.ConditionCloudy
+	}
+	return r
+}
+
+// day summarizes the hourly values of a day.
+type day struct {
+	TempMinC, TempMaxC, TempAvgC float64
+	MaxWindSpeedMS               float64
+	TotalPrecipMm                float64
+	PrecipProbability            float64 // percent of hours with precipitation
+	Condition                    weather.Condition
+}
+
+func summarize(hours []reading) day {
+	d := day{TempMinC: math.Inf(1), TempMaxC: math.Inf(-1)}
+	var sum float64
+	var wet int
+	conditions := make([]weather.Condition, 0, len(hours))
+	for _, h := range hours {
+		d.TempMinC = math.Min(d.TempMinC, h.TemperatureC)
+		d.TempMaxC = math.Max(d.TempMaxC, h.TemperatureC)
+		d.MaxWindSpeedMS = math.Max(d.MaxWindSpeedMS, h.WindSpeedMS)
+		d.TotalPrecipMm += h.PrecipMm
+		sum += h.TemperatureC
+		if h.PrecipMm > 0 {
+			wet++
+		}
+		conditions = append(conditions, h.Condition)
+	}
+	d.TempAvgC = round1(sum / float64(len(hours)))
+	d.TotalPrecipMm = round1(d.TotalPrecipMm)
+	d.PrecipProbability = math.Round(100 * float64(wet) / float64(len(hours)))
+	d.Condition = weather.DominantCondition(conditions)
+	return d
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
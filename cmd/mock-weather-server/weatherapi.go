@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// weatherAPIConditions maps conditions to WeatherAPI.com's condition text
+// and code.
+var weatherAPIConditions = map[weather.Condition]struct {
+	text string
+	code int
+}{
+	weather.ConditionClear:  {"Sunny", 1000},
+	weather.ConditionCloudy: {"Partly cloudy", 1003},
+	weather.ConditionRain:   {"Moderate rain", 1189},
+	weather.ConditionSnow:   {"Moderate snow", 1219},
+	weather.ConditionStorm:  {"Thundery outbreaks possible", 1087},
+	weather.ConditionMist:   {"Mist", 1030},
+}
+
+// weatherAPIError builds WeatherAPI.com's error body. Its error codes are
+// its own; 2007 is the exceeded quota.
+func weatherAPIError(status int, message string) any {
+	code := 9999
+	if status == http.StatusTooManyRequests {
+		code = 2007
+	}
+	return map[string]any{"error": map[string]any{"code": code, "message": message}}
+}
+
+// weatherAPIPlace resolves the q query parameter, "lat,lon" or
+// "city,country". It writes an error response and returns false if the
+// request has no API key or location.
+func (s *server) weatherAPIPlace(w http.ResponseWriter, r *http.Request) (Place, string, bool) {
+	q := r.URL.Query()
+	if q.Get("key") == "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"error": map[string]any{"code": 1002, "message": "API key is invalid or not provided."}})
+		return Place{}, "", false
+	}
+
+	name := q.Get("q")
+	if name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{"code": 1003, "message": "Parameter q is missing."}})
+		return Place{}, "", false
+	}
+
+	first, second, _ := strings.Cut(name, ",")
+	if lat, lon, err := parseLatLon(first, second); err == nil {
+		return Place{Name: "Mock Place", Latitude: lat, Longitude: lon}, fmt.Sprintf("%.4f,%.4f", lat, lon), true
+	}
+	place, ok := lookupPlace(s.places(), first, second)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{"code": 1006, "message": "No matching location found."}})
+		return Place{}, "", false
+	}
+	return place, strings.ToLower(name), true
+}
+
+func (s *server) weatherAPILocation(place Place) map[string]any {
+	now := s.now().UTC()
+	return map[string]any{
+		"name":            place.Name,
+		"country":         place.Country,
+		"lat":             place.Latitude,
+		"lon":             place.Longitude,
+		"tz_id":           "UTC",
+		"localtime_epoch": now.Unix(),
+		"localtime":       now.Format("2006-01-02 15:04"),
+	}
+}
+
+func weatherAPICurrentBody(now time.Time, cur reading) map[string]any {
+	return map[string]any{
+		"last_updated_epoch": now.Truncate(15 * time.Minute).Unix(),
+		"temp_c":             cur.TemperatureC,
+		"humidity":           cur.HumidityPct,
+		"wind_kph":           round1(cur.WindSpeedMS * 3.6),
+		"pressure_mb":        cur.PressureHpa,
+		"precip_mm":          cur.PrecipMm,
+		"condition":          weatherAPICondition(cur.Condition),
+	}
+}
+
+func (s *server) weatherAPICurrent(w http.ResponseWriter, r *http.Request, gen *generator) {
+	place, key, ok := s.weatherAPIPlace(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"location": s.weatherAPILocation(place),
+		"current":  weatherAPICurrentBody(s.now(), gen.current(key)),
+	})
+}
+
+// weatherAPIForecast serves days (1-14, default 1) forecast days from today.
+func (s *server) weatherAPIForecast(w http.ResponseWriter, r *http.Request, gen *generator) {
+	place, key, ok := s.weatherAPIPlace(w, r)
+	if !ok {
+		return
+	}
+
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days < 1 {
+		days = 1
+	}
+	if days > 14 {
+		days = 14
+	}
+
+	cur := gen.current(key)
+	today := s.now().UTC().Truncate(24 * time.Hour)
+	hours := gen.series(key, today, days*24)
+
+	forecastDays := make([]map[string]any, 0, days)
+	for d := 0; d < days; d++ {
+		forecastDays = append(forecastDays, weatherAPIDay(today.AddDate(0, 0, d), hours[d*24:(d+1)*24]))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"location": s.weatherAPILocation(place),
+		"current":  weatherAPICurrentBody(s.now(), cur),
+		"forecast": map[string]any{"forecastday": forecastDays},
+	})
+}
+
+// weatherAPIHistory serves the day given by the dt query parameter.
+func (s *server) weatherAPIHistory(w http.ResponseWriter, r *http.Request, gen *generator) {
+	place, key, ok := s.weatherAPIPlace(w, r)
+	if !ok {
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", r.URL.Query().Get("dt"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{"code": 1003, "message": "Parameter dt is missing or invalid."}})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"location": s.weatherAPILocation(place),
+		"forecast": map[string]any{"forecastday": []map[string]any{weatherAPIDay(date, gen.series(key, date, 24))}},
+	})
+}
+
+// weatherAPIDay builds a forecastday entry from the 24 hours of date.
+func weatherAPIDay(date time.Time, hours []reading) map[string]any {
+	sum := summarize(hours)
+
+	chanceOfRain, chanceOfSnow := sum.PrecipProbability, 0.0
+	if sum.Condition == weather.ConditionSnow {
+		chanceOfRain, chanceOfSnow = 0, sum.PrecipProbability
+	}
+
+	hourly := make([]map[string]any, 0, len(hours))
+	for i, h := range hours {
+		ts := date.Add(time.Duration(i) * time.Hour)
+		hourly = append(hourly, map[string]any{
+			"time_epoch":  ts.Unix(),
+			"time":        ts.Format("2006-01-02 15:04"),
+			"temp_c":      h.TemperatureC,
+			"humidity":    h.HumidityPct,
+			"wind_kph":    round1(h.WindSpeedMS * 3.6),
+			"pressure_mb": h.PressureHpa,
+			"precip_mm":   h.PrecipMm,
+			"condition":   weatherAPICondition(h.Condition),
+		})
+	}
+
+	return map[string]any{
+		"date":       date.Format("2006-01-02"),
+		"date_epoch": date.Unix(),
+		"day": map[string]any{
+			"maxtemp_c":            sum.TempMaxC,
+			"mintemp_c":            sum.TempMinC,
+			"avgtemp_c":            sum.TempAvgC,
+			"maxwind_kph":          round1(sum.MaxWindSpeedMS * 3.6),
+			"totalprecip_mm":       sum.TotalPrecipMm,
+			"daily_chance_of_rain": chanceOfRain,
+			"daily_chance_of_snow": chanceOfSnow,
+			"condition":            weatherAPICondition(sum.Condition),
+		},
+		"hour": hourly,
+	}
+}
+
+func weatherAPICondition(c weather.Condition) map[string]any {
+	wa := weatherAPIConditions[c]
+	return map[string]any{"text": wa.text, "code": wa.code}
+}
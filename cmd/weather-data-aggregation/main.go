@@ -4,17 +4,22 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	httpapi "github.com/i474232898/weather-data-aggregation/internal/api/http"
 	"github.com/i474232898/weather-data-aggregation/internal/config"
+	"github.com/i474232898/weather-data-aggregation/internal/metrics"
 	"github.com/i474232898/weather-data-aggregation/internal/scheduler"
 	"github.com/i474232898/weather-data-aggregation/internal/store"
 	"github.com/i474232898/weather-data-aggregation/internal/weather"
@@ -28,38 +33,115 @@ func main() {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
-	// Shared HTTP client for outbound provider calls.
-	httpClient := &http.Client{
-		Timeout: time.Duration(10 * time.Second),
+	// Snapshot store with configured retention.
+	var (
+		snapshotStore weather.Store
+		registryPath  = cfg.LocationsPath
+	)
+	switch cfg.StoreBackend {
+	case config.StoreBackendFile:
+		fileStore, err := store.NewFileStore(cfg.StoreDir, cfg.StoreMaxHistory, cfg.StoreMaxAge)
+		if err != nil {
+			log.Fatalf("failed to open file store: %v", err)
+		}
+		defer fileStore.Close()
+		snapshotStore = fileStore
+		if registryPath == "" {
+			registryPath = filepath.Join(cfg.StoreDir, "locations.json")
+		}
+	default:
+		snapshotStore = store.NewMemoryStore(cfg.StoreMaxHistory, cfg.StoreMaxAge)
 	}
 
-	// In-memory store with configured retention.
-	memStore := store.NewMemoryStore(cfg.StoreMaxHistory, cfg.StoreMaxAge)
+	// Tracked locations, seeded from config on first run and persisted next
+	// to the store or to LocationsPath.
+	locations, err := store.NewLocationRegistry(registryPath, cfg.Locations)
+	if err != nil {
+		log.Fatalf("failed to load locations: %v", err)
+	}
+	if registryPath == "" {
+		log.Printf("WARNING: tracked locations are kept in memory; changes made through /api/v1/locations are lost on restart (set LOCATIONS_PATH to persist them)")
+	}
 
-	// Providers with resilience (backoff + circuit breaker).
-	var provs []weather.Provider
+	// Providers built from their config blocks by the provider registry, and
+	// rebuilt on config reload. Providers missing an API key are disabled.
+	// Open-Meteo resolves locations via its geocoding API, cached on disk.
+	geocoder := providers.NewCachedGeocoder(providers.NewOpenMeteoGeocoder(
+		&http.Client{Timeout: providers.DefaultTimeout},
+		providers.WithBaseURL(cfg.GeocoderBaseURL),
+	), cfg.GeocodeCachePath)
+	providerSet := providers.NewSet(providers.DefaultRegistry(), providers.Deps{Geocoder: geocoder})
+	provs, err := providerSet.Build(cfg.Providers)
+	if err != nil {
+		log.Fatalf("failed to build providers: %v", err)
+	}
+
+	// Optional fault injection for resilience testing, controlled through
+	// the admin API.
+	var faults *providers.FaultInjector
+	if cfg.FaultInjection {
+		log.Printf("WARNING: fault injection is enabled; provider calls can be made to fail through /api/v1/providers/{name}/faults")
+		faults = providers.NewFaultInjector()
+		provs = faults.Wrap(provs)
+	}
 
-	provs = append(provs, providers.NewOpenWeatherProvider(httpClient, cfg.OpenWeatherAPIKey))
-	provs = append(provs, providers.NewWeatherAPIProvider(httpClient, cfg.WeatherAPIKey))
+	// Core service orchestrating providers and store, with the configured
+	// aggregation strategy and forecast cache.
+	serviceOpts, err := serviceOptions(cfg)
+	if err != nil {
+		log.Fatalf("invalid aggregation config: %v", err)
+	}
 
-	// Open-Meteo does not require an API key, but geocoding requires a Google API key.
-	// provs = append(provs, providers.NewOpenMeteoProvider(httpClient, cfg.GeocoderAPIKey))
+	// Locations the scheduler fetches: the registry, plus locations fetched
+	// on demand while they keep being requested.
+	scheduled := scheduler.Sources{locations}
+	if cfg.OnDemandFetch {
+		onDemand := weather.OnDemandConfig{
+			Timeout: cfg.OnDemandTimeout,
+			// Locations nobody schedules are refetched once their snapshot
+			// is as old as a scheduled one's would get.
+			MaxAge: cfg.FetchInterval,
+			Scheduled: func(loc weather.Location) bool {
+				for _, l := range scheduled.List() {
+					if l.Key() == loc.Key() {
+						return true
+					}
+				}
+				return false
+			},
+			FailureTTL:    cfg.OnDemandFailureTTL,
+			MaxLocations:  cfg.OnDemandMaxLocations,
+			IdleTTL:       cfg.OnDemandEnrollTTL,
+			RatePerMinute: cfg.OnDemandRatePerMinute,
+		}
+		if cfg.OnDemandEnrollTTL > 0 {
+			enrolled := store.NewOnDemandLocations(cfg.OnDemandEnrollTTL)
+			onDemand.Tracker = enrolled
+			scheduled = append(scheduled, enrolled)
+		}
+		serviceOpts = append(serviceOpts, weather.WithOnDemandFetch(onDemand))
+	}
 
-	// Core service orchestrating providers and store.
-	service := weather.NewService(memStore, provs)
+	service := weather.NewService(snapshotStore, provs, serviceOpts...)
 
-	// Scheduler that periodically fetches and stores data.
-	sched := scheduler.New(cfg.Locations, cfg.FetchInterval, service)
+	// Scheduler that periodically fetches and stores data, each location on
+	// its own schedule.
+	sched := scheduler.New(scheduled, service, schedulerConfig(cfg, provs))
 	if err := sched.Start(); err != nil {
 		log.Fatalf("failed to start scheduler: %v", err)
 	}
 	defer sched.Stop()
 
+	// Parent of every request context; canceled once shutdown stops waiting
+	// for in-flight requests, so their provider calls are abandoned.
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
 	app := fiber.New(fiber.Config{
 		AppName:               "weather-data-aggregation",
 		DisableStartupMessage: true,
 		ReadTimeout:           10 * time.Second,
-		WriteTimeout:          10 * time.Second,
+		WriteTimeout:          10 * time.Second, // /weather/stream sets a deadline per write instead
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			// Centralized error response
 			code := fiber.StatusInternalServerError
@@ -76,9 +158,12 @@ func main() {
 	// Global middleware
 	app.Use(logger.New())
 	app.Use(recover.New())
+	app.Use(metrics.Middleware())
+	app.Use(httpapi.RequestContext(requestCtx))
+	// Any origin may read; cross-origin pages can't call the admin routes.
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
-		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
+		AllowMethods: "GET,HEAD,OPTIONS",
 		AllowHeaders: "*",
 	}))
 
@@ -89,8 +174,43 @@ func main() {
 		})
 	})
 
-	// API routes.
+	// Readiness: not ready until the scheduler's warm-up fetch is done, so a
+	// restarted instance doesn't serve 404s from an empty store.
+	app.Get("/ready", func(c *fiber.Ctx) error {
+		if !sched.Ready() {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"status": "warming up",
+			})
+		}
+		return c.JSON(fiber.Map{
+			"status": "ready",
+		})
+	})
+
+	// Prometheus metrics, including the age of each tracked location's newest snapshot.
+	metrics.RegisterSnapshotAge(func() map[string]time.Time {
+		latest := make(map[string]time.Time)
+		for _, loc := range scheduled.List() {
+			if snap, err := service.GetLatest(context.Background(), loc); err == nil {
+				latest[loc.Key()] = snap.Timestamp
+			}
+		}
+		return latest
+	})
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+
+	// API routes. State-changing admin routes need the admin token.
+	admin := httpapi.AdminAuth(cfg.AdminToken)
+	if cfg.AdminToken == "" {
+		log.Printf("WARNING: ADMIN_TOKEN is not set; admin routes that change locations, the scheduler, breakers or faults are disabled")
+	}
 	httpapi.RegisterRoutes(app, service)
+	httpapi.RegisterLocationRoutes(app, admin, locations, sched)
+	httpapi.RegisterProviderRoutes(app, admin, service)
+	httpapi.RegisterSchedulerRoutes(app, admin, sched)
+	if faults != nil {
+		httpapi.RegisterFaultRoutes(app, admin, faults, service)
+	}
 
 	go func() {
 		if err := app.Listen(":" + cfg.Port); err != nil {
@@ -101,12 +221,32 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// Hot reload on SIGHUP and, with a config file, when the file changes.
+	reload := &reloader{current: cfg, provs: providerSet, faults: faults, service: service, sched: sched}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reload.reload("SIGHUP")
+		}
+	}()
+	if cfg.File != "" && cfg.ConfigWatchInterval > 0 {
+		go config.Watch(ctx, cfg.File, cfg.ConfigWatchInterval, func() {
+			reload.reload("change of " + cfg.File)
+		})
+	}
+
 	<-ctx.Done()
 	log.Println("Received termination signal, shutting down.")
+
+	// End live streams so their connections don't hold up shutdown.
+	service.CloseSubscriptions()
+
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := app.ShutdownWithContext(shutdownCtx); err != nil {
 		log.Printf("error during shutdown: %v", err)
 	}
+	cancelRequests()
 }
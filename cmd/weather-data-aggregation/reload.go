@@ -0,0 +1,132 @@
+package main
+
+import (
+	"log"
+	"reflect"
+	"sync"
+
+	"github.com/i474232898/weather-data-aggregation/internal/config"
+	"github.com/i474232898/weather-data-aggregation/internal/scheduler"
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+	"github.com/i474232898/weather-data-aggregation/internal/weather/providers"
+)
+
+// serviceOptions returns the service options that can change on reload: the
+// aggregation strategy and the forecast cache.
+func serviceOptions(cfg *config.AppConfig) ([]weather.ServiceOption, error) {
+	aggregator, err := weather.NewAggregator(cfg.AggregationStrategy, weather.AggregatorOptions{
+		Weights:          cfg.AggregationWeights,
+		TrimFraction:     cfg.AggregationTrimFraction,
+		OutlierThreshold: cfg.AggregationOutlierThreshold,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []weather.ServiceOption{
+		weather.WithAggregator(aggregator),
+		weather.WithForecastCache(weather.ForecastCacheConfig{
+			TTL:                  cfg.ForecastCacheTTL,
+			ProviderTTLs:         cfg.ForecastCacheProviderTTLs,
+			StaleWhileRevalidate: cfg.ForecastCacheStale,
+		}),
+	}, nil
+}
+
+// schedulerConfig returns the scheduler configuration for cfg, pacing fetches
+// to the budgets of provs if enabled.
+func schedulerConfig(cfg *config.AppConfig, provs []weather.Provider) scheduler.Config {
+	schedCfg := scheduler.Config{
+		Interval:       cfg.FetchInterval,
+		Jitter:         cfg.FetchJitter,
+		MaxConcurrency: cfg.FetchMaxConcurrency,
+		RunLogSize:     cfg.SchedulerRunLogSize,
+		Backfill:       cfg.Backfill,
+	}
+	if cfg.FetchPacing {
+		schedCfg.PacePerSecond = providers.PacingRate(provs)
+	}
+	return schedCfg
+}
+
+// reloader applies configuration changes to the running service without
+// restarting the HTTP server: providers, aggregation, the forecast cache and
+// the scheduler are rebuilt. Settings that need a restart are only logged.
+type reloader struct {
+	mu      sync.Mutex
+	current *config.AppConfig // the configuration last loaded
+	provs   *providers.Set
+	faults  *providers.FaultInjector // nil without fault injection
+	service *weather.Service
+	sched   *scheduler.Scheduler
+}
+
+// reload re-reads the configuration. An invalid configuration is logged and
+// the current one is kept.
+func (r *reloader) reload(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := config.LoadFile(r.current.File)
+	if err != nil {
+		log.Printf("config: reload on %s failed; keeping the current configuration: %v", reason, err)
+		return
+	}
+	opts, err := serviceOptions(cfg)
+	if err != nil {
+		log.Printf("config: reload on %s failed; keeping the current configuration: %v", reason, err)
+		return
+	}
+	provs, err := r.provs.Build(cfg.Providers)
+	if err != nil {
+		log.Printf("config: reload on %s failed; keeping the current configuration: %v", reason, err)
+		return
+	}
+	if r.faults != nil {
+		provs = r.faults.Wrap(provs)
+	}
+
+	r.service.Reconfigure(provs, opts...)
+	if err := r.sched.Reconfigure(schedulerConfig(cfg, provs)); err != nil {
+		log.Printf("config: scheduler not reconfigured: %v", err)
+	}
+
+	// Compare with the last load so each change is logged once, not on
+	// every reload until the next restart.
+	for _, setting := range restartRequired(r.current, cfg) {
+		log.Printf("config: %s changed; restart to apply it", setting)
+	}
+	if !reflect.DeepEqual(r.current.Locations, cfg.Locations) {
+		log.Printf("config: locations changed; they only seed a new location registry, so use the locations API to change tracked locations")
+	}
+	r.current = cfg
+	log.Printf("config: reloaded on %s", reason)
+}
+
+// restartRequired returns the settings that differ between old and cfg but
+// are only applied at startup.
+func restartRequired(old, cfg *config.AppConfig) []string {
+	var changed []string
+	for _, s := range []struct {
+		name     string
+		old, new any
+	}{
+		{"server.port", old.Port, cfg.Port},
+		{"server.admin_token", old.AdminToken, cfg.AdminToken},
+		{"store.backend", old.StoreBackend, cfg.StoreBackend},
+		{"store.dir", old.StoreDir, cfg.StoreDir},
+		{"store.locations_path", old.LocationsPath, cfg.LocationsPath},
+		{"store.max_history", old.StoreMaxHistory, cfg.StoreMaxHistory},
+		{"store.max_age", old.StoreMaxAge, cfg.StoreMaxAge},
+		{"scheduler.run_log_size", old.SchedulerRunLogSize, cfg.SchedulerRunLogSize},
+		{"on_demand", []any{old.OnDemandFetch, old.OnDemandTimeout, old.OnDemandEnrollTTL, old.OnDemandFailureTTL, old.OnDemandMaxLocations, old.OnDemandRatePerMinute},
+			[]any{cfg.OnDemandFetch, cfg.OnDemandTimeout, cfg.OnDemandEnrollTTL, cfg.OnDemandFailureTTL, cfg.OnDemandMaxLocations, cfg.OnDemandRatePerMinute}},
+		{"fault_injection.enabled", old.FaultInjection, cfg.FaultInjection},
+		{"geocoder", []any{old.GeocoderBaseURL, old.GeocodeCachePath}, []any{cfg.GeocoderBaseURL, cfg.GeocodeCachePath}},
+	} {
+		if !reflect.DeepEqual(s.old, s.new) {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package httpapi
+
+import (
+	"context"
+	"net"
+)
+
+// watchDisconnect is not supported on this platform: requests are only
+// canceled when their handler returns or the base context is canceled.
+func watchDisconnect(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	return nil
+}
@@ -0,0 +1,65 @@
+//go:build unix
+
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// watchDisconnect calls cancel once the client closes conn. fasthttp does not
+// read from a connection while its handler runs, so the socket is watched
+// here; it is peeked at rather than read, leaving a pipelined request for
+// fasthttp, and watching stops once one arrives. The returned func stops the
+// watch and must be called before the handler returns. It is nil when conn is
+// not a socket (e.g. TLS, or app.Test).
+func watchDisconnect(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		var (
+			buf    [1]byte
+			closed bool
+		)
+		err := rc.Read(func(fd uintptr) bool {
+			for {
+				n, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK)
+				switch {
+				case errors.Is(err, syscall.EINTR):
+					continue
+				case errors.Is(err, syscall.EAGAIN):
+					return false // wait until readable
+				case err != nil:
+					closed = true // e.g. reset by the client
+				default:
+					closed = n == 0
+				}
+				return true
+			}
+		})
+		if err == nil && closed {
+			cancel()
+		}
+	}()
+
+	return func() {
+		// An expired deadline wakes the watcher. fasthttp sets its own
+		// deadline, if any, before reading the next request.
+		_ = conn.SetReadDeadline(time.Unix(1, 0))
+		<-done
+		_ = conn.SetReadDeadline(time.Time{})
+	}
+}
@@ -0,0 +1,175 @@
+package httpapi
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+	"github.com/i474232898/weather-data-aggregation/internal/weather/providers"
+)
+
+// faultRuleBody is a providers.FaultRule in requests and responses, with
+// durations such as "2s".
+type faultRuleBody struct {
+	Kind        string   `json:"kind"`
+	Probability *float64 `json:"probability,omitempty"` // 1 if omitted
+	Every       string   `json:"every,omitempty"`
+	For         string   `json:"for,omitempty"`
+	Operations  []string `json:"operations,omitempty"`
+	Latency     string   `json:"latency,omitempty"`
+	Status      int      `json:"status,omitempty"`
+	Staleness   string   `json:"staleness,omitempty"`
+	Offset      float64  `json:"offset,omitempty"`
+}
+
+func newFaultRuleBodies(rules []providers.FaultRule) []faultRuleBody {
+	duration := func(d time.Duration) string {
+		if d == 0 {
+			return ""
+		}
+		return d.String()
+	}
+
+	bodies := make([]faultRuleBody, 0, len(rules))
+	for _, r := range rules {
+		bodies = append(bodies, faultRuleBody{
+			Kind:        r.Kind,
+			Probability: weather.Float64(r.Probability),
+			Every:       duration(r.Every),
+			For:         duration(r.For),
+			Operations:  r.Operations,
+			Latency:     duration(r.Latency),
+			Status:      r.Status,
+			Staleness:   duration(r.Staleness),
+			Offset:      r.Offset,
+		})
+	}
+	return bodies
+}
+
+func (b faultRuleBody) toRule() (providers.FaultRule, error) {
+	rule := providers.FaultRule{
+		Kind:        b.Kind,
+		Probability: 1,
+		Operations:  b.Operations,
+		Status:      b.Status,
+		Offset:      b.Offset,
+	}
+	if b.Probability != nil {
+		rule.Probability = *b.Probability
+	}
+
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"every", b.Every, &rule.Every},
+		{"for", b.For, &rule.For},
+		{"latency", b.Latency, &rule.Latency},
+		{"staleness", b.Staleness, &rule.Staleness},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return providers.FaultRule{}, fmt.Errorf("%s: invalid duration %q", d.name, d.value)
+		}
+		*d.dst = v
+	}
+	return rule, nil
+}
+
+// providerName returns the name path parameter. It is copied, since Fiber
+// reuses the memory of parameters once the handler returns and the name may
+// be kept as a key of the rules.
+func providerName(c *fiber.Ctx) string {
+	return strings.Clone(c.Params("name"))
+}
+
+// RegisterFaultRoutes wires the fault injection admin handlers, which set the
+// faults injected into the calls of the service's providers. Changes run
+// behind admin (see AdminAuth).
+func RegisterFaultRoutes(app *fiber.App, admin fiber.Handler, faults *providers.FaultInjector, service *weather.Service) {
+	v1 := app.Group("/api/v1")
+
+	known := func(name string) bool {
+		for _, p := range service.Providers() {
+			if p.Name() == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	v1.Get("/faults", func(c *fiber.Ctx) error {
+		all := make(map[string][]faultRuleBody)
+		for name, rules := range faults.AllRules() {
+			all[name] = newFaultRuleBodies(rules)
+		}
+		return c.JSON(fiber.Map{
+			"faults": all,
+		})
+	})
+
+	v1.Delete("/faults", admin, func(c *fiber.Ctx) error {
+		faults.Clear()
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	v1.Get("/providers/:name/faults", func(c *fiber.Ctx) error {
+		name := providerName(c)
+		if !known(name) {
+			return fiber.NewError(fiber.StatusNotFound, "unknown provider")
+		}
+		return c.JSON(fiber.Map{
+			"provider": name,
+			"rules":    newFaultRuleBodies(faults.Rules(name)),
+		})
+	})
+
+	v1.Put("/providers/:name/faults", admin, func(c *fiber.Ctx) error {
+		name := providerName(c)
+		if !known(name) {
+			return fiber.NewError(fiber.StatusNotFound, "unknown provider")
+		}
+
+		var body struct {
+			Rules []faultRuleBody `json:"rules"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+		}
+		rules := make([]providers.FaultRule, 0, len(body.Rules))
+		for i, b := range body.Rules {
+			rule, err := b.toRule()
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("rules[%d]: %v", i, err))
+			}
+			rules = append(rules, rule)
+		}
+		if err := faults.SetRules(name, rules); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		return c.JSON(fiber.Map{
+			"provider": name,
+			"rules":    newFaultRuleBodies(faults.Rules(name)),
+		})
+	})
+
+	v1.Delete("/providers/:name/faults", admin, func(c *fiber.Ctx) error {
+		name := providerName(c)
+		if !known(name) {
+			return fiber.NewError(fiber.StatusNotFound, "unknown provider")
+		}
+		if err := faults.SetRules(name, nil); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+}
@@ -0,0 +1,133 @@
+package httpapi
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/i474232898/weather-data-aggregation/internal/scheduler"
+	"github.com/i474232898/weather-data-aggregation/internal/store"
+)
+
+// RegisterLocationRoutes wires the handlers for managing tracked locations
+// and their schedules; changes run behind admin (see AdminAuth). Newly added
+// locations are fetched immediately via sched.
+func RegisterLocationRoutes(app *fiber.App, admin fiber.Handler, locations *store.LocationRegistry, sched *scheduler.Scheduler) {
+	v1 := app.Group("/api/v1")
+
+	v1.Get("/locations", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"locations": locations.Tracked(),
+		})
+	})
+
+	v1.Post("/locations", admin, func(c *fiber.Ctx) error {
+		var body locationBody
+		if err := c.BodyParser(&body); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+		}
+
+		q := body.toQuery()
+		if err := validate.Struct(q); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		schedule, err := parseScheduleBody(body.Schedule)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		tracked, added, err := locations.Add(q.toLocation(), schedule)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "failed to save location")
+		}
+		if !added {
+			if schedule != "" && schedule != tracked.Schedule {
+				return fiber.NewError(fiber.StatusConflict, "location is already tracked with a different schedule; use PATCH to change it")
+			}
+			return c.JSON(tracked)
+		}
+
+		sched.Refresh(tracked.Location)
+		return c.Status(fiber.StatusCreated).JSON(tracked)
+	})
+
+	v1.Patch("/locations/:id", admin, func(c *fiber.Ctx) error {
+		id, err := url.PathUnescape(c.Params("id"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid location id")
+		}
+		key := strings.ToLower(id)
+
+		var body struct {
+			Schedule *string `json:"schedule"`
+		}
+		if err := c.BodyParser(&body); err != nil || body.Schedule == nil {
+			return fiber.NewError(fiber.StatusBadRequest, "expected a JSON body with a schedule")
+		}
+		schedule, err := parseScheduleBody(*body.Schedule)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		found, err := locations.SetSchedule(key, schedule)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "failed to save location schedule")
+		}
+		if !found {
+			return fiber.NewError(fiber.StatusNotFound, "location is not tracked")
+		}
+
+		loc, _ := locations.Get(key)
+		return c.JSON(store.TrackedLocation{Location: loc, Schedule: schedule})
+	})
+
+	v1.Delete("/locations/:id", admin, func(c *fiber.Ctx) error {
+		id, err := url.PathUnescape(c.Params("id"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid location id")
+		}
+
+		removed, err := locations.Remove(strings.ToLower(id))
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "failed to remove location")
+		}
+		if !removed {
+			return fiber.NewError(fiber.StatusNotFound, "location is not tracked")
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+}
+
+// locationBody is the JSON body for adding a location, either by
+// city/country or by lat/lon, with an optional schedule.
+type locationBody struct {
+	City     string   `json:"city"`
+	Country  string   `json:"country"`
+	Lat      *float64 `json:"lat"`
+	Lon      *float64 `json:"lon"`
+	Schedule string   `json:"schedule"`
+}
+
+// parseScheduleBody validates a schedule from a request body and returns it
+// trimmed. An empty schedule selects the default interval.
+func parseScheduleBody(schedule string) (string, error) {
+	schedule = strings.TrimSpace(schedule)
+	if schedule == "" {
+		return "", nil
+	}
+	if _, err := scheduler.ParseSchedule(schedule); err != nil {
+		return "", err
+	}
+	return schedule, nil
+}
+
+func (b locationBody) toQuery() locationQuery {
+	return locationQuery{
+		City:    strings.TrimSpace(b.City),
+		Country: strings.TrimSpace(b.Country),
+		Lat:     b.Lat,
+		Lon:     b.Lon,
+	}
+}
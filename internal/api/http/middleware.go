@@ -0,0 +1,48 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestContext gives every request a context (c.UserContext()) derived from
+// base that is canceled when the handler returns or the client closes the
+// connection, so provider calls and store reads made on its behalf stop with
+// it; canceling base (e.g. on shutdown) cancels all requests in flight.
+//
+// The context is deliberately not derived from c.Context(): fasthttp recycles
+// the RequestCtx once the handler returns, while work detached from the request
+// (such as a shared forecast cache refresh) may still look up its values.
+func RequestContext(base context.Context) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithCancel(base)
+		defer cancel()
+
+		if stop := watchDisconnect(c.Context().Conn(), cancel); stop != nil {
+			defer stop()
+		}
+
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
+
+// AdminAuth guards the state-changing admin routes (locations, scheduler
+// control, breaker resets, fault injection): requests must send
+// "Authorization: Bearer <token>". With an empty token the admin routes are
+// disabled and always answer 403.
+func AdminAuth(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token == "" {
+			return fiber.NewError(fiber.StatusForbidden, "admin API disabled: no admin token configured")
+		}
+		got, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return fiber.NewError(fiber.StatusUnauthorized, "missing or invalid admin token")
+		}
+		return c.Next()
+	}
+}
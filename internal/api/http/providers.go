@@ -0,0 +1,67 @@
+package httpapi
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+	"github.com/i474232898/weather-data-aggregation/internal/weather/providers"
+)
+
+// providerStatus describes a configured provider for the status endpoint.
+type providerStatus struct {
+	Name           string                   `json:"name"`
+	Forecast       bool                     `json:"forecast"`
+	HourlyForecast bool                     `json:"hourlyForecast"`
+	Breaker        *providers.BreakerStatus `json:"breaker,omitempty"`
+	Quota          *providers.QuotaUsage    `json:"quota,omitempty"`
+}
+
+func newProviderStatus(p weather.Provider) providerStatus {
+	status := providerStatus{Name: p.Name()}
+	_, status.Forecast = p.(weather.ForecastProvider)
+	_, status.HourlyForecast = p.(weather.HourlyForecastProvider)
+	if bp, ok := p.(providers.BreakerProvider); ok && bp.Breaker() != nil {
+		breaker := bp.Breaker().Status()
+		status.Breaker = &breaker
+	}
+	if qp, ok := p.(providers.QuotaProvider); ok && qp.Quota() != nil {
+		usage := qp.Quota().Usage()
+		status.Quota = &usage
+	}
+	return status
+}
+
+// RegisterProviderRoutes wires the provider status and admin handlers; the
+// latter run behind admin (see AdminAuth).
+func RegisterProviderRoutes(app *fiber.App, admin fiber.Handler, service *weather.Service) {
+	v1 := app.Group("/api/v1")
+
+	v1.Get("/providers", func(c *fiber.Ctx) error {
+		statuses := []providerStatus{}
+		for _, p := range service.Providers() {
+			statuses = append(statuses, newProviderStatus(p))
+		}
+
+		return c.JSON(fiber.Map{
+			"providers": statuses,
+		})
+	})
+
+	v1.Post("/providers/:name/reset", admin, func(c *fiber.Ctx) error {
+		name := c.Params("name")
+		for _, p := range service.Providers() {
+			if p.Name() != name {
+				continue
+			}
+
+			bp, ok := p.(providers.BreakerProvider)
+			if !ok || bp.Breaker() == nil {
+				return fiber.NewError(fiber.StatusConflict, "provider has no circuit breaker")
+			}
+			bp.Breaker().Reset()
+			return c.JSON(newProviderStatus(p))
+		}
+
+		return fiber.NewError(fiber.StatusNotFound, "unknown provider")
+	})
+}
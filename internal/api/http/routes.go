@@ -1,6 +1,7 @@
 package httpapi
 
 import (
+	"context"
 	"errors"
 	"strconv"
 	"time"
@@ -25,15 +26,40 @@ func RegisterRoutes(app *fiber.App, service *weather.Service) {
 		}
 
 		loc := locReq.toLocation()
-		snapshot, err := service.GetLatest(loc)
-		if err != nil {
+		snapshot, err := service.GetCurrent(c.UserContext(), loc)
+		failures := service.LastFetchErrors(loc)
+		// A stale snapshot that could not be refreshed is still served.
+		stale := errors.Is(err, weather.ErrStale)
+		if err != nil && !stale {
 			if errors.Is(err, store.ErrNotFound) {
+				if len(failures) > 0 {
+					return providerErrorResponse(c, fiber.StatusNotFound, "no weather data for requested location", failures)
+				}
 				return fiber.NewError(fiber.StatusNotFound, "no weather data for requested location")
 			}
+			// The location was fetched on demand, and every provider failed.
+			if failures := weather.ProviderErrors(err); len(failures) > 0 {
+				return providerErrorResponse(c, fiber.StatusBadGateway, "failed to fetch weather data", failures)
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				return fiber.NewError(fiber.StatusGatewayTimeout, "timed out fetching weather data")
+			}
+			if errors.Is(err, weather.ErrOnDemandLimit) {
+				return fiber.NewError(fiber.StatusTooManyRequests, err.Error())
+			}
 			return fiber.NewError(fiber.StatusInternalServerError, "failed to fetch weather data")
 		}
 
-		return c.JSON(snapshot)
+		return c.JSON(currentResponse{WeatherSnapshot: snapshot, ProviderErrors: failures, Stale: stale})
+	})
+
+	v1.Get("/weather/stream", func(c *fiber.Ctx) error {
+		locs, err := parseStreamLocations(c)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		return streamSnapshots(c, service, locs)
 	})
 
 	v1.Get("/weather/history", func(c *fiber.Ctx) error {
@@ -47,7 +73,7 @@ func RegisterRoutes(app *fiber.App, service *weather.Service) {
 		}
 
 		loc := req.Location.toLocation()
-		snapshots, err := service.GetRange(loc, req.From, req.To)
+		snapshots, err := service.GetRange(c.UserContext(), loc, req.From, req.To)
 		if err != nil {
 			if errors.Is(err, store.ErrNotFound) {
 				return fiber.NewError(fiber.StatusNotFound, "no weather history for requested range")
@@ -74,11 +100,15 @@ func RegisterRoutes(app *fiber.App, service *weather.Service) {
 		}
 
 		loc := req.Location.toLocation()
-		forecast, err := service.GetForecast(loc, req.Days)
+		forecast, cacheStatus, err := service.GetForecast(c.UserContext(), loc, req.Days)
+		setCacheHeader(c, cacheStatus)
 		if err != nil {
 			if errors.Is(err, store.ErrNotFound) {
 				return fiber.NewError(fiber.StatusNotFound, "no forecast data for requested location")
 			}
+			if failures := weather.ProviderErrors(err); len(failures) > 0 {
+				return providerErrorResponse(c, fiber.StatusBadGateway, "failed to fetch weather forecast", failures)
+			}
 			return fiber.NewError(fiber.StatusInternalServerError, "failed to fetch weather forecast")
 		}
 
@@ -88,19 +118,78 @@ func RegisterRoutes(app *fiber.App, service *weather.Service) {
 			"forecast": forecast,
 		})
 	})
+
+	v1.Get("/weather/forecast/hourly", func(c *fiber.Ctx) error {
+		var req hourlyForecastQuery
+		if err := req.bind(c); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		if err := validate.Struct(req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		loc := req.Location.toLocation()
+		forecast, cacheStatus, err := service.GetHourlyForecast(c.UserContext(), loc, req.Hours)
+		setCacheHeader(c, cacheStatus)
+		if err != nil {
+			if failures := weather.ProviderErrors(err); len(failures) > 0 {
+				return providerErrorResponse(c, fiber.StatusBadGateway, "failed to fetch hourly weather forecast", failures)
+			}
+			return fiber.NewError(fiber.StatusInternalServerError, "failed to fetch hourly weather forecast")
+		}
+
+		return c.JSON(fiber.Map{
+			"location": loc,
+			"hours":    req.Hours,
+			"forecast": forecast,
+		})
+	})
+}
+
+// setCacheHeader reports how a forecast was served (HIT, STALE or MISS) in
+// the X-Cache header. Nothing is set when the forecast cache is disabled.
+func setCacheHeader(c *fiber.Ctx, status weather.CacheStatus) {
+	if status != weather.CacheDisabled {
+		c.Set("X-Cache", string(status))
+	}
+}
+
+// currentResponse is the latest snapshot plus the providers that failed in
+// the most recent fetch, and whether the snapshot is older than the on-demand
+// max age because refreshing it failed.
+type currentResponse struct {
+	weather.WeatherSnapshot
+	ProviderErrors []*weather.ProviderError `json:"providerErrors,omitempty"`
+	Stale          bool                     `json:"stale,omitempty"`
+}
+
+// providerErrorResponse writes the usual error body extended with the
+// provider failures behind it.
+func providerErrorResponse(c *fiber.Ctx, status int, message string, failures []*weather.ProviderError) error {
+	return c.Status(status).JSON(fiber.Map{
+		"error":          true,
+		"message":        message,
+		"providerErrors": failures,
+	})
 }
 
-// locationQuery holds query parameters for identifying a location.
+// locationQuery holds query parameters for identifying a location, either
+// by city/country or by lat/lon.
 type locationQuery struct {
-	City    string `validate:"required"`
-	Country string `validate:"required"`
+	City    string   `validate:"required_without_all=Lat Lon"`
+	Country string   `validate:"required_with=City"`
+	Lat     *float64 `validate:"required_with=Lon,omitempty,min=-90,max=90"`
+	Lon     *float64 `validate:"required_with=Lat,omitempty,min=-180,max=180"`
 }
 
 func (l locationQuery) toLocation() weather.Location {
 	return weather.Location{
 		City:    l.City,
 		Country: l.Country,
-	}
+		Lat:     l.Lat,
+		Lon:     l.Lon,
+	}.Normalize()
 }
 
 func parseLocationQuery(c *fiber.Ctx) (locationQuery, error) {
@@ -109,6 +198,14 @@ func parseLocationQuery(c *fiber.Ctx) (locationQuery, error) {
 	q.City = c.Query("city")
 	q.Country = c.Query("country")
 
+	var err error
+	if q.Lat, err = parseCoordinate(c.Query("lat")); err != nil {
+		return q, errors.New("lat must be a number")
+	}
+	if q.Lon, err = parseCoordinate(c.Query("lon")); err != nil {
+		return q, errors.New("lon must be a number")
+	}
+
 	if err := validate.Struct(q); err != nil {
 		return q, err
 	}
@@ -116,6 +213,18 @@ func parseLocationQuery(c *fiber.Ctx) (locationQuery, error) {
 	return q, nil
 }
 
+// parseCoordinate parses an optional coordinate; an empty string yields nil.
+func parseCoordinate(s string) (*float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
 // historyQuery holds query parameters for the history endpoint.
 type historyQuery struct {
 	Location locationQuery
@@ -187,3 +296,30 @@ func (f *forecastQuery) bind(c *fiber.Ctx) error {
 	f.Days = days
 	return nil
 }
+
+// hourlyForecastQuery holds query parameters for the hourly forecast endpoint.
+type hourlyForecastQuery struct {
+	Location locationQuery
+	Hours    int `validate:"required,min=1,max=120"`
+}
+
+func (h *hourlyForecastQuery) bind(c *fiber.Ctx) error {
+	loc, err := parseLocationQuery(c)
+	if err != nil {
+		return err
+	}
+	h.Location = loc
+
+	hoursStr := c.Query("hours")
+	if hoursStr == "" {
+		return errors.New("hours query parameter is required")
+	}
+
+	hours, err := strconv.Atoi(hoursStr)
+	if err != nil {
+		return errors.New("hours must be an integer between 1 and 120")
+	}
+
+	h.Hours = hours
+	return nil
+}
@@ -1,17 +1,65 @@
 package httpapi
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/i474232898/weather-data-aggregation/internal/scheduler"
 	"github.com/i474232898/weather-data-aggregation/internal/store"
 	"github.com/i474232898/weather-data-aggregation/internal/weather"
+	"github.com/i474232898/weather-data-aggregation/internal/weather/providers"
 )
 
+// noAuth stands in for AdminAuth in tests of the admin routes themselves.
+func noAuth(c *fiber.Ctx) error { return c.Next() }
+
+// TestAdminAuth verifies that admin routes require the configured bearer
+// token, and are disabled without one.
+func TestAdminAuth(t *testing.T) {
+	app := fiber.New()
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) }
+	app.Post("/admin", AdminAuth("secret"), ok)
+	app.Post("/disabled", AdminAuth(""), ok)
+
+	for _, tc := range []struct {
+		path, auth string
+		want       int
+	}{
+		{"/admin", "", http.StatusUnauthorized},
+		{"/admin", "Bearer wrong", http.StatusUnauthorized},
+		{"/admin", "secret", http.StatusUnauthorized},
+		{"/admin", "Bearer secret", http.StatusNoContent},
+		{"/disabled", "Bearer ", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s with %q: expected status %d, got %d", tc.path, tc.auth, tc.want, resp.StatusCode)
+		}
+	}
+}
+
 // TestForecastDaysValidation verifies that the forecast endpoint enforces the
 // expected 1-7 range for the `days` query parameter.
 func TestForecastDaysValidation(t *testing.T) {
@@ -41,3 +89,698 @@ func TestForecastDaysValidation(t *testing.T) {
 		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
 	}
 }
+
+// TestCurrentLocationKeyNormalization verifies that city/country lookups are
+// case-insensitive and that lat/lon queries resolve coordinate-based locations.
+func TestCurrentLocationKeyNormalization(t *testing.T) {
+	app := fiber.New()
+
+	memStore := store.NewMemoryStore(10, time.Hour)
+	lat, lon := 48.85661, 2.35222
+	memStore.SaveSnapshot(context.Background(), weather.Location{City: "Paris", Country: "FR"}, weather.WeatherSnapshot{Timestamp: time.Now().UTC()})
+	memStore.SaveSnapshot(context.Background(), weather.Location{Lat: &lat, Lon: &lon}, weather.WeatherSnapshot{Timestamp: time.Now().UTC()})
+
+	svc := weather.NewService(memStore, nil)
+	RegisterRoutes(app, svc)
+
+	cases := []struct {
+		query  string
+		status int
+	}{
+		{"city=paris&country=fr", http.StatusOK},
+		{"city=%20PARIS&country=Fr", http.StatusOK},
+		{"lat=48.8566&lon=2.3522", http.StatusOK},
+		{"lat=48.8566", http.StatusBadRequest},
+		{"lat=north&lon=2.3522", http.StatusBadRequest},
+		{"lat=91&lon=2.3522", http.StatusBadRequest},
+		{"city=Paris", http.StatusBadRequest},
+		{"lat=10&lon=10", http.StatusNotFound},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/weather/current?"+tc.query, nil)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.query, err)
+		}
+		if resp.StatusCode != tc.status {
+			t.Fatalf("%s: expected status %d, got %d", tc.query, tc.status, resp.StatusCode)
+		}
+	}
+}
+
+// TestHourlyForecastHoursValidation verifies that the hourly forecast endpoint
+// enforces the expected 1-120 range for the `hours` query parameter.
+func TestHourlyForecastHoursValidation(t *testing.T) {
+	app := fiber.New()
+
+	memStore := store.NewMemoryStore(10, time.Hour)
+	svc := weather.NewService(memStore, nil)
+	RegisterRoutes(app, svc)
+
+	for _, query := range []string{"", "&hours=0", "&hours=121", "&hours=six"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/weather/forecast/hourly?city=Paris&country=FR"+query, nil)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%q: expected status %d, got %d", query, http.StatusBadRequest, resp.StatusCode)
+		}
+	}
+}
+
+// TestStreamReplaysFromLastEventID verifies that a reconnecting client
+// receives the events published after its Last-Event-ID, even when their
+// snapshots share a timestamp, and every kept event for an unknown ID.
+func TestStreamReplaysFromLastEventID(t *testing.T) {
+	app := fiber.New()
+
+	loc := weather.Location{City: "Paris", Country: "FR"}
+	observed := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	provs := []weather.Provider{stubProvider{name: "stub", reading: weather.ProviderReading{ProviderName: "stub", Timestamp: observed, TemperatureC: weather.Float64(18)}}}
+	svc := weather.NewService(store.NewMemoryStore(10, 0), provs)
+
+	sub := svc.Subscribe(loc)
+	var events []weather.SnapshotEvent
+	for i := 0; i < 3; i++ {
+		if err := svc.FetchAndStore(context.Background(), loc); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		events = append(events, <-sub.C)
+	}
+	sub.Close()
+	// With subscriptions closed the stream ends after the replay.
+	svc.CloseSubscriptions()
+	RegisterRoutes(app, svc)
+
+	stream := func(lastEventID string) string {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/weather/stream?city=Paris&country=FR", nil)
+		req.Header.Set("Last-Event-ID", lastEventID)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("unexpected content type %q", ct)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return string(body)
+	}
+
+	body := stream(strconv.FormatUint(events[0].Seq, 10))
+	if n := strings.Count(body, "event: snapshot"); n != 2 {
+		t.Fatalf("expected 2 replayed events, got %d:\n%s", n, body)
+	}
+	for _, ev := range events[1:] {
+		if !strings.Contains(body, "id: "+strconv.FormatUint(ev.Seq, 10)+"\n") {
+			t.Fatalf("expected event id %d:\n%s", ev.Seq, body)
+		}
+	}
+
+	if body := stream("1"); strings.Count(body, "event: snapshot") != 3 {
+		t.Fatalf("expected every kept event for an unknown id:\n%s", body)
+	}
+}
+
+// TestStreamOutlivesWriteTimeout verifies that a stream keeps delivering
+// events after the server's WriteTimeout, which applies to whole responses.
+func TestStreamOutlivesWriteTimeout(t *testing.T) {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, WriteTimeout: 100 * time.Millisecond})
+	provs := []weather.Provider{stubProvider{name: "stub", reading: weather.ProviderReading{ProviderName: "stub", TemperatureC: weather.Float64(18)}}}
+	svc := weather.NewService(store.NewMemoryStore(10, time.Hour), provs)
+	RegisterRoutes(app, svc)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	go app.Listener(ln)
+	defer app.Shutdown()
+	// Ends the stream, which would otherwise hold the shutdown up.
+	defer svc.CloseSubscriptions()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/api/v1/weather/stream?city=Paris&country=FR")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	time.Sleep(300 * time.Millisecond)
+	if err := svc.FetchAndStore(context.Background(), weather.Location{City: "Paris", Country: "FR"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events := make(chan error, 1)
+	go func() {
+		br := bufio.NewReader(resp.Body)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				events <- err
+				return
+			}
+			if line == "event: snapshot\n" {
+				events <- nil
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-events:
+		if err != nil {
+			t.Fatalf("expected a snapshot event, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for a snapshot event")
+	}
+}
+
+// TestLocationsLifecycle verifies adding, listing, rescheduling and removing
+// tracked locations through the API.
+func TestLocationsLifecycle(t *testing.T) {
+	app := fiber.New()
+
+	registry, err := store.NewLocationRegistry("", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc := weather.NewService(store.NewMemoryStore(10, time.Hour), nil)
+	RegisterLocationRoutes(app, noAuth, registry, scheduler.New(registry, svc, scheduler.Config{Interval: time.Minute}))
+
+	post := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/locations", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if code := post(`{"city":"New York","country":"us"}`); code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, code)
+	}
+	if code := post(`{"city":"new york","country":"US"}`); code != http.StatusOK {
+		t.Fatalf("expected status %d for duplicate, got %d", http.StatusOK, code)
+	}
+	if code := post(`{"city":"Paris"}`); code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, code)
+	}
+	if code := post(`{"city":"Oslo","country":"no","schedule":"100ms"}`); code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for an invalid schedule, got %d", http.StatusBadRequest, code)
+	}
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/locations", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var list struct {
+		Locations []weather.Location `json:"locations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list.Locations) != 1 || list.Locations[0].ID != "new york:us" {
+		t.Fatalf("unexpected locations: %+v", list.Locations)
+	}
+
+	patch := func(id, body string) int {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/locations/"+id, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp.StatusCode
+	}
+	if code := patch("new%20york:us", `{"schedule":"*/5 * * * *"}`); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if got := registry.Schedule("new york:us"); got != "*/5 * * * *" {
+		t.Fatalf("expected schedule to be saved, got %q", got)
+	}
+	if code := post(`{"city":"New York","country":"us","schedule":"1m"}`); code != http.StatusConflict {
+		t.Fatalf("expected status %d for a different schedule, got %d", http.StatusConflict, code)
+	}
+	if code := post(`{"city":"New York","country":"us","schedule":"*/5 * * * *"}`); code != http.StatusOK {
+		t.Fatalf("expected status %d for the same schedule, got %d", http.StatusOK, code)
+	}
+	if code := patch("new%20york:us", `{"schedule":"100ms"}`); code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, code)
+	}
+	if code := patch("paris:fr", `{"schedule":"1m"}`); code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, code)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodDelete, "/api/v1/locations/new%20york:us", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodDelete, "/api/v1/locations/new%20york:us", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+// TestProvidersStatusAndReset verifies that configured providers are listed
+// with their capabilities and breaker state, and that resets are routed by name.
+func TestProvidersStatusAndReset(t *testing.T) {
+	app := fiber.New()
+
+	provs := []weather.Provider{providers.NewOpenWeatherProvider(http.DefaultClient, "", providers.NewQuota(providers.QuotaConfig{PerDay: 1000}))}
+	svc := weather.NewService(store.NewMemoryStore(10, time.Hour), provs)
+	RegisterProviderRoutes(app, noAuth, svc)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/providers", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var list struct {
+		Providers []providerStatus `json:"providers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list.Providers) != 1 {
+		t.Fatalf("expected 1 provider, got %d", len(list.Providers))
+	}
+	got := list.Providers[0]
+	if got.Name != "openweathermap" || !got.Forecast || got.Breaker == nil || got.Breaker.State != "closed" {
+		t.Fatalf("unexpected provider status: %+v", got)
+	}
+	if got.Quota == nil || got.Quota.RemainingToday == nil || *got.Quota.RemainingToday != 1000 {
+		t.Fatalf("unexpected quota usage: %+v", got.Quota)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodPost, "/api/v1/providers/openweathermap/reset", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodPost, "/api/v1/providers/unknown/reset", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+// stubProvider is a weather.Provider returning a fixed reading or error.
+type stubProvider struct {
+	name    string
+	reading weather.ProviderReading
+	err     error
+}
+
+func (p stubProvider) Name() string { return p.name }
+
+func (p stubProvider) Fetch(ctx context.Context, loc weather.Location) (weather.ProviderReading, error) {
+	return p.reading, p.err
+}
+
+// TestCurrentReportsProviderErrors verifies that the current endpoint lists
+// the providers that failed in the latest fetch alongside the snapshot.
+func TestCurrentReportsProviderErrors(t *testing.T) {
+	app := fiber.New()
+
+	loc := weather.Location{City: "Paris", Country: "FR"}.Normalize()
+	provs := []weather.Provider{
+		stubProvider{name: "good", reading: weather.ProviderReading{ProviderName: "good", TemperatureC: weather.Float64(20)}},
+		stubProvider{name: "bad", err: &weather.ProviderError{
+			Provider: "bad", Operation: weather.OperationCurrent, StatusCode: 503, Retryable: true, Message: "server error",
+		}},
+	}
+	svc := weather.NewService(store.NewMemoryStore(10, time.Hour), provs)
+	if err := svc.FetchAndStore(context.Background(), loc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	RegisterRoutes(app, svc)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/weather/current?city=Paris&country=FR", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	var body struct {
+		Temperature    *float64                 `json:"temperatureC"`
+		ProviderErrors []*weather.ProviderError `json:"providerErrors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body.Temperature == nil || *body.Temperature != 20 {
+		t.Fatalf("unexpected temperature: %v", body.Temperature)
+	}
+	if len(body.ProviderErrors) != 1 || body.ProviderErrors[0].Provider != "bad" || body.ProviderErrors[0].StatusCode != 503 {
+		t.Fatalf("unexpected provider errors: %+v", body.ProviderErrors)
+	}
+}
+
+// stubForecastProvider is a weather.ForecastProvider counting its forecast calls.
+type stubForecastProvider struct {
+	stubProvider
+	calls *int
+}
+
+func (p stubForecastProvider) FetchForecast(ctx context.Context, loc weather.Location, days int) ([]weather.DailyReading, error) {
+	*p.calls++
+	return []weather.DailyReading{{ProviderName: p.name, Date: time.Now().UTC(), TempMaxC: weather.Float64(20)}}, nil
+}
+
+// TestForecastCacheHeader verifies that repeated forecast requests are served
+// from the forecast cache and report it in the X-Cache header.
+func TestForecastCacheHeader(t *testing.T) {
+	app := fiber.New()
+
+	calls := 0
+	provs := []weather.Provider{stubForecastProvider{stubProvider: stubProvider{name: "stub"}, calls: &calls}}
+	svc := weather.NewService(store.NewMemoryStore(10, time.Hour), provs,
+		weather.WithForecastCache(weather.ForecastCacheConfig{TTL: time.Minute}))
+	RegisterRoutes(app, svc)
+
+	for _, want := range []string{"MISS", "HIT"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/weather/forecast?city=Paris&country=FR&days=1", nil)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		if got := resp.Header.Get("X-Cache"); got != want {
+			t.Fatalf("expected X-Cache %q, got %q", want, got)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 provider call, got %d", calls)
+	}
+}
+
+// blockingForecastProvider is a weather.ForecastProvider whose forecast call
+// blocks until its context is done.
+type blockingForecastProvider struct {
+	stubProvider
+}
+
+func (p blockingForecastProvider) FetchForecast(ctx context.Context, loc weather.Location, days int) ([]weather.DailyReading, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// TestForecastHonorsRequestContext verifies that canceling the request
+// context aborts upstream forecast calls instead of waiting for them.
+func TestForecastHonorsRequestContext(t *testing.T) {
+	base, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	app := fiber.New()
+	app.Use(RequestContext(base))
+
+	provs := []weather.Provider{blockingForecastProvider{stubProvider{name: "slow"}}}
+	RegisterRoutes(app, weather.NewService(store.NewMemoryStore(10, time.Hour), provs))
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/weather/forecast?city=Paris&country=FR&days=1", nil)
+	resp, err := app.Test(req, 2000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected status %d, got %d", http.StatusBadGateway, resp.StatusCode)
+	}
+}
+
+// signalingForecastProvider is a weather.ForecastProvider whose forecast call
+// blocks until its context is done, then reports that on canceled.
+type signalingForecastProvider struct {
+	stubProvider
+	canceled chan<- error
+}
+
+func (p signalingForecastProvider) FetchForecast(ctx context.Context, loc weather.Location, days int) ([]weather.DailyReading, error) {
+	<-ctx.Done()
+	p.canceled <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+// TestClientDisconnectCancelsRequest verifies that a client closing its
+// connection cancels the request context, and that watching the connection
+// leaves keep-alive requests on it working.
+func TestClientDisconnectCancelsRequest(t *testing.T) {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(RequestContext(context.Background()))
+	canceled := make(chan error, 1)
+	provs := []weather.Provider{signalingForecastProvider{stubProvider{name: "slow"}, canceled}}
+	RegisterRoutes(app, weather.NewService(store.NewMemoryStore(10, time.Hour), provs))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		fmt.Fprint(conn, "GET /api/v1/weather/current?city=Paris&country=FR HTTP/1.1\r\nHost: test\r\n\r\n")
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("request %d: expected status %d, got %d", i, http.StatusNotFound, resp.StatusCode)
+		}
+	}
+
+	fmt.Fprint(conn, "GET /api/v1/weather/forecast?city=Paris&country=FR&days=1 HTTP/1.1\r\nHost: test\r\n\r\n")
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+	select {
+	case err := <-canceled:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the request to be canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected the disconnect to cancel the forecast call")
+	}
+}
+
+// countingProvider is a weather.Provider that counts its calls and delays
+// each one, so that concurrent requests overlap.
+type countingProvider struct {
+	stubProvider
+	delay time.Duration
+	calls *atomic.Int32
+}
+
+func (p countingProvider) Fetch(ctx context.Context, loc weather.Location) (weather.ProviderReading, error) {
+	p.calls.Add(1)
+	time.Sleep(p.delay)
+	return p.stubProvider.Fetch(ctx, loc)
+}
+
+// TestCurrentFetchesOnDemand verifies that with on-demand fetching enabled,
+// concurrent requests for an untracked location share one provider fetch,
+// and the location is enrolled for scheduling.
+func TestCurrentFetchesOnDemand(t *testing.T) {
+	app := fiber.New()
+
+	var calls atomic.Int32
+	provs := []weather.Provider{countingProvider{
+		stubProvider: stubProvider{name: "stub", reading: weather.ProviderReading{ProviderName: "stub", TemperatureC: weather.Float64(18)}},
+		delay:        50 * time.Millisecond,
+		calls:        &calls,
+	}}
+	enrolled := store.NewOnDemandLocations(time.Hour)
+	svc := weather.NewService(store.NewMemoryStore(10, time.Hour), provs,
+		weather.WithOnDemandFetch(weather.OnDemandConfig{Timeout: time.Second, Tracker: enrolled}))
+	RegisterRoutes(app, svc)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/weather/current?city=Oslo&country=NO", nil))
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected 1 provider fetch, got %d", n)
+	}
+	if locs := enrolled.List(); len(locs) != 1 || locs[0].Key() != "oslo:no" {
+		t.Fatalf("expected oslo:no to be enrolled, got %v", locs)
+	}
+}
+
+// TestSchedulerRoutes verifies pausing the scheduler, triggering a manual run
+// and reading its outcome back from the jobs endpoint.
+func TestSchedulerRoutes(t *testing.T) {
+	app := fiber.New()
+
+	paris := weather.Location{City: "Paris", Country: "FR"}
+	registry, err := store.NewLocationRegistry("", []store.TrackedLocation{{Location: paris}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	provs := []weather.Provider{
+		stubProvider{name: "stub", reading: weather.ProviderReading{ProviderName: "stub", TemperatureC: weather.Float64(15)}},
+	}
+	svc := weather.NewService(store.NewMemoryStore(10, time.Hour), provs)
+	sched := scheduler.New(registry, svc, scheduler.Config{Interval: time.Hour})
+	defer sched.Stop()
+	RegisterSchedulerRoutes(app, noAuth, sched)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/api/v1/scheduler/pause", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !sched.Paused() {
+		t.Fatalf("expected the scheduler to be paused, got status %d", resp.StatusCode)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodPost, "/api/v1/scheduler/run?location=oslo:no", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodPost, "/api/v1/scheduler/run?location=Paris:FR", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, resp.StatusCode)
+	}
+
+	var body struct {
+		Paused bool            `json:"paused"`
+		Runs   []scheduler.Run `json:"runs"`
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(body.Runs) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/scheduler/jobs", nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if !body.Paused {
+		t.Fatalf("expected the jobs endpoint to report the scheduler paused")
+	}
+	if len(body.Runs) != 1 || body.Runs[0].Location != "paris:fr" || body.Runs[0].Outcome != scheduler.OutcomeSuccess {
+		t.Fatalf("unexpected runs: %+v", body.Runs)
+	}
+}
+
+// TestFaultRoutes verifies setting, reading and clearing a provider's fault
+// rules, and that injected faults reach the service's fetches.
+func TestFaultRoutes(t *testing.T) {
+	app := fiber.New()
+
+	faults := providers.NewFaultInjector()
+	provs := faults.Wrap([]weather.Provider{
+		stubProvider{name: "stub", reading: weather.ProviderReading{ProviderName: "stub", TemperatureC: weather.Float64(15)}},
+	})
+	svc := weather.NewService(store.NewMemoryStore(10, time.Hour), provs)
+	RegisterFaultRoutes(app, noAuth, faults, svc)
+
+	put := func(path, body string) *http.Response {
+		req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp
+	}
+
+	if resp := put("/api/v1/providers/unknown/faults", `{"rules": []}`); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+	if resp := put("/api/v1/providers/stub/faults", `{"rules": [{"kind": "latency", "latency": "soon"}]}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	resp := put("/api/v1/providers/stub/faults", `{"rules": [{"kind": "outlier", "offset": 30, "every": "1m", "for": "30s"}]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	var body struct {
+		Rules []faultRuleBody `json:"rules"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(body.Rules) != 1 || *body.Rules[0].Probability != 1 || body.Rules[0].Every != "1m0s" {
+		t.Fatalf("unexpected rules: %+v", body.Rules)
+	}
+
+	// The rules must outlive the request that set them.
+	put("/api/v1/providers/unknown/faults", `{"rules": []}`)
+	if _, ok := faults.AllRules()["stub"]; !ok {
+		t.Fatalf("expected rules for stub, got %+v", faults.AllRules())
+	}
+
+	oslo := weather.Location{City: "Oslo", Country: "NO"}
+	if err := svc.FetchAndStore(context.Background(), oslo); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	snap, err := svc.GetLatest(context.Background(), oslo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snap.Temperature == nil || *snap.Temperature != 45 {
+		t.Fatalf("expected the outlier temperature, got %+v", snap.Temperature)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodDelete, "/api/v1/faults", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusNoContent || len(faults.AllRules()) != 0 {
+		t.Fatalf("expected the rules to be cleared, got status %d and %+v", resp.StatusCode, faults.AllRules())
+	}
+}
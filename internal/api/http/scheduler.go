@@ -0,0 +1,51 @@
+package httpapi
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/i474232898/weather-data-aggregation/internal/scheduler"
+)
+
+// RegisterSchedulerRoutes wires the scheduler admin handlers: triggering
+// runs, pausing and resuming (behind admin, see AdminAuth), and the job
+// status and run log.
+func RegisterSchedulerRoutes(app *fiber.App, admin fiber.Handler, sched *scheduler.Scheduler) {
+	v1 := app.Group("/api/v1/scheduler")
+
+	v1.Get("/jobs", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"paused": sched.Paused(),
+			"jobs":   sched.Jobs(),
+			"runs":   sched.Runs(),
+		})
+	})
+
+	v1.Post("/run", admin, func(c *fiber.Ctx) error {
+		key := strings.ToLower(strings.TrimSpace(c.Query("location")))
+
+		keys, err := sched.RunNow(key)
+		if errors.Is(err, scheduler.ErrNotScheduled) {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		if keys == nil {
+			keys = []string{}
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"started": keys,
+		})
+	})
+
+	v1.Post("/pause", admin, func(c *fiber.Ctx) error {
+		sched.Pause()
+		return c.JSON(fiber.Map{"paused": sched.Paused()})
+	})
+
+	v1.Post("/resume", admin, func(c *fiber.Ctx) error {
+		sched.Resume()
+		return c.JSON(fiber.Map{"paused": sched.Paused()})
+	})
+}
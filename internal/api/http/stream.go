@@ -0,0 +1,157 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+const (
+	// streamHeartbeatInterval keeps idle connections (and proxies) alive.
+	streamHeartbeatInterval = 15 * time.Second
+	// streamWriteTimeout bounds each write of a stream. The server's
+	// WriteTimeout covers the whole response, which a stream outlives, so
+	// every write (at least each heartbeat) sets a fresh deadline instead.
+	streamWriteTimeout = 10 * time.Second
+	// streamRetry is the reconnection delay suggested to EventSource clients.
+	streamRetry = 5 * time.Second
+)
+
+// parseStreamLocations reads either a `locations` list ("City:CC,City:CC")
+// or a single location in the usual city/country or lat/lon form.
+func parseStreamLocations(c *fiber.Ctx) ([]weather.Location, error) {
+	list := c.Query("locations")
+	if list == "" {
+		q, err := parseLocationQuery(c)
+		if err != nil {
+			return nil, err
+		}
+		return []weather.Location{q.toLocation()}, nil
+	}
+
+	var locs []weather.Location
+	for _, item := range strings.Split(list, ",") {
+		city, country, ok := strings.Cut(item, ":")
+		q := locationQuery{City: strings.TrimSpace(city), Country: strings.TrimSpace(country)}
+		if !ok || validate.Struct(q) != nil {
+			return nil, fmt.Errorf("invalid location %q in locations; expected City:CountryCode", item)
+		}
+		locs = append(locs, q.toLocation())
+	}
+	return locs, nil
+}
+
+// parseLastEventID returns the resume point sent by a reconnecting client.
+// Event IDs are the hub's event sequence numbers.
+func parseLastEventID(c *fiber.Ctx) (uint64, bool, error) {
+	id := c.Get("Last-Event-ID")
+	if id == "" {
+		id = c.Query("lastEventId")
+	}
+	if id == "" {
+		return 0, false, nil
+	}
+
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, false, errors.New("invalid Last-Event-ID")
+	}
+	return seq, true, nil
+}
+
+// streamSnapshots serves a Server-Sent Events stream of snapshots saved for
+// locs. If the client resumes with a Last-Event-ID, the recent events it
+// missed are replayed before live events.
+func streamSnapshots(c *fiber.Ctx, service *weather.Service, locs []weather.Location) error {
+	after, resume, err := parseLastEventID(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	var (
+		sub    *weather.Subscription
+		replay []weather.SnapshotEvent
+	)
+	if resume {
+		sub, replay = service.SubscribeAfter(after, locs...)
+	} else {
+		sub = service.Subscribe(locs...)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	conn := c.Context().Conn()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+
+		flush := func() error {
+			_ = conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			return w.Flush()
+		}
+
+		// Sequence number of the last event sent, to never send an event
+		// twice or out of order.
+		var lastSent uint64
+
+		send := func(ev weather.SnapshotEvent) error {
+			if ev.Seq <= lastSent {
+				return nil
+			}
+			data, err := json.Marshal(ev.Snapshot)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "id: %d\nevent: snapshot\ndata: %s\n\n", ev.Seq, data)
+			if err := flush(); err != nil {
+				return err
+			}
+			lastSent = ev.Seq
+			return nil
+		}
+
+		fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+		if err := flush(); err != nil {
+			return
+		}
+
+		for _, ev := range replay {
+			if err := send(ev); err != nil {
+				return
+			}
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case ev, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if err := send(ev); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				// A failed write means the client went away.
+				fmt.Fprint(w, ": heartbeat\n\n")
+				if err := flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
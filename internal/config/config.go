@@ -2,103 +2,572 @@ package config
 
 import (
 	"fmt"
-	"github.com/joho/godotenv"
 	"log"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/joho/godotenv"
+
+	"github.com/i474232898/weather-data-aggregation/internal/scheduler"
+	"github.com/i474232898/weather-data-aggregation/internal/store"
 	"github.com/i474232898/weather-data-aggregation/internal/weather"
+	"github.com/i474232898/weather-data-aggregation/internal/weather/providers"
+)
+
+// Supported values for AppConfig.StoreBackend.
+const (
+	StoreBackendMemory = "memory"
+	StoreBackendFile   = "file"
 )
 
 type AppConfig struct {
-	OpenWeatherAPIKey string
-	WeatherAPIKey     string
+	// File is the config file the configuration was loaded from, if any.
+	File string
+	// ConfigWatchInterval is how often File is checked for changes
+	// (0 = only reload on SIGHUP).
+	ConfigWatchInterval time.Duration
+
+	// Provider configuration blocks by name, for every provider of
+	// providers.DefaultRegistry that isn't disabled in the config file.
+	Providers map[string]providers.Config
 
-	// FetchInterval controls how often we fetch data for each location.
+	// FetchInterval controls how often we fetch data for each location
+	// without a schedule of its own.
 	FetchInterval time.Duration
+	// FetchJitter randomly delays each scheduled fetch by up to this long.
+	FetchJitter time.Duration
+	// FetchMaxConcurrency caps concurrent location fetches (0 = unlimited).
+	FetchMaxConcurrency int
+	// FetchPacing spreads scheduled fetches out to stay within provider budgets.
+	FetchPacing bool
+	// SchedulerRunLogSize is the number of recent scheduler runs kept for
+	// GET /api/v1/scheduler/jobs.
+	SchedulerRunLogSize int
+	// Backfill is how far back location history is filled from providers
+	// with historical data (0 = disabled). It is capped at StoreMaxAge.
+	Backfill time.Duration
 
-	// Locations to track.
-	Locations []weather.Location
+	// Locations to track initially, with optional schedules; see
+	// store.LocationRegistry.
+	Locations []store.TrackedLocation
 
-	// In-memory store retention.
+	// StoreBackend selects the snapshot store: "memory" or "file".
+	StoreBackend string
+	// StoreDir is the directory used by the file store.
+	StoreDir string
+	// LocationsPath is the file the location registry is persisted to. If
+	// empty, it is locations.json in StoreDir with the file backend, and the
+	// registry is kept in memory with the memory backend.
+	LocationsPath string
+
+	// Store retention.
 	StoreMaxHistory int           // max number of snapshots per location (0 = unlimited)
 	StoreMaxAge     time.Duration // max age of snapshots (0 = unlimited)
 
+	// Aggregation strategy and its tuning (see weather.NewAggregator).
+	AggregationStrategy         string
+	AggregationWeights          map[string]float64
+	AggregationTrimFraction     float64
+	AggregationOutlierThreshold float64
+
+	// Forecast cache (see weather.WithForecastCache); a zero TTL disables it.
+	ForecastCacheTTL          time.Duration
+	ForecastCacheProviderTTLs map[string]time.Duration
+	ForecastCacheStale        time.Duration
+
+	// On-demand fetching of locations without a stored snapshot (see
+	// weather.WithOnDemandFetch). A zero OnDemandEnrollTTL disables enrollment;
+	// zero OnDemandMaxLocations and OnDemandRatePerMinute mean no limit.
+	OnDemandFetch         bool
+	OnDemandTimeout       time.Duration
+	OnDemandEnrollTTL     time.Duration
+	OnDemandFailureTTL    time.Duration
+	OnDemandMaxLocations  int
+	OnDemandRatePerMinute int
+
+	// FaultInjection wraps the providers in a providers.FaultInjector
+	// controlled through the admin API. For testing only.
+	FaultInjection bool
+
+	// GeocoderBaseURL is the Open-Meteo geocoding API root; empty means the
+	// public API.
+	GeocoderBaseURL string
+	// GeocodeCachePath is the on-disk cache for resolved location coordinates.
+	GeocodeCachePath string
+
 	Port string
+	// AdminToken authorizes the state-changing admin routes (see
+	// httpapi.AdminAuth); empty disables them.
+	AdminToken string
+}
+
+// ValidationError lists every problem found in the configuration, so that
+// they can all be fixed at once.
+type ValidationError struct {
+	Problems []string
 }
 
-// Load reads configuration from environment with sensible defaults.
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return "invalid configuration: " + e.Problems[0]
+	}
+	return fmt.Sprintf("invalid configuration (%d problems):\n  - %s", len(e.Problems), strings.Join(e.Problems, "\n  - "))
+}
+
+// Load reads the .env file, if any, and then the configuration (see LoadFile)
+// from the config file named by CONFIG_FILE.
 func Load() (*AppConfig, error) {
 	if err := godotenv.Load(); err != nil {
 		log.Printf("INFO: No .env file found or error loading it: %v", err)
 	}
-	cfg := &AppConfig{}
+	return LoadFile(os.Getenv("CONFIG_FILE"))
+}
 
-	cfg.OpenWeatherAPIKey = os.Getenv("OPENWEATHER_API_KEY")
-	cfg.WeatherAPIKey = os.Getenv("WEATHERAPI_API_KEY")
+// LoadFile reads the configuration in layers: defaults, then the YAML config
+// file at path (skipped if path is empty), then environment variables. Every
+// invalid setting is reported in a single *ValidationError; settings are
+// named by their environment variable if it failed to parse, and by their
+// config file path otherwise.
+func LoadFile(path string) (*AppConfig, error) {
+	fc := defaultFile()
 
-	// Scheduler interval: default 15 minutes.
-	intervalStr := getenvDefault("FETCH_INTERVAL", "15m")
-	interval, err := time.ParseDuration(intervalStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid FETCH_INTERVAL: %w", err)
+	var problems []string
+	if path != "" {
+		fileProblems, err := readFile(path, &fc)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, fileProblems...)
 	}
-	cfg.FetchInterval = interval
 
-	// Store retention.
-	cfg.StoreMaxHistory = getenvInt("STORE_MAX_HISTORY", 96) // roughly 24h at 15-minute intervals
+	cfg := fc.appConfig()
+	cfg.File = path
 
-	maxAgeStr := getenvDefault("STORE_MAX_AGE", "24h")
-	maxAge, err := time.ParseDuration(maxAgeStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid STORE_MAX_AGE: %w", err)
+	env := envReader{problems: problems}
+	env.apply(cfg)
+	problems = append(env.problems, validate(cfg)...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
 	}
-	cfg.StoreMaxAge = maxAge
-	cfg.Port = getenvDefault("PORT", "8080")
 
-	locs, err := loadPrimaryLocation()
-	if err != nil {
-		return nil, err
+	if cfg.StoreMaxAge > 0 && cfg.Backfill > cfg.StoreMaxAge {
+		log.Printf("INFO: backfill %v exceeds the store max age; backfilling %v", cfg.Backfill, cfg.StoreMaxAge)
+		cfg.Backfill = cfg.StoreMaxAge
 	}
-	cfg.Locations = locs
-
 	return cfg, nil
 }
 
-func loadPrimaryLocation() ([]weather.Location, error) {
-	city := os.Getenv("WEATHER_LOCATION_CITY")
-	country := os.Getenv("WEATHER_LOCATION_COUNTRY")
+// appConfig converts the file layout into an AppConfig.
+func (fc fileConfig) appConfig() *AppConfig {
+	cfg := &AppConfig{
+		ConfigWatchInterval: 10 * time.Second,
+		Providers:           make(map[string]providers.Config, len(fc.Providers)),
+
+		FetchInterval:       fc.Scheduler.Interval,
+		FetchJitter:         fc.Scheduler.Jitter,
+		FetchMaxConcurrency: fc.Scheduler.MaxConcurrency,
+		FetchPacing:         fc.Scheduler.Pacing,
+		SchedulerRunLogSize: fc.Scheduler.RunLogSize,
+		Backfill:            fc.Scheduler.Backfill,
+
+		StoreBackend:    fc.Store.Backend,
+		StoreDir:        fc.Store.Dir,
+		LocationsPath:   fc.Store.LocationsPath,
+		StoreMaxHistory: fc.Store.MaxHistory,
+		StoreMaxAge:     fc.Store.MaxAge,
+
+		AggregationStrategy:         fc.Aggregation.Strategy,
+		AggregationWeights:          make(map[string]float64),
+		AggregationTrimFraction:     fc.Aggregation.TrimFraction,
+		AggregationOutlierThreshold: fc.Aggregation.OutlierThreshold,
+
+		ForecastCacheTTL:          fc.ForecastCache.TTL,
+		ForecastCacheProviderTTLs: make(map[string]time.Duration),
+		ForecastCacheStale:        fc.ForecastCache.Stale,
+
+		OnDemandFetch:         fc.OnDemand.Enabled,
+		OnDemandTimeout:       fc.OnDemand.Timeout,
+		OnDemandEnrollTTL:     fc.OnDemand.EnrollTTL,
+		OnDemandFailureTTL:    fc.OnDemand.FailureTTL,
+		OnDemandMaxLocations:  fc.OnDemand.MaxLocations,
+		OnDemandRatePerMinute: fc.OnDemand.RatePerMinute,
+
+		FaultInjection: fc.FaultInjection.Enabled,
+
+		GeocoderBaseURL:  fc.Geocoder.BaseURL,
+		GeocodeCachePath: fc.Geocoder.CachePath,
+
+		Port:       fc.Server.Port,
+		AdminToken: fc.Server.AdminToken,
+	}
+
+	for name, pf := range fc.Providers {
+		if pf.Enabled != nil && !*pf.Enabled {
+			continue
+		}
+		cfg.Providers[name] = providers.Config{
+			APIKey:  pf.APIKey,
+			BaseURL: pf.BaseURL,
+			Timeout: pf.Timeout,
+			Quota: providers.QuotaConfig{
+				PerMinute: pf.RatePerMinute,
+				PerDay:    pf.QuotaPerDay,
+			},
+			Backoff: providers.BackoffConfig{
+				MaxRetries:      pf.Backoff.MaxRetries,
+				InitialInterval: pf.Backoff.InitialInterval,
+				MaxInterval:     pf.Backoff.MaxInterval,
+			},
+			Breaker: providers.BreakerConfig{
+				MaxRequests:         pf.Breaker.MaxRequests,
+				Interval:            pf.Breaker.Interval,
+				Timeout:             pf.Breaker.Timeout,
+				ConsecutiveFailures: pf.Breaker.ConsecutiveFailures,
+			},
+		}
+		if pf.Weight != nil {
+			cfg.AggregationWeights[name] = *pf.Weight
+		}
+		if pf.CacheTTL != nil {
+			cfg.ForecastCacheProviderTTLs[name] = *pf.CacheTTL
+		}
+	}
+
+	for _, lf := range fc.Locations {
+		cfg.Locations = append(cfg.Locations, store.TrackedLocation{
+			Location: weather.Location{City: lf.City, Country: lf.Country, Lat: lf.Lat, Lon: lf.Lon},
+			Schedule: strings.TrimSpace(lf.Schedule),
+		})
+	}
+	return cfg
+}
+
+// envReader applies environment variables over a configuration, collecting
+// the ones that fail to parse instead of falling back to defaults.
+type envReader struct {
+	problems []string
+}
+
+func (e *envReader) apply(cfg *AppConfig) {
+	e.duration("CONFIG_WATCH_INTERVAL", &cfg.ConfigWatchInterval)
+
+	// Provider settings.
+	for _, p := range []struct {
+		name, prefix, keyVar string
+	}{
+		{providers.OpenWeatherName, "OPENWEATHER", "OPENWEATHER_API_KEY"},
+		{providers.WeatherAPIName, "WEATHERAPI", "WEATHERAPI_API_KEY"},
+		{providers.OpenMeteoName, "OPENMETEO", ""},
+	} {
+		pc, ok := cfg.Providers[p.name]
+		if !ok {
+			continue // disabled in the config file
+		}
+		if p.keyVar != "" {
+			e.string(p.keyVar, &pc.APIKey)
+		}
+		e.string(p.prefix+"_BASE_URL", &pc.BaseURL)
+		e.int(p.prefix+"_RATE_PER_MINUTE", &pc.Quota.PerMinute)
+		e.int(p.prefix+"_QUOTA_PER_DAY", &pc.Quota.PerDay)
+		cfg.Providers[p.name] = pc
+	}
+
+	// Scheduler.
+	e.duration("FETCH_INTERVAL", &cfg.FetchInterval)
+	e.duration("FETCH_JITTER", &cfg.FetchJitter)
+	e.int("FETCH_MAX_CONCURRENCY", &cfg.FetchMaxConcurrency)
+	e.bool("FETCH_PACING", &cfg.FetchPacing)
+	e.int("SCHEDULER_RUN_LOG_SIZE", &cfg.SchedulerRunLogSize)
+	e.duration("BACKFILL", &cfg.Backfill)
+
+	// Store.
+	e.string("STORE_BACKEND", &cfg.StoreBackend)
+	e.string("STORE_DIR", &cfg.StoreDir)
+	e.string("LOCATIONS_PATH", &cfg.LocationsPath)
+	e.int("STORE_MAX_HISTORY", &cfg.StoreMaxHistory)
+	e.duration("STORE_MAX_AGE", &cfg.StoreMaxAge)
+
+	// Aggregation.
+	e.string("AGGREGATION_STRATEGY", &cfg.AggregationStrategy)
+	if v := os.Getenv("AGGREGATION_WEIGHTS"); v != "" {
+		weights, err := parseWeights(v)
+		if err != nil {
+			e.problem("AGGREGATION_WEIGHTS", err)
+		}
+		for name, w := range weights {
+			cfg.AggregationWeights[name] = w
+		}
+	}
+	e.float("AGGREGATION_TRIM_FRACTION", &cfg.AggregationTrimFraction)
+	e.float("AGGREGATION_OUTLIER_THRESHOLD", &cfg.AggregationOutlierThreshold)
+
+	// Forecast cache.
+	e.duration("FORECAST_CACHE_TTL", &cfg.ForecastCacheTTL)
+	if v := os.Getenv("FORECAST_CACHE_PROVIDER_TTLS"); v != "" {
+		ttls, err := parseDurations(v)
+		if err != nil {
+			e.problem("FORECAST_CACHE_PROVIDER_TTLS", err)
+		}
+		for name, ttl := range ttls {
+			cfg.ForecastCacheProviderTTLs[name] = ttl
+		}
+	}
+	e.duration("FORECAST_CACHE_STALE", &cfg.ForecastCacheStale)
+
+	// On-demand fetching.
+	e.bool("ON_DEMAND_FETCH", &cfg.OnDemandFetch)
+	e.duration("ON_DEMAND_TIMEOUT", &cfg.OnDemandTimeout)
+	e.duration("ON_DEMAND_ENROLL_TTL", &cfg.OnDemandEnrollTTL)
+	e.duration("ON_DEMAND_FAILURE_TTL", &cfg.OnDemandFailureTTL)
+	e.int("ON_DEMAND_MAX_LOCATIONS", &cfg.OnDemandMaxLocations)
+	e.int("ON_DEMAND_RATE_PER_MINUTE", &cfg.OnDemandRatePerMinute)
+
+	e.bool("FAULT_INJECTION", &cfg.FaultInjection)
+
+	e.string("GEOCODER_BASE_URL", &cfg.GeocoderBaseURL)
+	e.string("GEOCODE_CACHE_PATH", &cfg.GeocodeCachePath)
+	e.string("PORT", &cfg.Port)
+	e.string("ADMIN_TOKEN", &cfg.AdminToken)
+
+	locs, err := envLocations(os.Getenv("WEATHER_LOCATION_CITY"), os.Getenv("WEATHER_LOCATION_COUNTRY"))
+	switch {
+	case err != nil:
+		e.problem("WEATHER_LOCATION_CITY/WEATHER_LOCATION_COUNTRY", err)
+	case locs != nil:
+		cfg.Locations = locs
+	}
+}
+
+func (e *envReader) problem(key string, err error) {
+	e.problems = append(e.problems, fmt.Sprintf("%s: %v", key, err))
+}
+
+func (e *envReader) string(key string, dst *string) {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		*dst = v
+	}
+}
+
+func (e *envReader) int(key string, dst *int) {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			e.problem(key, fmt.Errorf("invalid integer %q", v))
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envReader) float(key string, dst *float64) {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			e.problem(key, fmt.Errorf("invalid number %q", v))
+			return
+		}
+		*dst = f
+	}
+}
+
+func (e *envReader) bool(key string, dst *bool) {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			e.problem(key, fmt.Errorf("invalid boolean %q", v))
+			return
+		}
+		*dst = b
+	}
+}
+
+func (e *envReader) duration(key string, dst *time.Duration) {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			e.problem(key, fmt.Errorf("invalid duration %q", v))
+			return
+		}
+		*dst = d
+	}
+}
+
+// envLocations parses comma-separated city and country lists into locations.
+// It returns nil if both lists are empty.
+func envLocations(city, country string) ([]store.TrackedLocation, error) {
+	if strings.TrimSpace(city) == "" && strings.TrimSpace(country) == "" {
+		// Locations can also be added at runtime via the API.
+		return nil, nil
+	}
 	cities := strings.Split(city, ",")
 	countries := strings.Split(country, ",")
 	if len(cities) != len(countries) {
 		return nil, fmt.Errorf("number of cities and countries must be the same")
 	}
-	var locs []weather.Location
+
+	var locs []store.TrackedLocation
 	for i := range cities {
-		locs = append(locs, weather.Location{
-			City:    cities[i],
-			Country: countries[i],
-		})
+		c, cc := strings.TrimSpace(cities[i]), strings.TrimSpace(countries[i])
+		if c == "" || cc == "" {
+			return nil, fmt.Errorf("entry %d has an empty city or country", i+1)
+		}
+		locs = append(locs, store.TrackedLocation{Location: weather.Location{City: c, Country: cc}})
 	}
-
 	return locs, nil
 }
 
-func getenvDefault(key, def string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+// validate returns every problem with cfg, naming settings by their config
+// file path.
+func validate(cfg *AppConfig) []string {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	registry := providers.DefaultRegistry()
+	known := registry.Has
+
+	port, err := strconv.Atoi(cfg.Port)
+	check(err == nil && port > 0 && port <= 65535, "server.port: invalid port %q", cfg.Port)
+
+	for name, pc := range cfg.Providers {
+		if !known(name) {
+			problems = append(problems, fmt.Sprintf("providers.%s: unknown provider; expected one of %s", name, strings.Join(registry.Names(), ", ")))
+			continue
+		}
+		prefix := "providers." + name
+		if pc.BaseURL != "" {
+			check(validURL(pc.BaseURL), "%s.base_url: %q is not an absolute http(s) URL", prefix, pc.BaseURL)
+		}
+		check(pc.Timeout > 0, "%s.timeout: must be positive, got %v", prefix, pc.Timeout)
+		check(pc.Quota.PerMinute >= 0, "%s.rate_per_minute: must not be negative, got %d", prefix, pc.Quota.PerMinute)
+		check(pc.Quota.PerDay >= 0, "%s.quota_per_day: must not be negative, got %d", prefix, pc.Quota.PerDay)
+		check(pc.Backoff.MaxRetries >= 0, "%s.backoff.max_retries: must not be negative, got %d", prefix, pc.Backoff.MaxRetries)
+		check(pc.Backoff.InitialInterval > 0, "%s.backoff.initial_interval: must be positive, got %v", prefix, pc.Backoff.InitialInterval)
+		check(pc.Backoff.MaxInterval >= pc.Backoff.InitialInterval, "%s.backoff.max_interval: must be at least initial_interval (%v), got %v", prefix, pc.Backoff.InitialInterval, pc.Backoff.MaxInterval)
+		check(pc.Breaker.MaxRequests > 0, "%s.breaker.max_requests: must be positive, got %d", prefix, pc.Breaker.MaxRequests)
+		check(pc.Breaker.Interval >= 0, "%s.breaker.interval: must not be negative, got %v", prefix, pc.Breaker.Interval)
+		check(pc.Breaker.Timeout > 0, "%s.breaker.timeout: must be positive, got %v", prefix, pc.Breaker.Timeout)
+	}
+
+	check(cfg.FetchInterval >= time.Second, "scheduler.interval: must be at least 1s, got %v", cfg.FetchInterval)
+	check(cfg.FetchJitter >= 0, "scheduler.jitter: must not be negative, got %v", cfg.FetchJitter)
+	check(cfg.FetchMaxConcurrency >= 0, "scheduler.max_concurrency: must not be negative, got %d", cfg.FetchMaxConcurrency)
+	check(cfg.SchedulerRunLogSize > 0, "scheduler.run_log_size: must be positive, got %d", cfg.SchedulerRunLogSize)
+	check(cfg.Backfill >= 0, "scheduler.backfill: must not be negative, got %v", cfg.Backfill)
+
+	seen := make(map[string]bool)
+	for i, tl := range cfg.Locations {
+		prefix := fmt.Sprintf("locations[%d]", i)
+		switch {
+		case tl.Lat != nil || tl.Lon != nil:
+			if !tl.HasCoordinates() {
+				problems = append(problems, prefix+": lat and lon must be set together")
+				continue
+			}
+			check(*tl.Lat >= -90 && *tl.Lat <= 90, "%s.lat: must be within [-90, 90], got %v", prefix, *tl.Lat)
+			check(*tl.Lon >= -180 && *tl.Lon <= 180, "%s.lon: must be within [-180, 180], got %v", prefix, *tl.Lon)
+		case strings.TrimSpace(tl.City) == "" || strings.TrimSpace(tl.Country) == "":
+			problems = append(problems, prefix+": needs a city and country, or lat and lon")
+			continue
+		}
+		if tl.Schedule != "" {
+			if _, err := scheduler.ParseSchedule(tl.Schedule); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.schedule: %v", prefix, err))
+			}
+		}
+		key := tl.Normalize().Key()
+		check(!seen[key], "%s: duplicate location %s", prefix, key)
+		seen[key] = true
+	}
+
+	check(cfg.StoreBackend == StoreBackendMemory || cfg.StoreBackend == StoreBackendFile,
+		"store.backend: must be %q or %q, got %q", StoreBackendMemory, StoreBackendFile, cfg.StoreBackend)
+	check(cfg.StoreBackend != StoreBackendFile || cfg.StoreDir != "", "store.dir: must be set for the file backend")
+	check(cfg.StoreMaxHistory >= 0, "store.max_history: must not be negative, got %d", cfg.StoreMaxHistory)
+	check(cfg.StoreMaxAge >= 0, "store.max_age: must not be negative, got %v", cfg.StoreMaxAge)
+
+	for name, w := range cfg.AggregationWeights {
+		check(known(name), "providers.%s.weight: unknown provider", name)
+		check(w >= 0, "providers.%s.weight: must not be negative, got %v", name, w)
+	}
+	if _, err := weather.NewAggregator(cfg.AggregationStrategy, weather.AggregatorOptions{
+		Weights:          cfg.AggregationWeights,
+		TrimFraction:     cfg.AggregationTrimFraction,
+		OutlierThreshold: cfg.AggregationOutlierThreshold,
+	}); err != nil {
+		problems = append(problems, fmt.Sprintf("aggregation: %v", err))
+	}
+
+	check(cfg.ForecastCacheTTL >= 0, "forecast_cache.ttl: must not be negative, got %v", cfg.ForecastCacheTTL)
+	check(cfg.ForecastCacheStale >= 0, "forecast_cache.stale: must not be negative, got %v", cfg.ForecastCacheStale)
+	for name, ttl := range cfg.ForecastCacheProviderTTLs {
+		check(known(name), "providers.%s.cache_ttl: unknown provider", name)
+		check(ttl >= 0, "providers.%s.cache_ttl: must not be negative, got %v", name, ttl)
+	}
+
+	check(cfg.OnDemandTimeout > 0, "on_demand.timeout: must be positive, got %v", cfg.OnDemandTimeout)
+	check(cfg.OnDemandEnrollTTL >= 0, "on_demand.enroll_ttl: must not be negative, got %v", cfg.OnDemandEnrollTTL)
+	check(cfg.OnDemandFailureTTL > 0, "on_demand.failure_ttl: must be positive, got %v", cfg.OnDemandFailureTTL)
+	check(cfg.OnDemandMaxLocations >= 0, "on_demand.max_locations: must not be negative, got %d", cfg.OnDemandMaxLocations)
+	check(cfg.OnDemandRatePerMinute >= 0, "on_demand.rate_per_minute: must not be negative, got %d", cfg.OnDemandRatePerMinute)
+
+	if cfg.GeocoderBaseURL != "" {
+		check(validURL(cfg.GeocoderBaseURL), "geocoder.base_url: %q is not an absolute http(s) URL", cfg.GeocoderBaseURL)
+	}
+	check(cfg.ConfigWatchInterval >= 0, "CONFIG_WATCH_INTERVAL: must not be negative, got %v", cfg.ConfigWatchInterval)
+
+	return problems
+}
+
+// validURL reports whether s is an absolute http or https URL.
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// parseWeights parses "provider=weight" pairs separated by commas,
+// e.g. "openweathermap=1,weatherapi=2".
+func parseWeights(s string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	if strings.TrimSpace(s) == "" {
+		return weights, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected provider=weight, got %q", pair)
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight for %q: %q", name, value)
+		}
+		weights[strings.TrimSpace(name)] = w
 	}
-	return def
+	return weights, nil
 }
 
-func getenvInt(key string, def int) int {
-	if v := os.Getenv(key); v != "" {
-		n, err := strconv.Atoi(v)
-		if err == nil {
-			return n
+// parseDurations parses "provider=duration" pairs separated by commas,
+// e.g. "openweathermap=30m,openmeteo=1h".
+func parseDurations(s string) (map[string]time.Duration, error) {
+	durations := make(map[string]time.Duration)
+	if strings.TrimSpace(s) == "" {
+		return durations, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected provider=duration, got %q", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid duration for %q: %q", name, value)
 		}
+		durations[strings.TrimSpace(name)] = d
 	}
-	return def
+	return durations, nil
 }
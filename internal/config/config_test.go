@@ -0,0 +1,168 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather/providers"
+)
+
+// writeConfig writes a config file into a temporary directory and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return path
+}
+
+// TestLoadFileLayersEnvOverFile verifies that the config file overrides the
+// defaults, keeping the defaults of settings it leaves out, and that
+// environment variables override the file.
+func TestLoadFileLayersEnvOverFile(t *testing.T) {
+	path := writeConfig(t, `
+scheduler:
+  interval: 5m
+  max_concurrency: 8
+providers:
+  openmeteo:
+    rate_per_minute: 30
+    weight: 2
+    backoff:
+      max_retries: 0
+  weatherapi:
+    enabled: false
+locations:
+  - city: Paris
+    country: fr
+    schedule: "*/10 * * * *"
+`)
+	t.Setenv("FETCH_INTERVAL", "2m")
+	t.Setenv("WEATHERAPI_API_KEY", "key")
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.FetchInterval != 2*time.Minute {
+		t.Fatalf("expected the environment to override the interval, got %v", cfg.FetchInterval)
+	}
+	if cfg.FetchMaxConcurrency != 8 || cfg.FetchJitter != 10*time.Second {
+		t.Fatalf("expected file and default scheduler settings, got %+v", cfg)
+	}
+
+	om := cfg.Providers[providers.OpenMeteoName]
+	if om.Quota.PerMinute != 30 || om.Backoff.MaxRetries != 0 || om.Backoff.InitialInterval != 500*time.Millisecond || om.Timeout != 10*time.Second {
+		t.Fatalf("expected the openmeteo block over the provider defaults, got %+v", om)
+	}
+	if cfg.AggregationWeights[providers.OpenMeteoName] != 2 {
+		t.Fatalf("expected openmeteo weight 2, got %v", cfg.AggregationWeights)
+	}
+	if ow := cfg.Providers[providers.OpenWeatherName]; ow.Backoff.MaxRetries != 3 {
+		t.Fatalf("expected default backoff for openweathermap, got %+v", ow.Backoff)
+	}
+	if _, ok := cfg.Providers[providers.WeatherAPIName]; ok {
+		t.Fatalf("expected weatherapi to stay disabled despite its API key, got %+v", cfg.Providers)
+	}
+
+	if len(cfg.Locations) != 1 || cfg.Locations[0].City != "Paris" || cfg.Locations[0].Schedule != "*/10 * * * *" {
+		t.Fatalf("unexpected locations: %+v", cfg.Locations)
+	}
+}
+
+// TestLoadFileReportsAllProblems verifies that unknown fields, invalid values
+// and unparsable environment variables are reported together instead of
+// failing on the first one or falling back to defaults.
+func TestLoadFileReportsAllProblems(t *testing.T) {
+	path := writeConfig(t, `
+scheduler:
+  interval: 100ms
+  intervall: 5m
+providers:
+  darksky:
+    api_key: x
+  weatherapi:
+    base_url: not-a-url
+    backoff:
+      initial_interval: 2s
+      max_interval: 1s
+locations:
+  - city: Paris
+    schedule: every now and then
+`)
+	t.Setenv("STORE_MAX_HISTORY", "lots")
+
+	_, err := LoadFile(path)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a *ValidationError, got %v", err)
+	}
+
+	for _, want := range []string{
+		"field intervall not found",
+		"STORE_MAX_HISTORY",
+		"scheduler.interval",
+		"providers.darksky",
+		"providers.weatherapi.base_url",
+		"providers.weatherapi.backoff.max_interval",
+		"locations[0]",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %q, got:\n%v", want, err)
+		}
+	}
+}
+
+// TestEnvLocationsRejectsEmptyEntries verifies that empty city or country
+// entries, e.g. from a trailing comma, are rejected.
+func TestEnvLocationsRejectsEmptyEntries(t *testing.T) {
+	if _, err := envLocations("Kyiv,", "UA,"); err == nil {
+		t.Fatal("expected an error for an empty entry")
+	}
+	if _, err := envLocations("Kyiv,Bangkok", "UA"); err == nil {
+		t.Fatal("expected an error for mismatched lists")
+	}
+
+	locs, err := envLocations(" Kyiv , Bangkok", "UA, TH")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(locs) != 2 || locs[1].City != "Bangkok" || locs[1].Country != "TH" {
+		t.Fatalf("unexpected locations: %+v", locs)
+	}
+}
+
+// TestWatchReportsChanges verifies that Watch calls back once the file is
+// rewritten.
+func TestWatchReportsChanges(t *testing.T) {
+	path := writeConfig(t, "server:\n  port: \"8080\"\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+	go Watch(ctx, path, 10*time.Millisecond, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	time.Sleep(30 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("server:\n  port: \"9090\"\n"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a change to be reported")
+	}
+}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+	"github.com/i474232898/weather-data-aggregation/internal/weather/providers"
+)
+
+// fileConfig is the layout of the YAML config file. Durations are Go
+// duration strings such as "90s" or "15m".
+type fileConfig struct {
+	Server serverFile `yaml:"server"`
+	// Providers by name: openweathermap, weatherapi or openmeteo.
+	Providers map[string]providerFile `yaml:"providers"`
+	// Locations seed the location registry on first run.
+	Locations      []locationFile     `yaml:"locations"`
+	Store          storeFile          `yaml:"store"`
+	Scheduler      schedulerFile      `yaml:"scheduler"`
+	Aggregation    aggregationFile    `yaml:"aggregation"`
+	ForecastCache  forecastCacheFile  `yaml:"forecast_cache"`
+	OnDemand       onDemandFile       `yaml:"on_demand"`
+	FaultInjection faultInjectionFile `yaml:"fault_injection"`
+	Geocoder       geocoderFile       `yaml:"geocoder"`
+}
+
+type serverFile struct {
+	Port       string `yaml:"port"`
+	AdminToken string `yaml:"admin_token"`
+}
+
+// providerFile is the config file block of one provider.
+type providerFile struct {
+	// Enabled turns the provider off when false; unset means enabled.
+	Enabled       *bool         `yaml:"enabled"`
+	APIKey        string        `yaml:"api_key"`
+	BaseURL       string        `yaml:"base_url"`
+	Timeout       time.Duration `yaml:"timeout"`
+	RatePerMinute int           `yaml:"rate_per_minute"`
+	QuotaPerDay   int           `yaml:"quota_per_day"`
+	// Weight is the provider's aggregation weight; unset means 1.
+	Weight *float64 `yaml:"weight"`
+	// CacheTTL overrides forecast_cache.ttl for the provider.
+	CacheTTL *time.Duration `yaml:"cache_ttl"`
+	Backoff  backoffFile    `yaml:"backoff"`
+	Breaker  breakerFile    `yaml:"breaker"`
+}
+
+type backoffFile struct {
+	MaxRetries      int           `yaml:"max_retries"`
+	InitialInterval time.Duration `yaml:"initial_interval"`
+	MaxInterval     time.Duration `yaml:"max_interval"`
+}
+
+type breakerFile struct {
+	MaxRequests         uint32        `yaml:"max_requests"`
+	Interval            time.Duration `yaml:"interval"`
+	Timeout             time.Duration `yaml:"timeout"`
+	ConsecutiveFailures uint32        `yaml:"consecutive_failures"`
+}
+
+type storeFile struct {
+	Backend       string        `yaml:"backend"`
+	Dir           string        `yaml:"dir"`
+	LocationsPath string        `yaml:"locations_path"`
+	MaxHistory    int           `yaml:"max_history"`
+	MaxAge        time.Duration `yaml:"max_age"`
+}
+
+type schedulerFile struct {
+	Interval       time.Duration `yaml:"interval"`
+	Jitter         time.Duration `yaml:"jitter"`
+	MaxConcurrency int           `yaml:"max_concurrency"`
+	Pacing         bool          `yaml:"pacing"`
+	RunLogSize     int           `yaml:"run_log_size"`
+	Backfill       time.Duration `yaml:"backfill"`
+}
+
+type aggregationFile struct {
+	Strategy         string  `yaml:"strategy"`
+	TrimFraction     float64 `yaml:"trim_fraction"`
+	OutlierThreshold float64 `yaml:"outlier_threshold"`
+}
+
+type forecastCacheFile struct {
+	TTL   time.Duration `yaml:"ttl"`
+	Stale time.Duration `yaml:"stale"`
+}
+
+type onDemandFile struct {
+	Enabled       bool          `yaml:"enabled"`
+	Timeout       time.Duration `yaml:"timeout"`
+	EnrollTTL     time.Duration `yaml:"enroll_ttl"`
+	FailureTTL    time.Duration `yaml:"failure_ttl"`
+	MaxLocations  int           `yaml:"max_locations"`
+	RatePerMinute int           `yaml:"rate_per_minute"`
+}
+
+type faultInjectionFile struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type geocoderFile struct {
+	BaseURL   string `yaml:"base_url"`
+	CachePath string `yaml:"cache_path"`
+}
+
+// locationFile is a location in the config file, given either by city and
+// country or by coordinates.
+type locationFile struct {
+	City     string   `yaml:"city"`
+	Country  string   `yaml:"country"`
+	Lat      *float64 `yaml:"lat"`
+	Lon      *float64 `yaml:"lon"`
+	Schedule string   `yaml:"schedule"`
+}
+
+// defaultFile returns the configuration used for settings that neither the
+// config file nor the environment set.
+func defaultFile() fileConfig {
+	var fc fileConfig
+	fc.Server.Port = "8080"
+
+	fc.Providers = make(map[string]providerFile)
+	for _, name := range providers.DefaultRegistry().Names() {
+		fc.Providers[name] = defaultProvider()
+	}
+
+	fc.Store.Backend = StoreBackendMemory
+	fc.Store.Dir = "data/store"
+	fc.Store.MaxHistory = 96 // roughly 24h at 15-minute intervals
+	fc.Store.MaxAge = 24 * time.Hour
+
+	fc.Scheduler.Interval = 15 * time.Minute
+	fc.Scheduler.Jitter = 10 * time.Second
+	fc.Scheduler.MaxConcurrency = 4
+	fc.Scheduler.Pacing = true
+	fc.Scheduler.RunLogSize = 200
+
+	fc.Aggregation.Strategy = weather.StrategyMean
+	fc.Aggregation.TrimFraction = 0.2
+	fc.Aggregation.OutlierThreshold = 3.5
+
+	fc.ForecastCache.TTL = 10 * time.Minute
+	fc.ForecastCache.Stale = 30 * time.Minute
+
+	fc.OnDemand.Timeout = 10 * time.Second
+	fc.OnDemand.FailureTTL = time.Minute
+	fc.OnDemand.MaxLocations = 100
+	fc.OnDemand.RatePerMinute = 30
+
+	fc.Geocoder.CachePath = "data/geocode-cache.json"
+	return fc
+}
+
+// defaultProvider returns the settings of a provider block before the config
+// file is applied.
+func defaultProvider() providerFile {
+	var pf providerFile
+	pf.Timeout = providers.DefaultTimeout
+	pf.Backoff.MaxRetries = providers.DefaultBackoff.MaxRetries
+	pf.Backoff.InitialInterval = providers.DefaultBackoff.InitialInterval
+	pf.Backoff.MaxInterval = providers.DefaultBackoff.MaxInterval
+	pf.Breaker.MaxRequests = providers.DefaultBreaker.MaxRequests
+	pf.Breaker.Interval = providers.DefaultBreaker.Interval
+	pf.Breaker.Timeout = providers.DefaultBreaker.Timeout
+	pf.Breaker.ConsecutiveFailures = providers.DefaultBreaker.ConsecutiveFailures
+	return pf
+}
+
+// readFile applies the YAML file at path over fc. Unknown fields and values
+// of the wrong type are returned as problems rather than an error, so they
+// are reported together with the rest of the validation.
+func readFile(path string, fc *fileConfig) (problems []string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(fc)
+	var typeErr *yaml.TypeError
+	switch {
+	case errors.As(err, &typeErr):
+		for _, msg := range typeErr.Errors {
+			problems = append(problems, path+": "+msg)
+		}
+	case err != nil && !errors.Is(err, io.EOF):
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	// Decoding into a map replaces its entries, so decode the provider blocks
+	// again over the provider defaults. Unknown fields were rejected above.
+	var raw struct {
+		Providers map[string]yaml.Node `yaml:"providers"`
+	}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return problems, nil
+	}
+	for name, node := range raw.Providers {
+		pf := defaultProvider()
+		if err := node.Decode(&pf); err == nil {
+			fc.Providers[name] = pf
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Watch calls onChange whenever the modification time or size of the file at
+// path changes, checking every interval until ctx is done. Polling rather than
+// file system notifications also catches editors and config management tools
+// that replace the file instead of writing it in place. A file that is
+// temporarily missing is not reported as a change.
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	last, _ := os.Stat(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+			last = info
+			onChange()
+		}
+	}
+}
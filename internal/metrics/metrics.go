@@ -0,0 +1,114 @@
+// Package metrics defines the Prometheus metrics exported on /metrics.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// ProviderRequestDuration is the latency of a provider call, including retries.
+	ProviderRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "weather_provider_request_duration_seconds",
+		Help:    "Latency of provider calls, including retries and backoff.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"provider", "operation"})
+
+	// ProviderRequests counts provider calls by result ("success" or an error class).
+	ProviderRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "weather_provider_requests_total",
+		Help: "Provider calls by result: success, rate_limited, server_error, circuit_open, quota_exceeded, unexpected_status, canceled or error.",
+	}, []string{"provider", "operation", "result"})
+
+	// ProviderRetries counts retry attempts made after a failed provider call.
+	ProviderRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "weather_provider_retries_total",
+		Help: "Retry attempts made after failed provider requests.",
+	}, []string{"provider", "operation"})
+
+	// CircuitBreakerState is the breaker state as of the last provider call.
+	CircuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "weather_provider_circuit_breaker_state",
+		Help: "Circuit breaker state per provider: 0 = closed, 1 = half-open, 2 = open.",
+	}, []string{"provider"})
+
+	// ProviderInjectedFaults counts faults injected into provider calls for
+	// resilience testing.
+	ProviderInjectedFaults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "weather_provider_injected_faults_total",
+		Help: "Faults injected into provider calls by kind: latency, error, stale or outlier.",
+	}, []string{"provider", "operation", "kind"})
+
+	// SchedulerJobDuration is the time taken by one scheduled location fetch.
+	SchedulerJobDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "weather_scheduler_job_duration_seconds",
+		Help:    "Duration of scheduled location fetches, excluding jitter and pacing delays.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+	})
+
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// Middleware records request counts and latency for every Fiber route. Routes
+// are labelled by their pattern (e.g. /api/v1/locations/:id), not the raw path.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if e, ok := err.(*fiber.Error); ok {
+			// The error handler has not written the response yet.
+			status = e.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+
+		route := c.Route().Path
+		method := c.Method()
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+		httpRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// RegisterSnapshotAge exports weather_snapshot_age_seconds per location,
+// computed at scrape time from latest, which returns the timestamp of the
+// newest snapshot for each tracked location key.
+func RegisterSnapshotAge(latest func() map[string]time.Time) {
+	prometheus.MustRegister(&snapshotAgeCollector{latest: latest})
+}
+
+var snapshotAgeDesc = prometheus.NewDesc(
+	"weather_snapshot_age_seconds",
+	"Age of the newest stored snapshot per tracked location.",
+	[]string{"location"}, nil,
+)
+
+type snapshotAgeCollector struct {
+	latest func() map[string]time.Time
+}
+
+func (c *snapshotAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- snapshotAgeDesc
+}
+
+func (c *snapshotAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	for key, ts := range c.latest() {
+		ch <- prometheus.MustNewConstMetric(snapshotAgeDesc, prometheus.GaugeValue, now.Sub(ts).Seconds(), key)
+	}
+}
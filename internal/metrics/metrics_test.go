@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// TestMiddlewareLabelsRoutePattern verifies that requests are labelled by route
+// pattern rather than raw path, and with the status from a returned fiber.Error.
+func TestMiddlewareLabelsRoutePattern(t *testing.T) {
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Get("/items/:id", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusNotFound, "no such item")
+	})
+
+	for _, path := range []string{"/items/1", "/items/2"} {
+		if _, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	var m dto.Metric
+	if err := httpRequests.WithLabelValues(http.MethodGet, "/items/:id", "404").Write(&m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := m.GetCounter().GetValue(); got != 2 {
+		t.Fatalf("expected 2 requests for /items/:id, got %v", got)
+	}
+}
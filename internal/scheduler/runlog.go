@@ -0,0 +1,122 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// defaultRunLogSize is the number of runs kept when Config.RunLogSize is zero.
+const defaultRunLogSize = 200
+
+// Trigger is what started a run.
+type Trigger string
+
+const (
+	TriggerSchedule Trigger = "schedule" // the location's schedule
+	TriggerManual   Trigger = "manual"   // RunNow, e.g. from the admin API
+	TriggerAdded    Trigger = "added"    // Refresh after a location was added
+	TriggerWarmup   Trigger = "warmup"   // the warm-up at Start
+)
+
+// Outcome is the result of a run.
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success" // every provider returned data
+	OutcomePartial Outcome = "partial" // some providers failed; a snapshot was stored
+	OutcomeFailed  Outcome = "failed"  // no snapshot was stored
+	OutcomeSkipped Outcome = "skipped" // the previous run of the location was still in progress
+)
+
+// ProviderResult is whether one provider returned data in a run.
+type ProviderResult struct {
+	Provider string `json:"provider"`
+	OK       bool   `json:"ok"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Run records one fetch of a location by the scheduler.
+type Run struct {
+	Location  string    `json:"location"`
+	Trigger   Trigger   `json:"trigger"`
+	StartedAt time.Time `json:"startedAt"`
+	// DurationMs excludes jitter and waiting for pacing or a concurrency slot.
+	DurationMs int64   `json:"durationMs"`
+	Outcome    Outcome `json:"outcome"`
+	Error      string  `json:"error,omitempty"`
+	// Providers is empty for skipped runs.
+	Providers []ProviderResult `json:"providers,omitempty"`
+}
+
+// newRun builds the record of a finished fetch of loc from its error and the
+// provider failures the service remembered for it.
+func newRun(loc weather.Location, trigger Trigger, start time.Time, err error, provs []weather.Provider, failures []*weather.ProviderError) Run {
+	run := Run{
+		Location:   loc.Key(),
+		Trigger:    trigger,
+		StartedAt:  start.UTC(),
+		DurationMs: time.Since(start).Milliseconds(),
+		Outcome:    OutcomeSuccess,
+	}
+
+	// The log is served by the API, so errors are recorded by their messages
+	// with request URL queries, which can carry API keys, removed.
+	failed := make(map[string]string, len(failures))
+	for _, f := range failures {
+		failed[f.Provider] = weather.ErrorMessage(f)
+	}
+	for _, p := range provs {
+		msg, bad := failed[p.Name()]
+		run.Providers = append(run.Providers, ProviderResult{Provider: p.Name(), OK: !bad, Error: msg})
+	}
+
+	switch {
+	case err != nil:
+		run.Outcome = OutcomeFailed
+		run.Error = weather.ErrorMessage(err)
+	case len(failures) > 0:
+		run.Outcome = OutcomePartial
+	}
+	return run
+}
+
+// runLog is a bounded, in-memory log of the most recent runs.
+type runLog struct {
+	mu   sync.Mutex
+	runs []Run // ring buffer of up to cap(runs) entries
+	next int   // index the next run is written to once the buffer is full
+}
+
+func newRunLog(size int) *runLog {
+	if size <= 0 {
+		size = defaultRunLogSize
+	}
+	return &runLog{runs: make([]Run, 0, size)}
+}
+
+// add records run, dropping the oldest run if the log is full.
+func (l *runLog) add(run Run) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.runs) < cap(l.runs) {
+		l.runs = append(l.runs, run)
+		return
+	}
+	l.runs[l.next] = run
+	l.next = (l.next + 1) % len(l.runs)
+}
+
+// recent returns the logged runs, newest first.
+func (l *runLog) recent() []Run {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	runs := make([]Run, 0, len(l.runs))
+	for i := len(l.runs) - 1; i >= 0; i-- {
+		runs = append(runs, l.runs[(l.next+i)%len(l.runs)])
+	}
+	return runs
+}
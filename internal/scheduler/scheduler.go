@@ -2,79 +2,595 @@ package scheduler
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math/rand"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-co-op/gocron"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/time/rate"
+
+	"github.com/i474232898/weather-data-aggregation/internal/metrics"
 	"github.com/i474232898/weather-data-aggregation/internal/weather"
 )
 
-// Scheduler periodically fetches weather data for configured locations.
+// syncInterval is how often the scheduler picks up added and removed
+// locations and changed schedules.
+const syncInterval = 10 * time.Second
+
+// ErrNotScheduled is returned by RunNow for a location the scheduler does not fetch.
+var ErrNotScheduled = errors.New("location is not scheduled")
+
+// LocationSource provides the locations to fetch. It is consulted periodically,
+// so locations added or removed at runtime are picked up without a restart.
+type LocationSource interface {
+	List() []weather.Location
+}
+
+// ScheduleSource is implemented by LocationSources that store a schedule per
+// location (see ParseSchedule). An empty schedule means the default interval.
+type ScheduleSource interface {
+	Schedule(key string) string
+}
+
+// Sources combines several LocationSources, e.g. the persisted registry and
+// locations enrolled on demand. Locations listed by more than one source are
+// returned once, in the order of the first source that lists them.
+type Sources []LocationSource
+
+// List returns the locations of every source.
+func (ss Sources) List() []weather.Location {
+	var (
+		locs []weather.Location
+		seen = make(map[string]bool)
+	)
+	for _, src := range ss {
+		for _, loc := range src.List() {
+			if seen[loc.Key()] {
+				continue
+			}
+			seen[loc.Key()] = true
+			locs = append(locs, loc)
+		}
+	}
+	return locs
+}
+
+// Schedule returns the first non-empty schedule any source has for key.
+func (ss Sources) Schedule(key string) string {
+	for _, src := range ss {
+		if s, ok := src.(ScheduleSource); ok {
+			if spec := s.Schedule(key); spec != "" {
+				return spec
+			}
+		}
+	}
+	return ""
+}
+
+// Schedule is a parsed location schedule: a fixed interval or a cron expression.
+type Schedule struct {
+	Interval time.Duration
+	Cron     string
+	// WithSeconds is set for six-field cron expressions.
+	WithSeconds bool
+}
+
+var cronWithSeconds = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ParseSchedule parses a location schedule: either a Go duration of at least
+// one second (e.g. "30s", "5m") or a cron expression with five fields, six
+// fields (leading seconds) or a descriptor such as "@hourly". Cron
+// expressions are evaluated in UTC unless prefixed with CRON_TZ=<zone>.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Schedule{}, fmt.Errorf("empty schedule")
+	}
+
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d < time.Second {
+			return Schedule{}, fmt.Errorf("interval %s is shorter than 1s", d)
+		}
+		return Schedule{Interval: d}, nil
+	}
+
+	fields := strings.Fields(spec)
+	if strings.HasPrefix(fields[0], "TZ=") || strings.HasPrefix(fields[0], "CRON_TZ=") {
+		fields = fields[1:]
+	}
+	if len(fields) == 6 {
+		if _, err := cronWithSeconds.Parse(spec); err != nil {
+			return Schedule{}, fmt.Errorf("invalid cron expression %q: %w", spec, err)
+		}
+		return Schedule{Cron: spec, WithSeconds: true}, nil
+	}
+	if _, err := cron.ParseStandard(spec); err != nil {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: not a duration or cron expression: %w", spec, err)
+	}
+	return Schedule{Cron: spec}, nil
+}
+
+// Config tunes the Scheduler.
+type Config struct {
+	// Interval is the schedule of locations without one of their own.
+	Interval time.Duration
+	// Jitter delays every scheduled fetch by a random duration up to Jitter,
+	// so locations on the same schedule don't all hit providers at once.
+	Jitter time.Duration
+	// MaxConcurrency caps the number of locations fetched at the same time.
+	// Zero means no limit.
+	MaxConcurrency int
+	// PacePerSecond caps the rate at which location fetches start, spreading
+	// them out evenly (see PacingRate). Zero means no pacing.
+	PacePerSecond rate.Limit
+	// RunLogSize is the number of recent runs kept for Runs. Zero means 200.
+	RunLogSize int
+	// Backfill, if positive, is how far back the history of each location is
+	// filled from providers with historical data (see weather.Service.Backfill):
+	// once after the warm-up, and for locations added later.
+	Backfill time.Duration
+}
+
+// Scheduler fetches weather data for tracked locations, each on its own
+// schedule.
 type Scheduler struct {
 	scheduler *gocron.Scheduler
 	service   *weather.Service
-	locations []weather.Location
-	interval  time.Duration
+	locations LocationSource
+
+	ctx    context.Context // canceled by Stop
+	cancel context.CancelFunc
+
+	paused atomic.Bool
+	runs   *runLog
+	ready  chan struct{} // closed when the warm-up is done
+
+	mu      sync.Mutex
+	cfg     Config
+	sem     chan struct{}           // nil when unlimited
+	pacer   *rate.Limiter           // nil when not pacing
+	jobs    map[string]*locationJob // by location key
+	lastRun map[string]Run          // by location key; pruned by sync
+}
+
+// locationJob is the gocron job fetching one location.
+type locationJob struct {
+	spec    string // schedule it was created with ("" for the default)
+	job     *gocron.Job
+	running sync.Mutex  // held while a run is in progress
+	active  atomic.Bool // reports running to Jobs
 }
 
 // New creates a new Scheduler.
-func New(locations []weather.Location, interval time.Duration, service *weather.Service) *Scheduler {
-	s := gocron.NewScheduler(time.UTC)
-	return &Scheduler{
-		scheduler: s,
+func New(locations LocationSource, service *weather.Service, cfg Config) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		scheduler: gocron.NewScheduler(time.UTC),
 		service:   service,
 		locations: locations,
-		interval:  interval,
+		ctx:       ctx,
+		cancel:    cancel,
+		runs:      newRunLog(cfg.RunLogSize),
+		ready:     make(chan struct{}),
+		jobs:      make(map[string]*locationJob),
+		lastRun:   make(map[string]Run),
 	}
+	s.setConfig(cfg)
+	return s
 }
 
-// Start schedules the periodic job and starts the underlying scheduler.
-func (s *Scheduler) Start() error {
-	if len(s.locations) == 0 {
-		log.Println("scheduler: no locations configured; nothing to schedule")
-		return nil
+// setConfig stores cfg and builds its concurrency and pacing limits, keeping
+// the current ones if they did not change. Callers must hold s.mu or own s.
+func (s *Scheduler) setConfig(cfg Config) {
+	if s.sem == nil || cfg.MaxConcurrency != s.cfg.MaxConcurrency {
+		s.sem = nil
+		if cfg.MaxConcurrency > 0 {
+			s.sem = make(chan struct{}, cfg.MaxConcurrency)
+		}
 	}
+	if s.pacer == nil || cfg.PacePerSecond != s.cfg.PacePerSecond {
+		s.pacer = nil
+		if cfg.PacePerSecond > 0 {
+			s.pacer = rate.NewLimiter(cfg.PacePerSecond, 1)
+		}
+	}
+	s.cfg = cfg
+}
 
-	minutes := int(s.interval.Minutes())
-	if minutes <= 0 {
-		minutes = 15
+// settings returns the current configuration and its limits.
+func (s *Scheduler) settings() (Config, chan struct{}, *rate.Limiter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg, s.sem, s.pacer
+}
+
+// Reconfigure applies cfg to a running scheduler, e.g. after a configuration
+// reload. Jobs on the default interval are recreated if it changed; runs
+// already in progress finish under the previous limits. RunLogSize only takes
+// effect in New.
+func (s *Scheduler) Reconfigure(cfg Config) error {
+	if cfg.Interval < time.Second {
+		return fmt.Errorf("fetch interval %s is shorter than 1s", cfg.Interval)
 	}
 
-	_, err := s.scheduler.Every(minutes).Minutes().Do(func() {
-		log.Println("scheduler: running weather fetch job")
+	s.mu.Lock()
+	if cfg.Interval != s.cfg.Interval {
+		for key, lj := range s.jobs {
+			if lj.spec == "" {
+				s.scheduler.RemoveByReference(lj.job)
+				delete(s.jobs, key)
+			}
+		}
+	}
+	s.setConfig(cfg)
+	s.mu.Unlock()
 
-		var wg sync.WaitGroup
-		for _, loc := range s.locations {
-			loc := loc
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
+	s.sync(false)
+	return nil
+}
 
-				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-				defer cancel()
+// Start schedules a job per tracked location, starts the underlying
+// scheduler and warms up in the background: every location without a
+// snapshot newer than the default interval is fetched right away, and Ready
+// reports true once that is done. Jobs wait for their first scheduled run.
+func (s *Scheduler) Start() error {
+	cfg, _, _ := s.settings()
+	if cfg.Interval < time.Second {
+		return fmt.Errorf("fetch interval %s is shorter than 1s", cfg.Interval)
+	}
 
-				if err := s.service.FetchAndStore(ctx, loc); err != nil {
-					log.Printf("scheduler: fetch failed for %s: %v", loc.Key(), err)
-				}
-			}()
-		}
-		wg.Wait()
-		log.Println("scheduler: completed weather fetch job")
-	})
-	if err != nil {
+	s.sync(true)
+	if _, err := s.scheduler.Every(syncInterval).WaitForSchedule().Do(s.sync, false); err != nil {
 		return err
 	}
 
 	s.scheduler.StartAsync()
+	go s.warmUp(s.locations.List())
 	return nil
 }
 
-// Stop stops the scheduler and cancels any future jobs.
+// warmUp fetches locs that have no recent snapshot, without jitter or
+// pacing but within the concurrency cap, then marks the scheduler ready and
+// starts the backfill.
+func (s *Scheduler) warmUp(locs []weather.Location) {
+	start := time.Now()
+	cfg, _, _ := s.settings()
+
+	var wg sync.WaitGroup
+	for _, loc := range locs {
+		latest, err := s.service.GetLatest(s.ctx, loc)
+		if err == nil && time.Since(latest.Timestamp) < cfg.Interval {
+			continue
+		}
+
+		wg.Add(1)
+		go func(loc weather.Location) {
+			defer wg.Done()
+			s.run(loc, s.jobFor(loc.Key()), TriggerWarmup)
+		}(loc)
+	}
+	wg.Wait()
+
+	if s.ctx.Err() != nil {
+		return
+	}
+	close(s.ready)
+	log.Printf("scheduler: warm-up of %d locations done in %v", len(locs), time.Since(start).Round(time.Millisecond))
+
+	if cfg.Backfill > 0 {
+		for _, loc := range locs {
+			s.backfill(loc)
+		}
+	}
+}
+
+// Ready reports whether the warm-up fetch at Start is done, whether or not
+// every location could be fetched.
+func (s *Scheduler) Ready() bool {
+	select {
+	case <-s.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// backfill fills the recent history of loc if configured, waiting for pacing
+// first.
+func (s *Scheduler) backfill(loc weather.Location) {
+	cfg, _, pacer := s.settings()
+	if cfg.Backfill <= 0 {
+		return
+	}
+	if pacer != nil {
+		if err := pacer.Wait(s.ctx); err != nil {
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	now := time.Now()
+	n, err := s.service.Backfill(ctx, loc, now.Add(-cfg.Backfill), now)
+	if err != nil {
+		log.Printf("scheduler: backfill failed for %s: %v", loc.Key(), err)
+		return
+	}
+	log.Printf("scheduler: backfilled %d hourly snapshots for %s", n, loc.Key())
+}
+
+// sync adds jobs for new locations, removes jobs of untracked locations and
+// recreates jobs whose schedule changed. Every job waits for its first
+// scheduled run: locations are fetched at Start by the warm-up, and new
+// locations by Refresh.
+func (s *Scheduler) sync(initial bool) {
+	locations := s.locations.List()
+	schedules, _ := s.locations.(ScheduleSource)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if initial && len(locations) == 0 {
+		log.Println("scheduler: no locations tracked yet")
+	}
+
+	tracked := make(map[string]bool, len(locations))
+	for _, loc := range locations {
+		key := loc.Key()
+		tracked[key] = true
+
+		spec := ""
+		if schedules != nil {
+			spec = schedules.Schedule(key)
+		}
+
+		if lj, ok := s.jobs[key]; ok {
+			if lj.spec == spec {
+				continue
+			}
+			s.scheduler.RemoveByReference(lj.job)
+			delete(s.jobs, key)
+		}
+
+		lj, err := s.schedule(loc, spec)
+		if err != nil {
+			log.Printf("scheduler: cannot schedule %s: %v", key, err)
+			continue
+		}
+		s.jobs[key] = lj
+	}
+
+	for key, lj := range s.jobs {
+		if !tracked[key] {
+			s.scheduler.RemoveByReference(lj.job)
+			delete(s.jobs, key)
+			log.Printf("scheduler: stopped fetching %s", key)
+		}
+	}
+	for key := range s.lastRun {
+		if !tracked[key] {
+			delete(s.lastRun, key)
+		}
+	}
+}
+
+// schedule creates the job for loc. An invalid spec falls back to the default
+// interval so the location is still fetched. Callers must hold s.mu.
+func (s *Scheduler) schedule(loc weather.Location, spec string) (*locationJob, error) {
+	sched := Schedule{Interval: s.cfg.Interval}
+	if spec != "" {
+		parsed, err := ParseSchedule(spec)
+		if err != nil {
+			log.Printf("scheduler: %s: %v; using the default interval", loc.Key(), err)
+		} else {
+			sched = parsed
+		}
+	}
+
+	var g *gocron.Scheduler
+	switch {
+	case sched.WithSeconds:
+		g = s.scheduler.CronWithSeconds(sched.Cron)
+	case sched.Cron != "":
+		g = s.scheduler.Cron(sched.Cron)
+	default:
+		g = s.scheduler.Every(sched.Interval).WaitForSchedule()
+	}
+
+	lj := &locationJob{spec: spec}
+	job, err := g.Do(s.run, loc, lj, TriggerSchedule)
+	if err != nil {
+		return nil, err
+	}
+	lj.job = job
+	return lj, nil
+}
+
+// run fetches loc and records the run. A run is skipped if the previous one
+// is still in progress, e.g. when waiting for pacing takes longer than the
+// interval. Scheduled runs are delayed by jitter and skipped while the
+// scheduler is paused; every run waits for a concurrency slot, and all but
+// the warm-up wait for pacing.
+func (s *Scheduler) run(loc weather.Location, lj *locationJob, trigger Trigger) {
+	if trigger == TriggerSchedule && s.paused.Load() {
+		return
+	}
+	if !lj.running.TryLock() {
+		log.Printf("scheduler: previous fetch for %s still running; skipping", loc.Key())
+		s.record(Run{Location: loc.Key(), Trigger: trigger, StartedAt: time.Now().UTC(), Outcome: OutcomeSkipped})
+		return
+	}
+	defer lj.running.Unlock()
+	lj.active.Store(true)
+	defer lj.active.Store(false)
+
+	cfg, sem, pacer := s.settings()
+	if trigger == TriggerSchedule && cfg.Jitter > 0 {
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(cfg.Jitter)))):
+		case <-s.ctx.Done():
+			return
+		}
+	}
+	if pacer != nil && trigger != TriggerWarmup {
+		if err := pacer.Wait(s.ctx); err != nil {
+			return
+		}
+	}
+	if sem != nil {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+		case <-s.ctx.Done():
+			return
+		}
+	}
+
+	start := time.Now()
+	err := s.fetch(loc)
+	if trigger == TriggerSchedule {
+		metrics.SchedulerJobDuration.Observe(time.Since(start).Seconds())
+	}
+	s.record(newRun(loc, trigger, start, err, s.service.Providers(), s.service.LastFetchErrors(loc)))
+}
+
+// record adds run to the run log and remembers it as the last run of its
+// location until the location is no longer scheduled.
+func (s *Scheduler) record(run Run) {
+	s.runs.add(run)
+
+	s.mu.Lock()
+	s.lastRun[run.Location] = run
+	s.mu.Unlock()
+}
+
+// jobFor returns the job of the location with the given key, or a detached
+// one if the location has not been scheduled yet.
+func (s *Scheduler) jobFor(key string) *locationJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lj, ok := s.jobs[key]; ok {
+		return lj
+	}
+	return &locationJob{}
+}
+
+// Refresh fetches a single location in the background, e.g. right after it
+// starts being tracked so it doesn't wait for the next scheduled run, and
+// backfills its history if configured.
+func (s *Scheduler) Refresh(loc weather.Location) {
+	go func() {
+		s.run(loc, s.jobFor(loc.Key()), TriggerAdded)
+		s.backfill(loc)
+	}()
+}
+
+// RunNow fetches the scheduled location with the given key, or every
+// scheduled location if key is empty, in the background and without jitter.
+// It works while the scheduler is paused and returns the keys of the
+// locations it started fetching.
+func (s *Scheduler) RunNow(key string) ([]string, error) {
+	var keys []string
+	for _, loc := range s.locations.List() {
+		if key != "" && loc.Key() != key {
+			continue
+		}
+		keys = append(keys, loc.Key())
+		go s.run(loc, s.jobFor(loc.Key()), TriggerManual)
+	}
+	if key != "" && len(keys) == 0 {
+		return nil, ErrNotScheduled
+	}
+	return keys, nil
+}
+
+// Pause stops scheduled runs until Resume. Runs already in progress finish,
+// and RunNow and Refresh keep working.
+func (s *Scheduler) Pause() {
+	if !s.paused.Swap(true) {
+		log.Println("scheduler: paused")
+	}
+}
+
+// Resume restarts scheduled runs after Pause.
+func (s *Scheduler) Resume() {
+	if s.paused.Swap(false) {
+		log.Println("scheduler: resumed")
+	}
+}
+
+// Paused reports whether scheduled runs are paused.
+func (s *Scheduler) Paused() bool {
+	return s.paused.Load()
+}
+
+// JobStatus describes the job of one scheduled location.
+type JobStatus struct {
+	Location string `json:"location"`
+	// Schedule is the location's schedule, or the default interval.
+	Schedule string     `json:"schedule"`
+	NextRun  *time.Time `json:"nextRun,omitempty"`
+	Running  bool       `json:"running"`
+	LastRun  *Run       `json:"lastRun,omitempty"`
+}
+
+// Jobs returns the status of every scheduled location, ordered by key.
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]JobStatus, 0, len(s.jobs))
+	for key, lj := range s.jobs {
+		status := JobStatus{Location: key, Schedule: lj.spec, Running: lj.active.Load()}
+		if status.Schedule == "" {
+			status.Schedule = s.cfg.Interval.String()
+		}
+		if next := lj.job.NextRun(); !next.IsZero() {
+			next = next.UTC()
+			status.NextRun = &next
+		}
+		if run, ok := s.lastRun[key]; ok {
+			status.LastRun = &run
+		}
+		jobs = append(jobs, status)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Location < jobs[j].Location
+	})
+	return jobs
+}
+
+// Runs returns the most recent runs of all locations, newest first. The
+// number of runs kept is bounded by Config.RunLogSize.
+func (s *Scheduler) Runs() []Run {
+	return s.runs.recent()
+}
+
+func (s *Scheduler) fetch(loc weather.Location) error {
+	ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+	defer cancel()
+
+	err := s.service.FetchAndStore(ctx, loc)
+	if err != nil {
+		log.Printf("scheduler: fetch failed for %s: %v", loc.Key(), err)
+	}
+	return err
+}
+
+// Stop stops the scheduler, cancels any future jobs and abandons fetches
+// waiting for jitter, pacing or a concurrency slot.
 func (s *Scheduler) Stop() {
+	s.cancel()
 	if s.scheduler != nil {
 		s.scheduler.Stop()
 	}
 }
-
-
@@ -0,0 +1,287 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/store"
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// TestParseSchedule verifies that intervals and cron expressions are accepted
+// and that sub-second intervals and malformed expressions are rejected.
+func TestParseSchedule(t *testing.T) {
+	cases := []struct {
+		spec    string
+		want    Schedule
+		wantErr bool
+	}{
+		{spec: "30s", want: Schedule{Interval: 30 * time.Second}},
+		{spec: " 5m ", want: Schedule{Interval: 5 * time.Minute}},
+		{spec: "*/10 * * * *", want: Schedule{Cron: "*/10 * * * *"}},
+		{spec: "@hourly", want: Schedule{Cron: "@hourly"}},
+		{spec: "*/15 * * * * *", want: Schedule{Cron: "*/15 * * * * *", WithSeconds: true}},
+		{spec: "CRON_TZ=Europe/Prague 0 6 * * *", want: Schedule{Cron: "CRON_TZ=Europe/Prague 0 6 * * *"}},
+		{spec: "500ms", wantErr: true},
+		{spec: "every minute", wantErr: true},
+		{spec: "61 * * * *", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		got, err := ParseSchedule(tc.spec)
+		if tc.wantErr {
+			if err == nil {
+				t.Fatalf("%q: expected error, got %+v", tc.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.spec, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%q: expected %+v, got %+v", tc.spec, tc.want, got)
+		}
+	}
+}
+
+// stubSource is a LocationSource with per-location schedules.
+type stubSource struct {
+	mu        sync.Mutex
+	locations []weather.Location
+	schedules map[string]string
+}
+
+func (s *stubSource) List() []weather.Location {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]weather.Location(nil), s.locations...)
+}
+
+func (s *stubSource) Schedule(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.schedules[key]
+}
+
+// TestSchedulerSyncFollowsSources verifies that sync creates a job per
+// location, recreates jobs whose schedule changed and drops untracked ones.
+func TestSchedulerSyncFollowsSources(t *testing.T) {
+	paris := weather.Location{City: "Paris", Country: "FR"}
+	oslo := weather.Location{City: "Oslo", Country: "NO"}
+	src := &stubSource{locations: []weather.Location{paris, oslo}, schedules: map[string]string{}}
+
+	s := New(Sources{src}, weather.NewService(nil, nil), Config{Interval: time.Hour})
+	defer s.Stop()
+
+	s.sync(false)
+	if len(s.jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(s.jobs))
+	}
+	before := s.jobs[paris.Key()].job
+
+	src.mu.Lock()
+	src.schedules[paris.Key()] = "*/5 * * * *"
+	src.locations = []weather.Location{paris}
+	src.mu.Unlock()
+
+	s.sync(false)
+	if len(s.jobs) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(s.jobs))
+	}
+	lj := s.jobs[paris.Key()]
+	if lj == nil || lj.job == before || lj.spec != "*/5 * * * *" {
+		t.Fatalf("expected the paris job to be recreated with its new schedule, got %+v", lj)
+	}
+	if n := len(s.scheduler.Jobs()); n != 1 {
+		t.Fatalf("expected 1 gocron job, got %d", n)
+	}
+}
+
+// TestReconfigureRecreatesDefaultIntervalJobs verifies that changing the
+// default interval recreates only the jobs without a schedule of their own
+// and that the new limits are used.
+func TestReconfigureRecreatesDefaultIntervalJobs(t *testing.T) {
+	paris := weather.Location{City: "Paris", Country: "FR"}
+	oslo := weather.Location{City: "Oslo", Country: "NO"}
+	src := &stubSource{
+		locations: []weather.Location{paris, oslo},
+		schedules: map[string]string{oslo.Key(): "*/5 * * * *"},
+	}
+
+	s := New(Sources{src}, weather.NewService(nil, nil), Config{Interval: time.Hour, MaxConcurrency: 2})
+	defer s.Stop()
+
+	s.sync(false)
+	parisJob, osloJob := s.jobs[paris.Key()].job, s.jobs[oslo.Key()].job
+
+	if err := s.Reconfigure(Config{Interval: 500 * time.Millisecond}); err == nil {
+		t.Fatal("expected a sub-second interval to be rejected")
+	}
+	if err := s.Reconfigure(Config{Interval: 30 * time.Minute, MaxConcurrency: 4}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if s.jobs[paris.Key()].job == parisJob {
+		t.Fatal("expected the paris job to be recreated for the new interval")
+	}
+	if s.jobs[oslo.Key()].job != osloJob {
+		t.Fatal("expected the oslo job with its own schedule to be kept")
+	}
+	if n := len(s.scheduler.Jobs()); n != 2 {
+		t.Fatalf("expected 2 gocron jobs, got %d", n)
+	}
+	if cfg, sem, _ := s.settings(); cfg.Interval != 30*time.Minute || cap(sem) != 4 {
+		t.Fatalf("expected the new config to apply, got interval %v and %d slots", cfg.Interval, cap(sem))
+	}
+}
+
+// TestRunLogKeepsMostRecent verifies that the run log drops the oldest runs
+// once full and lists runs newest first.
+func TestRunLogKeepsMostRecent(t *testing.T) {
+	l := newRunLog(3)
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		l.add(Run{Location: key})
+	}
+
+	runs := l.recent()
+	if len(runs) != 3 {
+		t.Fatalf("expected 3 runs, got %d", len(runs))
+	}
+	for i, want := range []string{"e", "d", "c"} {
+		if runs[i].Location != want {
+			t.Fatalf("run %d: expected %s, got %s", i, want, runs[i].Location)
+		}
+	}
+}
+
+// TestRunHidesRequestURLs verifies that runs do not record the query, and
+// with it the API key, of a failed request's URL.
+func TestRunHidesRequestURLs(t *testing.T) {
+	const key = "SECRETKEY"
+	urlErr := &url.Error{Op: "Get", URL: "http://api.example.com/weather?appid=" + key, Err: errors.New("connection refused")}
+	failure := weather.AsProviderError("bad", weather.OperationCurrent, urlErr)
+
+	run := newRun(weather.Location{City: "Paris"}, TriggerManual, time.Now(), fmt.Errorf("fetch failed: %w", urlErr),
+		[]weather.Provider{stubProvider{name: "bad"}}, []*weather.ProviderError{failure})
+	if strings.Contains(run.Error, key) || strings.Contains(run.Providers[0].Error, key) {
+		t.Fatalf("expected the API key to be hidden, got %+v", run)
+	}
+	if !strings.Contains(run.Error, "http://api.example.com/weather") {
+		t.Fatalf("expected the error to keep the URL without its query, got %q", run.Error)
+	}
+}
+
+// stubProvider is a weather.Provider returning a fixed reading or error.
+type stubProvider struct {
+	name string
+	err  error
+}
+
+func (p stubProvider) Name() string { return p.name }
+
+func (p stubProvider) Fetch(ctx context.Context, loc weather.Location) (weather.ProviderReading, error) {
+	if p.err != nil {
+		return weather.ProviderReading{}, p.err
+	}
+	return weather.ProviderReading{ProviderName: p.name, TemperatureC: weather.Float64(12)}, nil
+}
+
+// TestRunNowRecordsProviderResults verifies that manual runs work while the
+// scheduler is paused, and that each run records per-provider success.
+func TestRunNowRecordsProviderResults(t *testing.T) {
+	paris := weather.Location{City: "Paris", Country: "FR"}.Normalize()
+	provs := []weather.Provider{
+		stubProvider{name: "good"},
+		stubProvider{name: "bad", err: errors.New("boom")},
+	}
+	svc := weather.NewService(store.NewMemoryStore(10, time.Hour), provs)
+	s := New(&stubSource{locations: []weather.Location{paris}}, svc, Config{Interval: time.Hour})
+	defer s.Stop()
+	s.sync(false)
+
+	s.Pause()
+	s.run(paris, s.jobs[paris.Key()], TriggerSchedule)
+	if runs := s.Runs(); len(runs) != 0 {
+		t.Fatalf("expected paused scheduled run to be skipped, got %+v", runs)
+	}
+
+	if _, err := s.RunNow("oslo:no"); !errors.Is(err, ErrNotScheduled) {
+		t.Fatalf("expected ErrNotScheduled, got %v", err)
+	}
+	keys, err := s.RunNow("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != paris.Key() {
+		t.Fatalf("expected paris to be run, got %v", keys)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(s.Runs()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	runs := s.Runs()
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(runs))
+	}
+	run := runs[0]
+	if run.Trigger != TriggerManual || run.Outcome != OutcomePartial {
+		t.Fatalf("expected a partial manual run, got %+v", run)
+	}
+	if len(run.Providers) != 2 || !run.Providers[0].OK || run.Providers[1].OK || run.Providers[1].Error == "" {
+		t.Fatalf("unexpected provider results: %+v", run.Providers)
+	}
+
+	jobs := s.Jobs()
+	if len(jobs) != 1 || jobs[0].LastRun == nil || jobs[0].Schedule != "1h0m0s" {
+		t.Fatalf("unexpected jobs: %+v", jobs)
+	}
+}
+
+// TestStartWarmsUp verifies that Start fetches locations without a recent
+// snapshot right away and reports ready once that is done.
+func TestStartWarmsUp(t *testing.T) {
+	ctx := context.Background()
+	paris := weather.Location{City: "Paris", Country: "FR"}.Normalize()
+	oslo := weather.Location{City: "Oslo", Country: "NO"}.Normalize()
+
+	st := store.NewMemoryStore(10, 24*time.Hour)
+	fresh := weather.WeatherSnapshot{Location: oslo, Timestamp: time.Now().UTC(), Temperature: weather.Float64(3)}
+	if err := st.SaveSnapshot(ctx, oslo, fresh); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	svc := weather.NewService(st, []weather.Provider{stubProvider{name: "good"}})
+	s := New(&stubSource{locations: []weather.Location{paris, oslo}}, svc, Config{Interval: time.Hour})
+	defer s.Stop()
+
+	if s.Ready() {
+		t.Fatalf("expected the scheduler not to be ready before Start")
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !s.Ready() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !s.Ready() {
+		t.Fatalf("expected the scheduler to be ready after the warm-up")
+	}
+
+	if _, err := st.GetLatest(ctx, paris); err != nil {
+		t.Fatalf("expected paris to be fetched by the warm-up: %v", err)
+	}
+	runs := s.Runs()
+	if len(runs) != 1 || runs[0].Location != paris.Key() || runs[0].Trigger != TriggerWarmup {
+		t.Fatalf("expected only paris to be warmed up, got %+v", runs)
+	}
+}
@@ -0,0 +1,510 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+const (
+	segmentPrefix = "segment-"
+	segmentSuffix = ".log"
+
+	// defaultMaxSegmentBytes is the size after which the active segment is sealed
+	// and a new one is started.
+	defaultMaxSegmentBytes = 4 << 20
+)
+
+// logRecord is a single line in a segment file.
+type logRecord struct {
+	Key      string                  `json:"key"`
+	Snapshot weather.WeatherSnapshot `json:"snapshot"`
+}
+
+// recordRef locates a record inside a segment.
+type recordRef struct {
+	segment   int
+	offset    int64
+	length    int64
+	timestamp time.Time
+}
+
+type segment struct {
+	id        int
+	file      *os.File
+	size      int64
+	live      int   // number of index entries pointing into this segment
+	liveBytes int64 // total length of those entries' records
+}
+
+// FileStore is an embedded, on-disk implementation of a weather store.
+//
+// Snapshots are appended as JSON lines to segment files in a directory. An
+// in-memory index (location key -> record positions) is rebuilt by scanning
+// the segments on open, and retention drops index entries; sealed segments
+// with no live entries left are deleted. Whenever a segment is sealed,
+// retention is applied to every location, including ones no longer saved,
+// and sealed segments that are mostly dead are compacted by copying their
+// live records to the active segment.
+type FileStore struct {
+	mu sync.RWMutex
+
+	dir             string
+	maxSegmentBytes int64
+
+	// retention configuration
+	maxHistory int           // max number of snapshots per location
+	maxAge     time.Duration // optional max age for snapshots
+
+	segments map[int]*segment
+	active   *segment
+
+	// key: location key, value: record positions ordered by snapshot timestamp
+	index map[string][]recordRef
+}
+
+// NewFileStore opens (or creates) a FileStore in dir with optional limits.
+// If maxHistory is <= 0, it is treated as unlimited.
+func NewFileStore(dir string, maxHistory int, maxAge time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create store dir: %w", err)
+	}
+
+	s := &FileStore{
+		dir:             dir,
+		maxSegmentBytes: defaultMaxSegmentBytes,
+		maxHistory:      maxHistory,
+		maxAge:          maxAge,
+		segments:        make(map[int]*segment),
+		index:           make(map[string][]recordRef),
+	}
+
+	if err := s.open(); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// open scans existing segments, rebuilds the index and applies retention.
+func (s *FileStore) open() error {
+	ids, err := s.segmentIDs()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := s.loadSegment(id); err != nil {
+			return err
+		}
+	}
+
+	for key := range s.index {
+		s.enforceRetention(key)
+	}
+
+	if len(ids) > 0 {
+		last := s.segments[ids[len(ids)-1]]
+		if last.size < s.maxSegmentBytes {
+			s.active = last
+		}
+	}
+	if s.active == nil {
+		next := 1
+		if len(ids) > 0 {
+			next = ids[len(ids)-1] + 1
+		}
+		if err := s.roll(next); err != nil {
+			return err
+		}
+	}
+
+	s.removeDeadSegments()
+	return nil
+}
+
+func (s *FileStore) segmentIDs() ([]int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read store dir: %w", err)
+	}
+
+	var ids []int
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (s *FileStore) segmentPath(id int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%06d%s", segmentPrefix, id, segmentSuffix))
+}
+
+// loadSegment opens a segment and indexes its records. A torn or corrupt tail
+// (e.g. from a crash mid-write) is truncated away.
+func (s *FileStore) loadSegment(id int) error {
+	f, err := os.OpenFile(s.segmentPath(id), os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("open segment %d: %w", id, err)
+	}
+
+	seg := &segment{id: id, file: f}
+	s.segments[id] = seg
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			break
+		}
+
+		var rec logRecord
+		if err != nil || json.Unmarshal(line, &rec) != nil {
+			log.Printf("store: truncating segment %d at offset %d: incomplete or corrupt record", id, offset)
+			if err := f.Truncate(offset); err != nil {
+				return fmt.Errorf("truncate segment %d: %w", id, err)
+			}
+			break
+		}
+
+		s.index[rec.Key] = insertRef(s.index[rec.Key], recordRef{
+			segment:   id,
+			offset:    offset,
+			length:    int64(len(line)),
+			timestamp: rec.Snapshot.Timestamp,
+		})
+		seg.live++
+		seg.liveBytes += int64(len(line))
+		offset += int64(len(line))
+	}
+
+	seg.size = offset
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seek segment %d: %w", id, err)
+	}
+	return nil
+}
+
+// roll creates a new empty active segment.
+func (s *FileStore) roll(id int) error {
+	f, err := os.OpenFile(s.segmentPath(id), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("create segment %d: %w", id, err)
+	}
+	seg := &segment{id: id, file: f}
+	s.segments[id] = seg
+	s.active = seg
+	return nil
+}
+
+// SaveSnapshot appends a new snapshot for a location and enforces retention.
+// The snapshot is indexed in timestamp order, so a backfilled snapshot older
+// than the latest one does not replace it. The snapshot is not indexed if it
+// was not persisted.
+func (s *FileStore) SaveSnapshot(ctx context.Context, loc weather.Location, snapshot weather.WeatherSnapshot) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	key := loc.Key()
+
+	line, err := json.Marshal(logRecord{Key: key, Snapshot: snapshot})
+	if err != nil {
+		return fmt.Errorf("encode snapshot for %s: %w", key, err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		return fmt.Errorf("save snapshot for %s: store is closed", key)
+	}
+
+	ref, rolled, err := s.appendRecord(line, snapshot.Timestamp)
+	if err != nil {
+		return fmt.Errorf("append snapshot for %s: %w", key, err)
+	}
+	s.sync(s.active)
+	s.index[key] = insertRef(s.index[key], ref)
+
+	s.enforceRetention(key)
+	if rolled {
+		s.sweep()
+	}
+	s.removeDeadSegments()
+	return nil
+}
+
+// appendRecord writes line to the active segment, first sealing it and
+// starting a new one if line does not fit, and returns the record's position.
+// Callers must hold s.mu.
+func (s *FileStore) appendRecord(line []byte, timestamp time.Time) (ref recordRef, rolled bool, err error) {
+	if s.active.size > 0 && s.active.size+int64(len(line)) > s.maxSegmentBytes {
+		sealed := s.active
+		if err := s.roll(sealed.id + 1); err != nil {
+			return recordRef{}, false, fmt.Errorf("roll segment: %w", err)
+		}
+		s.sync(sealed)
+		rolled = true
+	}
+
+	seg := s.active
+	if _, err := seg.file.WriteAt(line, seg.size); err != nil {
+		return recordRef{}, rolled, err
+	}
+	ref = recordRef{
+		segment:   seg.id,
+		offset:    seg.size,
+		length:    int64(len(line)),
+		timestamp: timestamp,
+	}
+	seg.size += ref.length
+	seg.live++
+	seg.liveBytes += ref.length
+	return ref, rolled, nil
+}
+
+func (s *FileStore) sync(seg *segment) {
+	if err := seg.file.Sync(); err != nil {
+		log.Printf("store: failed to sync segment %d: %v", seg.id, err)
+	}
+}
+
+// insertRef inserts ref into refs, which are ordered by timestamp, after any
+// refs with the same timestamp.
+func insertRef(refs []recordRef, ref recordRef) []recordRef {
+	i := sort.Search(len(refs), func(i int) bool {
+		return refs[i].timestamp.After(ref.timestamp)
+	})
+	return append(refs[:i], append([]recordRef{ref}, refs[i:]...)...)
+}
+
+// enforceRetention trims the index for key by count and age. Callers must hold s.mu.
+func (s *FileStore) enforceRetention(key string) {
+	refs := s.index[key]
+	drop := 0
+
+	// Enforce retention by count.
+	if s.maxHistory > 0 && len(refs) > s.maxHistory {
+		drop = len(refs) - s.maxHistory
+	}
+
+	// Enforce retention by age, always keeping the latest snapshot.
+	if s.maxAge > 0 {
+		cutoff := time.Now().Add(-s.maxAge)
+		for drop < len(refs)-1 && refs[drop].timestamp.Before(cutoff) {
+			drop++
+		}
+	}
+
+	if drop == 0 {
+		return
+	}
+
+	s.release(refs[:drop])
+	s.index[key] = append([]recordRef(nil), refs[drop:]...)
+}
+
+// release marks the records at refs as dead. Callers must hold s.mu.
+func (s *FileStore) release(refs []recordRef) {
+	for _, ref := range refs {
+		if seg, ok := s.segments[ref.segment]; ok {
+			seg.live--
+			seg.liveBytes -= ref.length
+		}
+	}
+}
+
+// sweep applies retention to every location. Unlike saves, which always keep
+// a location's latest snapshot, it drops locations whose latest snapshot has
+// aged out too, i.e. ones that are no longer fetched. Then it compacts.
+// Callers must hold s.mu.
+func (s *FileStore) sweep() {
+	var cutoff time.Time
+	if s.maxAge > 0 {
+		cutoff = time.Now().Add(-s.maxAge)
+	}
+	for key, refs := range s.index {
+		if !cutoff.IsZero() && refs[len(refs)-1].timestamp.Before(cutoff) {
+			s.release(refs)
+			delete(s.index, key)
+			continue
+		}
+		s.enforceRetention(key)
+	}
+
+	if err := s.compact(); err != nil {
+		log.Printf("store: compaction failed: %v", err)
+	}
+}
+
+// compact copies the live records of sealed segments where they take up less
+// than half of the file to the active segment, leaving those segments dead.
+// Callers must hold s.mu.
+func (s *FileStore) compact() error {
+	sparse := make(map[int]bool)
+	for id, seg := range s.segments {
+		if seg != s.active && seg.live > 0 && seg.liveBytes*2 < seg.size {
+			sparse[id] = true
+		}
+	}
+	if len(sparse) == 0 {
+		return nil
+	}
+
+	written := make(map[int]*segment)
+	for _, refs := range s.index {
+		for i, ref := range refs {
+			if !sparse[ref.segment] {
+				continue
+			}
+			line := make([]byte, ref.length)
+			if _, err := s.segments[ref.segment].file.ReadAt(line, ref.offset); err != nil {
+				return fmt.Errorf("read segment %d: %w", ref.segment, err)
+			}
+			moved, _, err := s.appendRecord(line, ref.timestamp)
+			if err != nil {
+				return fmt.Errorf("copy record from segment %d: %w", ref.segment, err)
+			}
+			s.release(refs[i : i+1])
+			refs[i] = moved
+			written[moved.segment] = s.segments[moved.segment]
+		}
+	}
+	// The copies must be durable before the sparse segments are deleted.
+	for _, seg := range written {
+		s.sync(seg)
+	}
+	return nil
+}
+
+// removeDeadSegments deletes sealed segments that no index entry references.
+// Callers must hold s.mu.
+func (s *FileStore) removeDeadSegments() {
+	for id, seg := range s.segments {
+		if seg == s.active || seg.live > 0 {
+			continue
+		}
+		seg.file.Close()
+		if err := os.Remove(s.segmentPath(id)); err != nil {
+			log.Printf("store: failed to remove segment %d: %v", id, err)
+		}
+		delete(s.segments, id)
+	}
+}
+
+// readRecord loads the snapshot at ref. Callers must hold s.mu (read or write).
+func (s *FileStore) readRecord(ref recordRef) (weather.WeatherSnapshot, error) {
+	seg, ok := s.segments[ref.segment]
+	if !ok {
+		return weather.WeatherSnapshot{}, fmt.Errorf("segment %d not found", ref.segment)
+	}
+
+	buf := make([]byte, ref.length)
+	if _, err := seg.file.ReadAt(buf, ref.offset); err != nil {
+		return weather.WeatherSnapshot{}, fmt.Errorf("read segment %d: %w", ref.segment, err)
+	}
+
+	var rec logRecord
+	if err := json.Unmarshal(buf, &rec); err != nil {
+		return weather.WeatherSnapshot{}, fmt.Errorf("decode segment %d at %d: %w", ref.segment, ref.offset, err)
+	}
+	return rec.Snapshot, nil
+}
+
+// GetLatest returns the most recent snapshot for a location.
+func (s *FileStore) GetLatest(ctx context.Context, loc weather.Location) (weather.WeatherSnapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return weather.WeatherSnapshot{}, err
+	}
+
+	key := loc.Key()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	refs := s.index[key]
+	if len(refs) == 0 {
+		return weather.WeatherSnapshot{}, ErrNotFound
+	}
+	return s.readRecord(refs[len(refs)-1])
+}
+
+// GetRange returns all snapshots for a location between from and to (inclusive).
+func (s *FileStore) GetRange(ctx context.Context, loc weather.Location, from, to time.Time) ([]weather.WeatherSnapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	key := loc.Key()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	refs := s.index[key]
+	if len(refs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	var result []weather.WeatherSnapshot
+	for _, ref := range refs {
+		if ref.timestamp.Before(from) || ref.timestamp.After(to) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		snap, err := s.readRecord(ref)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, snap)
+	}
+
+	if len(result) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return result, nil
+}
+
+// Close releases all segment file handles.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for id, seg := range s.segments {
+		if err := seg.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.segments, id)
+	}
+	s.active = nil
+	return firstErr
+}
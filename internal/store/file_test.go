@@ -0,0 +1,258 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// TestFileStorePersistsAcrossReopen verifies that snapshots written by one
+// FileStore are visible to a new FileStore opened on the same directory.
+func TestFileStorePersistsAcrossReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	loc := weather.Location{City: "Paris", Country: "FR"}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	s, err := NewFileStore(dir, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.SaveSnapshot(ctx, loc, weather.WeatherSnapshot{Location: loc, Timestamp: now.Add(-time.Minute), Temperature: weather.Float64(10)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.SaveSnapshot(ctx, loc, weather.WeatherSnapshot{Location: loc, Timestamp: now, Temperature: weather.Float64(12)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s, err = NewFileStore(dir, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+
+	latest, err := s.GetLatest(ctx, loc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *latest.Temperature != 12 || !latest.Timestamp.Equal(now) {
+		t.Fatalf("unexpected latest snapshot: %+v", latest)
+	}
+
+	history, err := s.GetRange(ctx, loc, now.Add(-time.Hour), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 snapshots, got %d", len(history))
+	}
+}
+
+// TestFileStoreRetention verifies count-based retention and that fully
+// expired segments are removed from disk.
+func TestFileStoreRetention(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	loc := weather.Location{City: "Paris", Country: "FR"}
+	now := time.Now().UTC()
+
+	s, err := NewFileStore(dir, 2, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+	// Force a new segment for every record so dead segments become removable.
+	s.maxSegmentBytes = 1
+
+	for i := 0; i < 5; i++ {
+		if err := s.SaveSnapshot(ctx, loc, weather.WeatherSnapshot{Location: loc, Timestamp: now.Add(time.Duration(i) * time.Minute), Temperature: weather.Float64(float64(i))}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	history, err := s.GetRange(ctx, loc, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(history) != 2 || *history[0].Temperature != 3 || *history[1].Temperature != 4 {
+		t.Fatalf("unexpected retained history: %+v", history)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 segment files on disk, got %d", len(entries))
+	}
+
+	if _, err := s.GetLatest(ctx, weather.Location{City: "Berlin", Country: "DE"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// TestFileStoreSweepsAndCompacts verifies that sealing a segment drops
+// locations that are no longer saved once they age out, and compacts
+// segments kept alive by a few live records, so disk use stays bounded.
+func TestFileStoreSweepsAndCompacts(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	now := time.Now().UTC()
+	idle := weather.Location{City: "Oslo", Country: "NO"}
+	kept := weather.Location{City: "Rome", Country: "IT"}
+	busy := weather.Location{City: "Paris", Country: "FR"}
+
+	s, err := NewFileStore(dir, 2, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+	// Room for four records per segment.
+	s.maxSegmentBytes = 4 * 240
+
+	save := func(loc weather.Location, ts time.Time) {
+		t.Helper()
+		if err := s.SaveSnapshot(ctx, loc, weather.WeatherSnapshot{Location: loc, Timestamp: ts}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// The first segment ends up with a single live record, of kept.
+	save(idle, now.Add(-2*time.Hour))
+	save(busy, now.Add(-time.Minute))
+	save(kept, now)
+	for i := 0; i < 50; i++ {
+		save(busy, now.Add(time.Duration(i)*time.Second))
+	}
+
+	if _, err := s.GetLatest(ctx, idle); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the aged-out location to be dropped, got %v", err)
+	}
+	if snap, err := s.GetLatest(ctx, kept); err != nil || !snap.Timestamp.Equal(now) {
+		t.Fatalf("expected the kept location to survive compaction, got %+v, %v", snap, err)
+	}
+
+	if _, err := os.Stat(s.segmentPath(1)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the first segment to be compacted away, got %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) > 3 {
+		t.Fatalf("expected at most 3 segment files on disk, got %d", len(entries))
+	}
+
+	// The index rebuilt from disk matches.
+	s.Close()
+	s, err = NewFileStore(dir, 2, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snap, err := s.GetLatest(ctx, kept); err != nil || !snap.Timestamp.Equal(now) {
+		t.Fatalf("expected the kept location after reopen, got %+v, %v", snap, err)
+	}
+	if history, err := s.GetRange(ctx, busy, now.Add(-time.Hour), now.Add(time.Hour)); err != nil || len(history) != 2 {
+		t.Fatalf("expected 2 snapshots of the busy location after reopen, got %d, %v", len(history), err)
+	}
+}
+
+// TestFileStoreTruncatesTornTail verifies that a partially written record at
+// the end of a segment is discarded on open.
+func TestFileStoreTruncatesTornTail(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	loc := weather.Location{City: "Paris", Country: "FR"}
+
+	s, err := NewFileStore(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.SaveSnapshot(ctx, loc, weather.WeatherSnapshot{Location: loc, Timestamp: time.Now().UTC(), Temperature: weather.Float64(7)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := s.segmentPath(s.active.id)
+	s.Close()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.WriteString(`{"key":"Paris:FR","snap`)
+	f.Close()
+
+	s, err = NewFileStore(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+
+	latest, err := s.GetLatest(ctx, loc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *latest.Temperature != 7 {
+		t.Fatalf("unexpected latest snapshot: %+v", latest)
+	}
+}
+
+// TestFileStoreOrdersBackfilledSnapshots verifies that snapshots older than
+// the latest one are kept in timestamp order, also after reopening.
+func TestFileStoreOrdersBackfilledSnapshots(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	loc := weather.Location{City: "Paris", Country: "FR"}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	s, err := NewFileStore(dir, 10, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, age := range []time.Duration{0, 2 * time.Hour, time.Hour} {
+		snap := weather.WeatherSnapshot{Location: loc, Timestamp: now.Add(-age), Temperature: weather.Float64(age.Hours())}
+		if err := s.SaveSnapshot(ctx, loc, snap); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	check := func(s *FileStore) {
+		latest, err := s.GetLatest(ctx, loc)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !latest.Timestamp.Equal(now) {
+			t.Fatalf("expected the latest snapshot to stay at %v, got %v", now, latest.Timestamp)
+		}
+
+		history, err := s.GetRange(ctx, loc, now.Add(-3*time.Hour), now)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i := 1; i < len(history); i++ {
+			if history[i].Timestamp.Before(history[i-1].Timestamp) {
+				t.Fatalf("history out of order at %d: %v before %v", i, history[i].Timestamp, history[i-1].Timestamp)
+			}
+		}
+		if len(history) != 3 {
+			t.Fatalf("expected 3 snapshots, got %d", len(history))
+		}
+	}
+
+	check(s)
+	if err := s.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s, err = NewFileStore(dir, 10, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+	check(s)
+}
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// LocationRegistry is the set of locations tracked by the scheduler. It can be
+// changed at runtime and is persisted to a JSON file so that changes survive
+// restarts.
+type LocationRegistry struct {
+	path string // empty disables persistence
+
+	mu        sync.RWMutex
+	locations []TrackedLocation // in insertion order
+}
+
+// TrackedLocation is a tracked location and its fetch schedule. It is stored
+// in the registry file as the location's fields plus "schedule".
+type TrackedLocation struct {
+	weather.Location
+	// Schedule is a fetch interval (e.g. "30s") or cron expression; empty
+	// means the scheduler's default interval. See scheduler.ParseSchedule.
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// NewLocationRegistry loads the registry from the file at path. If the file
+// does not exist yet, the registry is seeded with defaults (typically the
+// locations from the configuration). An empty path keeps the registry in memory.
+func NewLocationRegistry(path string, defaults []TrackedLocation) (*LocationRegistry, error) {
+	r := &LocationRegistry{path: path}
+
+	if path != "" {
+		err := r.load()
+		if err == nil {
+			return r, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("load location registry: %w", err)
+		}
+	}
+
+	for _, tl := range defaults {
+		tl.Location = tl.Normalize()
+		if r.indexOf(tl.Key()) < 0 {
+			r.locations = append(r.locations, tl)
+		}
+	}
+	if err := r.save(); err != nil {
+		return nil, fmt.Errorf("save location registry: %w", err)
+	}
+
+	return r, nil
+}
+
+// List returns the tracked locations in the order they were added.
+func (r *LocationRegistry) List() []weather.Location {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	locs := make([]weather.Location, len(r.locations))
+	for i, tl := range r.locations {
+		locs[i] = tl.Location
+	}
+	return locs
+}
+
+// Tracked returns the tracked locations with their schedules, in the order
+// they were added.
+func (r *LocationRegistry) Tracked() []TrackedLocation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tracked := make([]TrackedLocation, len(r.locations))
+	copy(tracked, r.locations)
+	return tracked
+}
+
+// Schedule returns the schedule of the tracked location with the given key,
+// or "" if it uses the default schedule or isn't tracked.
+func (r *LocationRegistry) Schedule(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if i := r.indexOf(key); i >= 0 {
+		return r.locations[i].Schedule
+	}
+	return ""
+}
+
+// SetSchedule changes the schedule of the tracked location with the given key
+// and reports whether it is tracked. The schedule is not validated here.
+func (r *LocationRegistry) SetSchedule(key, schedule string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexOf(key)
+	if i < 0 {
+		return false, nil
+	}
+
+	prev := r.locations[i].Schedule
+	r.locations[i].Schedule = schedule
+	if err := r.save(); err != nil {
+		r.locations[i].Schedule = prev
+		return false, err
+	}
+	return true, nil
+}
+
+// Get returns the tracked location with the given key.
+func (r *LocationRegistry) Get(key string) (weather.Location, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.indexOf(key)
+	if i < 0 {
+		return weather.Location{}, false
+	}
+	return r.locations[i].Location, true
+}
+
+// Add starts tracking loc with the given schedule ("" for the default one),
+// saving both together. It returns the tracked entry and whether it was newly
+// added; adding a location that is already tracked is a no-op and returns the
+// existing entry. The schedule is not validated here.
+func (r *LocationRegistry) Add(loc weather.Location, schedule string) (TrackedLocation, bool, error) {
+	tracked := TrackedLocation{Location: loc.Normalize(), Schedule: schedule}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if i := r.indexOf(tracked.Key()); i >= 0 {
+		return r.locations[i], false, nil
+	}
+
+	r.locations = append(r.locations, tracked)
+	if err := r.save(); err != nil {
+		r.locations = r.locations[:len(r.locations)-1]
+		return TrackedLocation{}, false, err
+	}
+	return tracked, true, nil
+}
+
+// Remove stops tracking the location with the given key and reports whether
+// it was tracked. Stored snapshots for it are left in place.
+func (r *LocationRegistry) Remove(key string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexOf(key)
+	if i < 0 {
+		return false, nil
+	}
+
+	prev := r.locations
+	r.locations = append(append([]TrackedLocation(nil), prev[:i]...), prev[i+1:]...)
+	if err := r.save(); err != nil {
+		r.locations = prev
+		return false, err
+	}
+	return true, nil
+}
+
+// indexOf returns the position of the location with the given key, or -1.
+// Callers must hold r.mu.
+func (r *LocationRegistry) indexOf(key string) int {
+	for i, tl := range r.locations {
+		if tl.Key() == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *LocationRegistry) load() error {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+
+	var locs []TrackedLocation
+	if err := json.Unmarshal(data, &locs); err != nil {
+		return err
+	}
+	for _, tl := range locs {
+		tl.Location = tl.Location.Normalize()
+		r.locations = append(r.locations, tl)
+	}
+	return nil
+}
+
+// save writes the registry atomically. Callers must hold r.mu.
+func (r *LocationRegistry) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.locations, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// TestLocationRegistryPersists verifies that defaults only seed a new registry
+// and that runtime changes survive a reload.
+func TestLocationRegistryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locations.json")
+	defaults := []TrackedLocation{{Location: weather.Location{City: "Paris", Country: "fr"}}}
+
+	r, err := NewLocationRegistry(path, defaults)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, added, err := r.Add(weather.Location{City: "Berlin", Country: "DE"}, "1m"); err != nil || !added {
+		t.Fatalf("expected Berlin to be added, got added=%v err=%v", added, err)
+	}
+	if tracked, added, _ := r.Add(weather.Location{City: "berlin", Country: "de"}, ""); added || tracked.Schedule != "1m" {
+		t.Fatalf("expected duplicate location not to be added, got added=%v %+v", added, tracked)
+	}
+	if found, err := r.SetSchedule("berlin:de", "30s"); err != nil || !found {
+		t.Fatalf("expected Berlin's schedule to be set, got found=%v err=%v", found, err)
+	}
+	if removed, err := r.Remove("paris:fr"); err != nil || !removed {
+		t.Fatalf("expected Paris to be removed, got removed=%v err=%v", removed, err)
+	}
+
+	// Reopening must not bring the removed default back.
+	r, err = NewLocationRegistry(path, defaults)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	locs := r.List()
+	if len(locs) != 1 || locs[0].Key() != "berlin:de" {
+		t.Fatalf("unexpected locations after reload: %+v", locs)
+	}
+	if got := r.Schedule("berlin:de"); got != "30s" {
+		t.Fatalf("expected schedule 30s after reload, got %q", got)
+	}
+}
@@ -1,7 +1,8 @@
 package store
 
 import (
-	"errors"
+	"context"
+	"sort"
 	"sync"
 	"time"
 
@@ -10,7 +11,8 @@ import (
 
 var (
 	// ErrNotFound is returned when no data is available for a given location.
-	ErrNotFound = errors.New("no weather data for location")
+	// It is weather.ErrNotFound, so the service can recognize it too.
+	ErrNotFound = weather.ErrNotFound
 )
 
 // SnapshotHistory holds a time-ordered list of weather snapshots for a location.
@@ -40,8 +42,9 @@ func NewMemoryStore(maxHistory int, maxAge time.Duration) *MemoryStore {
 	}
 }
 
-// SaveSnapshot appends a new snapshot for a location and enforces retention.
-func (s *MemoryStore) SaveSnapshot(loc weather.Location, snapshot weather.WeatherSnapshot) {
+// SaveSnapshot adds a snapshot for a location, keeping the history ordered by
+// timestamp, and enforces retention.
+func (s *MemoryStore) SaveSnapshot(ctx context.Context, loc weather.Location, snapshot weather.WeatherSnapshot) error {
 	key := loc.Key()
 
 	s.mu.Lock()
@@ -53,7 +56,13 @@ func (s *MemoryStore) SaveSnapshot(loc weather.Location, snapshot weather.Weathe
 		s.data[key] = history
 	}
 
-	history.Snapshots = append(history.Snapshots, snapshot)
+	// Snapshots almost always arrive in order; older ones (e.g. backfilled)
+	// are inserted after any with the same timestamp.
+	snaps := history.Snapshots
+	i := sort.Search(len(snaps), func(i int) bool {
+		return snaps[i].Timestamp.After(snapshot.Timestamp)
+	})
+	history.Snapshots = append(snaps[:i], append([]weather.WeatherSnapshot{snapshot}, snaps[i:]...)...)
 
 	// Enforce retention by count.
 	if s.maxHistory > 0 && len(history.Snapshots) > s.maxHistory {
@@ -74,10 +83,11 @@ func (s *MemoryStore) SaveSnapshot(loc weather.Location, snapshot weather.Weathe
 			history.Snapshots = history.Snapshots[i:]
 		}
 	}
+	return nil
 }
 
 // GetLatest returns the most recent snapshot for a location.
-func (s *MemoryStore) GetLatest(loc weather.Location) (weather.WeatherSnapshot, error) {
+func (s *MemoryStore) GetLatest(ctx context.Context, loc weather.Location) (weather.WeatherSnapshot, error) {
 	key := loc.Key()
 
 	s.mu.RLock()
@@ -91,7 +101,7 @@ func (s *MemoryStore) GetLatest(loc weather.Location) (weather.WeatherSnapshot,
 }
 
 // GetRange returns all snapshots for a location between from and to (inclusive).
-func (s *MemoryStore) GetRange(loc weather.Location, from, to time.Time) ([]weather.WeatherSnapshot, error) {
+func (s *MemoryStore) GetRange(ctx context.Context, loc weather.Location, from, to time.Time) ([]weather.WeatherSnapshot, error) {
 	key := loc.Key()
 
 	s.mu.RLock()
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// OnDemandLocations is the set of locations enrolled into the scheduler after
+// being fetched on demand. Unlike LocationRegistry it is kept in memory only:
+// a location is dropped once it has not been requested for the idle TTL.
+type OnDemandLocations struct {
+	idleTTL time.Duration
+	now     func() time.Time // replaced in tests
+
+	mu      sync.Mutex
+	entries map[string]onDemandEntry
+}
+
+type onDemandEntry struct {
+	loc      weather.Location
+	enrolled time.Time
+	lastSeen time.Time
+}
+
+// NewOnDemandLocations creates an empty set whose locations are evicted after
+// idleTTL without requests.
+func NewOnDemandLocations(idleTTL time.Duration) *OnDemandLocations {
+	return &OnDemandLocations{
+		idleTTL: idleTTL,
+		now:     time.Now,
+		entries: make(map[string]onDemandEntry),
+	}
+}
+
+// Enroll starts tracking loc, or marks it as just requested if it is tracked.
+func (o *OnDemandLocations) Enroll(loc weather.Location) {
+	loc = loc.Normalize()
+	now := o.now()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, ok := o.entries[loc.Key()]
+	if !ok {
+		entry = onDemandEntry{loc: loc, enrolled: now}
+		log.Printf("store: enrolled %s on demand for %v after its last request", loc.Key(), o.idleTTL)
+	}
+	entry.lastSeen = now
+	o.entries[loc.Key()] = entry
+}
+
+// Touch marks loc as just requested if it is tracked.
+func (o *OnDemandLocations) Touch(loc weather.Location) {
+	key := loc.Key()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if entry, ok := o.entries[key]; ok {
+		entry.lastSeen = o.now()
+		o.entries[key] = entry
+	}
+}
+
+// List evicts idle locations and returns the rest in the order they were enrolled.
+func (o *OnDemandLocations) List() []weather.Location {
+	now := o.now()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := make([]onDemandEntry, 0, len(o.entries))
+	for key, entry := range o.entries {
+		if now.Sub(entry.lastSeen) >= o.idleTTL {
+			delete(o.entries, key)
+			log.Printf("store: evicted on-demand location %s after %v without requests", key, o.idleTTL)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].enrolled.Equal(entries[j].enrolled) {
+			return entries[i].enrolled.Before(entries[j].enrolled)
+		}
+		return entries[i].loc.Key() < entries[j].loc.Key()
+	})
+
+	locs := make([]weather.Location, len(entries))
+	for i, entry := range entries {
+		locs[i] = entry.loc
+	}
+	return locs
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// TestOnDemandLocationsEvictsIdle verifies that enrolled locations are kept
+// while requested and evicted after the idle TTL without requests.
+func TestOnDemandLocationsEvictsIdle(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	o := NewOnDemandLocations(time.Hour)
+	o.now = func() time.Time { return now }
+
+	oslo := weather.Location{City: "Oslo", Country: "NO"}
+	rome := weather.Location{City: "Rome", Country: "IT"}
+
+	o.Touch(oslo)
+	if locs := o.List(); len(locs) != 0 {
+		t.Fatalf("expected Touch not to enroll, got %v", locs)
+	}
+
+	o.Enroll(oslo)
+	now = now.Add(time.Minute)
+	o.Enroll(rome)
+
+	now = now.Add(50 * time.Minute)
+	o.Touch(oslo)
+
+	now = now.Add(30 * time.Minute)
+	locs := o.List()
+	if len(locs) != 1 || locs[0].Key() != "oslo:no" {
+		t.Fatalf("expected only oslo:no to remain, got %v", locs)
+	}
+
+	now = now.Add(time.Hour)
+	if locs := o.List(); len(locs) != 0 {
+		t.Fatalf("expected every location to be evicted, got %v", locs)
+	}
+}
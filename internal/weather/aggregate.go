@@ -1,10 +1,129 @@
 package weather
 
-import "time"
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+)
 
-// AggregateReadings combines multiple provider readings into a single WeatherSnapshot.
-// Numeric fields are averaged; conditions are selected by majority (or first if tied).
+// Supported aggregation strategies.
+const (
+	StrategyMean        = "mean"
+	StrategyWeighted    = "weighted"
+	StrategyMedian      = "median"
+	StrategyTrimmedMean = "trimmed"
+	StrategyOutlier     = "outlier"
+)
+
+// Aggregator combines multiple provider readings into a single WeatherSnapshot,
+// and multiple providers' daily readings into a single DailyForecast.
+type Aggregator interface {
+	Aggregate(loc Location, readings []ProviderReading) WeatherSnapshot
+	AggregateDaily(loc Location, date time.Time, readings []DailyReading) DailyForecast
+}
+
+// AggregatorOptions configures the strategies built by NewAggregator.
+type AggregatorOptions struct {
+	// Weights per provider name; providers not listed get weight 1.
+	// Used by the weighted and outlier strategies and for condition voting.
+	Weights map[string]float64
+	// TrimFraction is the share of values dropped from each end by the trimmed
+	// mean strategy (0 <= TrimFraction < 0.5).
+	TrimFraction float64
+	// OutlierThreshold is the modified z-score above which a value is rejected
+	// by the outlier strategy (at least MinOutlierThreshold).
+	OutlierThreshold float64
+}
+
+// MinOutlierThreshold is the modified z-score of a value one median absolute
+// deviation from the median. Since at least half of the values lie within
+// that distance, a threshold this high never rejects every value.
+const MinOutlierThreshold = 0.6745
+
+// NewAggregator builds the Aggregator for the named strategy.
+func NewAggregator(strategy string, opts AggregatorOptions) (Aggregator, error) {
+	switch strategy {
+	case "", StrategyMean:
+		return NewMeanAggregator(), nil
+	case StrategyWeighted:
+		return NewWeightedAggregator(opts.Weights), nil
+	case StrategyMedian:
+		return NewMedianAggregator(), nil
+	case StrategyTrimmedMean:
+		if opts.TrimFraction < 0 || opts.TrimFraction >= 0.5 {
+			return nil, fmt.Errorf("trim fraction must be in [0, 0.5), got %v", opts.TrimFraction)
+		}
+		return NewTrimmedMeanAggregator(opts.TrimFraction), nil
+	case StrategyOutlier:
+		if opts.OutlierThreshold < MinOutlierThreshold {
+			return nil, fmt.Errorf("outlier threshold must be at least %v, got %v", MinOutlierThreshold, opts.OutlierThreshold)
+		}
+		return NewOutlierAggregator(opts.OutlierThreshold, opts.Weights), nil
+	default:
+		return nil, fmt.Errorf("unknown aggregation strategy %q", strategy)
+	}
+}
+
+// reduceFunc combines the reported values of one field; weights[i] belongs to
+// values[i]. It is only called with at least one value.
+type reduceFunc func(values, weights []float64) float64
+
+// strategyAggregator applies a reduceFunc to every numeric field, using only
+// the providers that reported it, and a weighted majority vote to the condition.
+type strategyAggregator struct {
+	weights map[string]float64
+	reduce  reduceFunc
+}
+
+// NewMeanAggregator averages every numeric field across providers.
+func NewMeanAggregator() Aggregator {
+	return &strategyAggregator{reduce: weightedMean}
+}
+
+// NewWeightedAggregator computes a weighted mean using per-provider weights.
+func NewWeightedAggregator(weights map[string]float64) Aggregator {
+	return &strategyAggregator{weights: weights, reduce: weightedMean}
+}
+
+// NewMedianAggregator takes the median of every numeric field.
+func NewMedianAggregator() Aggregator {
+	return &strategyAggregator{reduce: func(values, _ []float64) float64 {
+		return median(values)
+	}}
+}
+
+// NewTrimmedMeanAggregator drops the lowest and highest trim fraction of
+// values for each field before averaging the rest.
+func NewTrimmedMeanAggregator(trim float64) Aggregator {
+	return &strategyAggregator{reduce: func(values, _ []float64) float64 {
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+		k := int(float64(len(sorted)) * trim)
+		return weightedMean(sorted[k:len(sorted)-k], nil)
+	}}
+}
+
+// NewOutlierAggregator rejects values whose modified z-score (based on the
+// median absolute deviation) exceeds threshold, then takes the weighted mean
+// of the remaining values.
+func NewOutlierAggregator(threshold float64, weights map[string]float64) Aggregator {
+	return &strategyAggregator{weights: weights, reduce: func(values, weights []float64) float64 {
+		keptValues, keptWeights := rejectOutliers(values, weights, threshold)
+		return weightedMean(keptValues, keptWeights)
+	}}
+}
+
+// AggregateReadings combines multiple provider readings into a single WeatherSnapshot
+// using the plain mean strategy.
 func AggregateReadings(loc Location, readings []ProviderReading) WeatherSnapshot {
+	return NewMeanAggregator().Aggregate(loc, readings)
+}
+
+// Aggregate combines readings into a snapshot. Readings are processed in
+// provider-name order so results (including condition ties) are deterministic.
+func (a *strategyAggregator) Aggregate(loc Location, readings []ProviderReading) WeatherSnapshot {
 	if len(readings) == 0 {
 		return WeatherSnapshot{
 			Location:  loc,
@@ -13,26 +132,24 @@ func AggregateReadings(loc Location, readings []ProviderReading) WeatherSnapshot
 		}
 	}
 
+	sorted := append([]ProviderReading(nil), readings...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ProviderName < sorted[j].ProviderName
+	})
+
 	var (
-		sumTemp     float64
-		sumHumidity float64
-		sumWind     float64
-		sumPressure float64
-		sumPrecip   float64
+		temps, humidity, wind, pressure, precip fieldValues
+		providers                               = make([]ProviderContribution, 0, len(sorted))
+		newestTS                                time.Time
 	)
 
-	conditionCounts := make(map[Condition]int)
-	providers := make([]ProviderContribution, 0, len(readings))
-	var newestTS time.Time
-
-	for _, r := range readings {
-		sumTemp += r.TemperatureC
-		sumHumidity += r.HumidityPct
-		sumWind += r.WindSpeedMS
-		sumPressure += r.PressureHpa
-		sumPrecip += r.PrecipMm
-
-		conditionCounts[r.Condition]++
+	for _, r := range sorted {
+		w := a.weight(r.ProviderName)
+		temps.add(r.TemperatureC, w)
+		humidity.add(r.HumidityPct, w)
+		wind.add(r.WindSpeedMS, w)
+		pressure.add(r.PressureHpa, w)
+		precip.add(r.PrecipMm, w)
 
 		if r.Timestamp.After(newestTS) {
 			newestTS = r.Timestamp
@@ -44,18 +161,6 @@ func AggregateReadings(loc Location, readings []ProviderReading) WeatherSnapshot
 		})
 	}
 
-	n := float64(len(readings))
-
-	// Pick majority condition.
-	bestCond := ConditionUnknown
-	bestCount := 0
-	for cond, count := range conditionCounts {
-		if count > bestCount {
-			bestCount = count
-			bestCond = cond
-		}
-	}
-
 	if newestTS.IsZero() {
 		newestTS = time.Now().UTC()
 	}
@@ -63,12 +168,208 @@ func AggregateReadings(loc Location, readings []ProviderReading) WeatherSnapshot
 	return WeatherSnapshot{
 		Location:    loc,
 		Timestamp:   newestTS,
-		Temperature: sumTemp / n,
-		Humidity:    sumHumidity / n,
-		WindSpeed:   sumWind / n,
-		Pressure:    sumPressure / n,
-		PrecipMM:    sumPrecip / n,
-		Condition:   bestCond,
+		Temperature: temps.reduce(a.reduce),
+		Humidity:    humidity.reduce(a.reduce),
+		WindSpeed:   wind.reduce(a.reduce),
+		Pressure:    pressure.reduce(a.reduce),
+		PrecipMM:    precip.reduce(a.reduce),
+		Condition:   a.voteCondition(sorted),
 		Providers:   providers,
 	}
 }
+
+// AggregateDaily combines daily readings for one date. Each field is reduced
+// separately across providers (e.g. TempMinC is the combined provider minimum),
+// and the dominant condition is chosen by weighted vote.
+func (a *strategyAggregator) AggregateDaily(loc Location, date time.Time, readings []DailyReading) DailyForecast {
+	sorted := append([]DailyReading(nil), readings...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ProviderName < sorted[j].ProviderName
+	})
+
+	var (
+		tempMin, tempMax, tempAvg, wind, precip, pop fieldValues
+		votes                                        = make([]ProviderReading, 0, len(sorted))
+		providers                                    = make([]ProviderContribution, 0, len(sorted))
+	)
+
+	for _, r := range sorted {
+		w := a.weight(r.ProviderName)
+		tempMin.add(r.TempMinC, w)
+		tempMax.add(r.TempMaxC, w)
+		tempAvg.add(r.TempAvgC, w)
+		wind.add(r.MaxWindSpeedMS, w)
+		precip.add(r.TotalPrecipMm, w)
+		pop.add(r.PrecipProbability, w)
+
+		votes = append(votes, ProviderReading{ProviderName: r.ProviderName, Condition: r.Condition})
+		providers = append(providers, ProviderContribution{
+			ProviderName: r.ProviderName,
+			Timestamp:    r.Date,
+		})
+	}
+
+	return DailyForecast{
+		Location:          loc,
+		Date:              date,
+		TempMinC:          tempMin.reduce(a.reduce),
+		TempMaxC:          tempMax.reduce(a.reduce),
+		TempAvgC:          tempAvg.reduce(a.reduce),
+		MaxWindSpeed:      wind.reduce(a.reduce),
+		TotalPrecipMM:     precip.reduce(a.reduce),
+		PrecipProbability: pop.reduce(a.reduce),
+		Condition:         a.voteCondition(votes),
+		Providers:         providers,
+	}
+}
+
+// fieldValues collects the reported values of one field together with the
+// reporting providers' weights. Providers that did not report are skipped.
+type fieldValues struct {
+	values  []float64
+	weights []float64
+}
+
+func (f *fieldValues) add(v *float64, weight float64) {
+	if v == nil {
+		return
+	}
+	f.values = append(f.values, *v)
+	f.weights = append(f.weights, weight)
+}
+
+// reduce returns nil when no provider reported the field.
+func (f *fieldValues) reduce(fn reduceFunc) *float64 {
+	if len(f.values) == 0 {
+		return nil
+	}
+	return Float64(fn(f.values, f.weights))
+}
+
+func (a *strategyAggregator) weight(provider string) float64 {
+	if w, ok := a.weights[provider]; ok {
+		return w
+	}
+	return 1
+}
+
+// voteCondition picks the condition with the highest total provider weight.
+// Providers without a known condition do not vote. Ties go to the condition
+// reported first in the (provider-sorted) readings.
+func (a *strategyAggregator) voteCondition(readings []ProviderReading) Condition {
+	scores := make(map[Condition]float64)
+	var order []Condition
+	for _, r := range readings {
+		if r.Condition == "" || r.Condition == ConditionUnknown {
+			continue
+		}
+		if _, seen := scores[r.Condition]; !seen {
+			order = append(order, r.Condition)
+		}
+		scores[r.Condition] += a.weight(r.ProviderName)
+	}
+
+	bestCond := ConditionUnknown
+	bestScore := 0.0
+	for _, cond := range order {
+		if scores[cond] > bestScore {
+			bestScore = scores[cond]
+			bestCond = cond
+		}
+	}
+	return bestCond
+}
+
+// DominantCondition returns the most frequent known condition in conds,
+// ties going to the one seen first. It is used by providers to summarize
+// sub-daily slots into a day.
+func DominantCondition(conds []Condition) Condition {
+	votes := make([]ProviderReading, len(conds))
+	for i, c := range conds {
+		votes[i].Condition = c
+	}
+	return (&strategyAggregator{}).voteCondition(votes)
+}
+
+// weightedMean returns the weighted mean of values; nil weights means equal weights.
+// If all weights are zero it falls back to the plain mean.
+func weightedMean(values, weights []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	var sum, total float64
+	for i, v := range values {
+		w := 1.0
+		if weights != nil {
+			w = weights[i]
+		}
+		sum += v * w
+		total += w
+	}
+
+	if total == 0 {
+		return weightedMean(values, nil)
+	}
+	return sum / total
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// rejectOutliers drops values whose modified z-score 0.6745*|x-median|/MAD
+// exceeds threshold. When MAD is zero (most values agree exactly), every value
+// that differs from the median is treated as an outlier. Fewer than three
+// values are returned unchanged since there is no majority to compare against.
+// If threshold is so low that every value would be rejected, the values
+// closest to the median are kept.
+func rejectOutliers(values, weights []float64, threshold float64) ([]float64, []float64) {
+	if len(values) < 3 {
+		return values, weights
+	}
+
+	med := median(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - med)
+	}
+	mad := median(deviations)
+
+	keep := func(outlier func(dev float64) bool) ([]float64, []float64) {
+		var keptValues, keptWeights []float64
+		for i, v := range values {
+			if outlier(deviations[i]) {
+				continue
+			}
+			keptValues = append(keptValues, v)
+			if weights != nil {
+				keptWeights = append(keptWeights, weights[i])
+			}
+		}
+		return keptValues, keptWeights
+	}
+
+	keptValues, keptWeights := keep(func(dev float64) bool {
+		if mad > 0 {
+			return 0.6745*dev/mad > threshold
+		}
+		return dev > 0
+	})
+	if len(keptValues) == 0 {
+		closest := slices.Min(deviations)
+		keptValues, keptWeights = keep(func(dev float64) bool { return dev > closest })
+	}
+	return keptValues, keptWeights
+}
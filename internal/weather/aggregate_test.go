@@ -0,0 +1,149 @@
+package weather
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// TestAggregationStrategies verifies the numeric result of each strategy on
+// a reading set where one provider reports a bogus 0 °C.
+func TestAggregationStrategies(t *testing.T) {
+	readings := []ProviderReading{
+		{ProviderName: "a", TemperatureC: Float64(10), Condition: ConditionRain},
+		{ProviderName: "b", TemperatureC: Float64(11), Condition: ConditionClear},
+		{ProviderName: "c", TemperatureC: Float64(12), Condition: ConditionRain},
+		{ProviderName: "d", TemperatureC: Float64(0), Condition: ConditionClear},
+	}
+
+	cases := []struct {
+		strategy string
+		opts     AggregatorOptions
+		want     float64
+	}{
+		{StrategyMean, AggregatorOptions{}, 8.25},
+		{StrategyWeighted, AggregatorOptions{Weights: map[string]float64{"c": 3, "d": 0}}, 11.4},
+		{StrategyMedian, AggregatorOptions{}, 10.5},
+		{StrategyTrimmedMean, AggregatorOptions{TrimFraction: 0.25}, 10.5},
+		{StrategyOutlier, AggregatorOptions{OutlierThreshold: 3.5}, 11},
+	}
+
+	for _, tc := range cases {
+		agg, err := NewAggregator(tc.strategy, tc.opts)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.strategy, err)
+		}
+		snap := agg.Aggregate(Location{City: "Paris", Country: "FR"}, readings)
+		if snap.Temperature == nil || !approxEqual(*snap.Temperature, tc.want) {
+			t.Fatalf("%s: expected temperature %v, got %v", tc.strategy, tc.want, snap.Temperature)
+		}
+	}
+}
+
+// TestAggregateSkipsMissingFields verifies that fields a provider did not
+// report are neither averaged in as zero nor invented when nobody reported them.
+func TestAggregateSkipsMissingFields(t *testing.T) {
+	readings := []ProviderReading{
+		{ProviderName: "openmeteo", TemperatureC: Float64(20), Condition: ConditionUnknown},
+		{ProviderName: "openweathermap", TemperatureC: Float64(22), HumidityPct: Float64(60), Condition: ConditionClear},
+	}
+
+	snap := AggregateReadings(Location{}, readings)
+	if snap.Temperature == nil || !approxEqual(*snap.Temperature, 21) {
+		t.Fatalf("expected temperature 21, got %v", snap.Temperature)
+	}
+	if snap.Humidity == nil || !approxEqual(*snap.Humidity, 60) {
+		t.Fatalf("expected humidity 60, got %v", snap.Humidity)
+	}
+	if snap.Pressure != nil {
+		t.Fatalf("expected nil pressure, got %v", *snap.Pressure)
+	}
+	if snap.Condition != ConditionClear {
+		t.Fatalf("expected condition %q, got %q", ConditionClear, snap.Condition)
+	}
+}
+
+// TestAggregateConditionTieBreakIsDeterministic verifies that a tied vote is
+// resolved independently of the order readings arrive in.
+func TestAggregateConditionTieBreakIsDeterministic(t *testing.T) {
+	forward := []ProviderReading{
+		{ProviderName: "openweathermap", Condition: ConditionRain},
+		{ProviderName: "weatherapi", Condition: ConditionCloudy},
+	}
+	reverse := []ProviderReading{forward[1], forward[0]}
+
+	for i := 0; i < 20; i++ {
+		if got := AggregateReadings(Location{}, forward).Condition; got != ConditionRain {
+			t.Fatalf("expected %q, got %q", ConditionRain, got)
+		}
+		if got := AggregateReadings(Location{}, reverse).Condition; got != ConditionRain {
+			t.Fatalf("expected %q, got %q", ConditionRain, got)
+		}
+	}
+}
+
+// TestNewAggregatorRejectsInvalidConfig verifies configuration validation.
+func TestNewAggregatorRejectsInvalidConfig(t *testing.T) {
+	if _, err := NewAggregator("bogus", AggregatorOptions{}); err == nil {
+		t.Fatal("expected error for unknown strategy")
+	}
+	if _, err := NewAggregator(StrategyTrimmedMean, AggregatorOptions{TrimFraction: 0.5}); err == nil {
+		t.Fatal("expected error for trim fraction 0.5")
+	}
+	if _, err := NewAggregator(StrategyOutlier, AggregatorOptions{}); err == nil {
+		t.Fatal("expected error for zero outlier threshold")
+	}
+	if _, err := NewAggregator(StrategyOutlier, AggregatorOptions{OutlierThreshold: 0.5}); err == nil {
+		t.Fatal("expected error for an outlier threshold below MinOutlierThreshold")
+	}
+}
+
+// TestOutlierRejectionKeepsClosestValues verifies that a threshold low
+// enough to reject every value keeps the values closest to the median rather
+// than reporting a made-up zero.
+func TestOutlierRejectionKeepsClosestValues(t *testing.T) {
+	var readings []ProviderReading
+	for i, temp := range []float64{1, 2, 3, 4} {
+		readings = append(readings, ProviderReading{ProviderName: string(rune('a' + i)), TemperatureC: Float64(temp)})
+	}
+
+	snap := NewOutlierAggregator(0.3, nil).Aggregate(Location{City: "Paris", Country: "FR"}, readings)
+	if snap.Temperature == nil || !approxEqual(*snap.Temperature, 2.5) {
+		t.Fatalf("expected temperature 2.5, got %v", snap.Temperature)
+	}
+}
+
+// TestAggregateDailyCombinesLikeForLike verifies that daily readings are
+// combined field by field and that unreported fields stay nil.
+func TestAggregateDailyCombinesLikeForLike(t *testing.T) {
+	date := time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)
+	readings := []DailyReading{
+		{ProviderName: "openweathermap", Date: date, TempMinC: Float64(2), TempMaxC: Float64(8), Condition: ConditionRain},
+		{ProviderName: "weatherapi", Date: date, TempMinC: Float64(4), TempMaxC: Float64(10), TotalPrecipMm: Float64(3), Condition: ConditionRain},
+		{ProviderName: "openmeteo", Date: date, TempMinC: Float64(3), TempMaxC: Float64(9), Condition: ConditionCloudy},
+	}
+
+	day := NewMeanAggregator().AggregateDaily(Location{}, date, readings)
+	if day.TempMinC == nil || !approxEqual(*day.TempMinC, 3) {
+		t.Fatalf("expected min temperature 3, got %v", day.TempMinC)
+	}
+	if day.TempMaxC == nil || !approxEqual(*day.TempMaxC, 9) {
+		t.Fatalf("expected max temperature 9, got %v", day.TempMaxC)
+	}
+	if day.TotalPrecipMM == nil || !approxEqual(*day.TotalPrecipMM, 3) {
+		t.Fatalf("expected total precipitation 3, got %v", day.TotalPrecipMM)
+	}
+	if day.TempAvgC != nil {
+		t.Fatalf("expected nil average temperature, got %v", *day.TempAvgC)
+	}
+	if day.Condition != ConditionRain {
+		t.Fatalf("expected condition %q, got %q", ConditionRain, day.Condition)
+	}
+	if !day.Date.Equal(date) || len(day.Providers) != 3 {
+		t.Fatalf("unexpected date or providers: %+v", day)
+	}
+}
@@ -0,0 +1,105 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Backfill fills the history of loc between from and to with hourly
+// snapshots aggregated from the providers that support historical data (see
+// HistoryProvider). Hours that already have a snapshot are left alone, and
+// backfilled snapshots are stored without notifying live subscribers. It
+// returns the number of snapshots stored; if every history provider fails,
+// the returned error wraps their *ProviderError values.
+func (s *Service) Backfill(ctx context.Context, loc Location, from, to time.Time) (int, error) {
+	from = from.UTC().Truncate(time.Hour)
+	to = to.UTC()
+
+	providers, aggregator, _ := s.components()
+
+	var historical []HistoryProvider
+	for _, p := range providers {
+		if hp, ok := p.(HistoryProvider); ok {
+			historical = append(historical, hp)
+		}
+	}
+	if len(historical) == 0 || !from.Before(to) {
+		return 0, nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		byHour   = make(map[time.Time][]ProviderReading)
+		failures []*ProviderError
+	)
+
+	for _, hp := range historical {
+		hp := hp
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			readings, err := hp.FetchHistory(ctx, loc, from, to)
+			if err != nil {
+				log.Printf("provider %s history fetch failed for %s: %v", hp.Name(), loc.Key(), err)
+				mu.Lock()
+				failures = append(failures, AsProviderError(hp.Name(), OperationHistory, err))
+				mu.Unlock()
+				return
+			}
+
+			mu.Lock()
+			for _, r := range readings {
+				hour := r.Timestamp.UTC().Truncate(time.Hour)
+				if hour.Before(from) || !hour.Before(to) {
+					continue
+				}
+				byHour[hour] = append(byHour[hour], r)
+			}
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	if len(byHour) == 0 {
+		if len(failures) == len(historical) {
+			return 0, noDataError("no historical data for "+loc.Key(), failures)
+		}
+		return 0, nil
+	}
+
+	// Hours that already have a snapshot, e.g. from scheduled fetches.
+	covered := make(map[time.Time]bool)
+	existing, err := s.store.GetRange(ctx, loc, from, to)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
+	for _, snap := range existing {
+		covered[snap.Timestamp.UTC().Truncate(time.Hour)] = true
+	}
+
+	hours := make([]time.Time, 0, len(byHour))
+	for hour := range byHour {
+		if !covered[hour] {
+			hours = append(hours, hour)
+		}
+	}
+	sort.Slice(hours, func(i, j int) bool {
+		return hours[i].Before(hours[j])
+	})
+
+	for i, hour := range hours {
+		snapshot := aggregator.Aggregate(loc, byHour[hour])
+		snapshot.Timestamp = hour
+		if err := s.store.SaveSnapshot(ctx, loc, snapshot); err != nil {
+			return i, err
+		}
+	}
+	return len(hours), nil
+}
@@ -0,0 +1,102 @@
+package weather
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sliceStore is a minimal Store keeping snapshots in insertion order.
+type sliceStore struct {
+	mu    sync.Mutex
+	snaps []WeatherSnapshot
+}
+
+func (s *sliceStore) SaveSnapshot(ctx context.Context, loc Location, snapshot WeatherSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snaps = append(s.snaps, snapshot)
+	return nil
+}
+
+func (s *sliceStore) GetLatest(ctx context.Context, loc Location) (WeatherSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.snaps) == 0 {
+		return WeatherSnapshot{}, ErrNotFound
+	}
+	return s.snaps[len(s.snaps)-1], nil
+}
+
+func (s *sliceStore) GetRange(ctx context.Context, loc Location, from, to time.Time) ([]WeatherSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []WeatherSnapshot
+	for _, snap := range s.snaps {
+		if !snap.Timestamp.Before(from) && !snap.Timestamp.After(to) {
+			result = append(result, snap)
+		}
+	}
+	if len(result) == 0 {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
+
+// historyProvider returns an hourly reading with a fixed temperature for
+// every hour of the requested window.
+type historyProvider struct {
+	name string
+	temp float64
+}
+
+func (p historyProvider) Name() string { return p.name }
+
+func (p historyProvider) Fetch(ctx context.Context, loc Location) (ProviderReading, error) {
+	return ProviderReading{}, nil
+}
+
+func (p historyProvider) FetchHistory(ctx context.Context, loc Location, from, to time.Time) ([]ProviderReading, error) {
+	var readings []ProviderReading
+	for ts := from; ts.Before(to); ts = ts.Add(time.Hour) {
+		readings = append(readings, ProviderReading{ProviderName: p.name, Timestamp: ts, TemperatureC: Float64(p.temp)})
+	}
+	return readings, nil
+}
+
+// TestBackfillAggregatesMissingHours verifies that Backfill stores one
+// aggregated snapshot per hour, oldest first, skipping hours that already
+// have a snapshot.
+func TestBackfillAggregatesMissingHours(t *testing.T) {
+	ctx := context.Background()
+	loc := Location{City: "Paris", Country: "FR"}
+	to := time.Now().UTC().Truncate(time.Hour)
+	from := to.Add(-4 * time.Hour)
+
+	st := &sliceStore{}
+	existing := WeatherSnapshot{Location: loc, Timestamp: from.Add(time.Hour + 15*time.Minute), Temperature: Float64(99)}
+	if err := st.SaveSnapshot(ctx, loc, existing); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	svc := NewService(st, []Provider{historyProvider{name: "a", temp: 10}, historyProvider{name: "b", temp: 14}})
+	n, err := svc.Backfill(ctx, loc, from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 backfilled hours, got %d", n)
+	}
+
+	backfilled := st.snaps[1:]
+	for i, want := range []time.Time{from, from.Add(2 * time.Hour), from.Add(3 * time.Hour)} {
+		snap := backfilled[i]
+		if !snap.Timestamp.Equal(want) {
+			t.Fatalf("snapshot %d: expected timestamp %v, got %v", i, want, snap.Timestamp)
+		}
+		if snap.Temperature == nil || *snap.Temperature != 12 {
+			t.Fatalf("snapshot %d: expected mean temperature 12, got %v", i, snap.Temperature)
+		}
+	}
+}
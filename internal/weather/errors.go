@@ -0,0 +1,118 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrNotFound is returned by a Store when it has no snapshots for a location
+// (or none in the requested range).
+var ErrNotFound = errors.New("no weather data for location")
+
+// Provider operations, as reported in ProviderError.
+const (
+	OperationCurrent  = "current"
+	OperationForecast = "forecast"
+	OperationHourly   = "hourly"
+	OperationHistory  = "history"
+)
+
+// ProviderError describes a failed provider call. Providers return it (possibly
+// wrapped) so that callers can branch on the failure with errors.As.
+type ProviderError struct {
+	Provider  string `json:"provider"`
+	Operation string `json:"operation"`
+	// StatusCode is the upstream HTTP status, if a response was received.
+	StatusCode int `json:"statusCode,omitempty"`
+	// Retryable reports whether the failure is transient, i.e. the same call
+	// may succeed later (rate limits, server errors, timeouts, open breakers).
+	Retryable bool `json:"retryable"`
+	// Code and Message come from the upstream error body where available.
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+
+	Err error `json:"-"`
+}
+
+func (e *ProviderError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "provider %s %s failed", e.Provider, e.Operation)
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, " with HTTP %d", e.StatusCode)
+	}
+	if e.Code != "" {
+		fmt.Fprintf(&b, " (code %s)", e.Code)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&b, ": %s", e.Message)
+	}
+	return b.String()
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// AsProviderError returns err as a *ProviderError, wrapping errors that
+// aren't one already (e.g. response decoding failures) with the given provider
+// and operation.
+func AsProviderError(provider, operation string, err error) *ProviderError {
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe
+	}
+	return &ProviderError{
+		Provider:  provider,
+		Operation: operation,
+		Retryable: errors.Is(err, context.DeadlineExceeded),
+		Message:   ErrorMessage(err),
+		Err:       err,
+	}
+}
+
+// ErrorMessage returns err's message without the query of the request URL
+// that transport errors (*url.Error) quote, since providers pass their API
+// keys as query parameters. Messages of provider errors are shown to clients.
+func ErrorMessage(err error) string {
+	msg := err.Error()
+
+	var ue *url.Error
+	if !errors.As(err, &ue) {
+		return msg
+	}
+	base, _, hasQuery := strings.Cut(ue.URL, "?")
+	if !hasQuery {
+		return msg
+	}
+	msg = strings.ReplaceAll(msg, ue.URL, base)
+	if strings.Contains(msg, ue.URL[len(base):]) {
+		// Quoted differently than expected; keep only the parts that are known
+		// not to carry the URL.
+		msg = fmt.Sprintf("%s %s: %v", ue.Op, base, ue.Err)
+	}
+	return msg
+}
+
+// ProviderErrors returns every ProviderError in err's tree, including those
+// combined with errors.Join.
+func ProviderErrors(err error) []*ProviderError {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *ProviderError:
+		return []*ProviderError{e}
+	case interface{ Unwrap() []error }:
+		var out []*ProviderError
+		for _, inner := range e.Unwrap() {
+			out = append(out, ProviderErrors(inner)...)
+		}
+		return out
+	case interface{ Unwrap() error }:
+		return ProviderErrors(e.Unwrap())
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,166 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// forecastTimeout bounds provider forecast calls, including those made on
+// behalf of the cache, which may outlive the request that triggered them.
+const forecastTimeout = 10 * time.Second
+
+// CacheStatus reports how a forecast was served from the forecast cache.
+type CacheStatus string
+
+const (
+	// CacheDisabled means no forecast cache is configured.
+	CacheDisabled CacheStatus = ""
+	// CacheHit means every provider's forecast was fresh in the cache.
+	CacheHit CacheStatus = "HIT"
+	// CacheStale means at least one provider's forecast was past its TTL and
+	// was served while being refreshed in the background.
+	CacheStale CacheStatus = "STALE"
+	// CacheMiss means at least one provider was called synchronously.
+	CacheMiss CacheStatus = "MISS"
+)
+
+// merge combines the statuses of two provider lookups into the status of the
+// whole response: any miss makes it a MISS, otherwise any stale entry a STALE.
+func (s CacheStatus) merge(o CacheStatus) CacheStatus {
+	rank := map[CacheStatus]int{CacheDisabled: 0, CacheHit: 1, CacheStale: 2, CacheMiss: 3}
+	if rank[o] > rank[s] {
+		return o
+	}
+	return s
+}
+
+// ForecastCacheConfig configures the provider forecast cache.
+type ForecastCacheConfig struct {
+	// TTL is how long a provider's forecast is served without refetching.
+	TTL time.Duration
+	// ProviderTTLs overrides TTL by provider name.
+	ProviderTTLs map[string]time.Duration
+	// StaleWhileRevalidate is how long past its TTL an entry is still served
+	// while a background refresh runs. Zero disables stale serving.
+	StaleWhileRevalidate time.Duration
+}
+
+// WithForecastCache caches each provider's daily and hourly forecasts per
+// location and horizon, coalescing concurrent identical calls. A zero TTL
+// leaves caching disabled.
+func WithForecastCache(cfg ForecastCacheConfig) ServiceOption {
+	return func(s *Service) {
+		if cfg.TTL > 0 {
+			s.forecastCache = newForecastCache(cfg)
+		}
+	}
+}
+
+type forecastCacheEntry struct {
+	value     any
+	fetchedAt time.Time
+	ttl       time.Duration
+}
+
+// forecastCache holds raw provider forecasts so that aggregation still runs
+// per request (e.g. the hourly grid moves with the clock).
+type forecastCache struct {
+	cfg   ForecastCacheConfig
+	group singleflight.Group
+	now   func() time.Time // replaced in tests
+
+	mu      sync.Mutex
+	entries map[string]forecastCacheEntry
+}
+
+func newForecastCache(cfg ForecastCacheConfig) *forecastCache {
+	return &forecastCache{cfg: cfg, now: time.Now, entries: make(map[string]forecastCacheEntry)}
+}
+
+func (c *forecastCache) ttl(provider string) time.Duration {
+	if ttl, ok := c.cfg.ProviderTTLs[provider]; ok {
+		return ttl
+	}
+	return c.cfg.TTL
+}
+
+// forecastCacheKey identifies one provider call: kind is "daily" or
+// "hourly" and n the number of days or hours.
+func forecastCacheKey(kind, provider string, loc Location, n int) string {
+	return fmt.Sprintf("%s|%s|%s|%d", kind, provider, loc.Key(), n)
+}
+
+// cachedFetch returns the provider result for key from c, calling load on a
+// miss. Concurrent misses for the same key share a single load, which runs on
+// a context detached from any one caller so that a caller giving up does not
+// fail the others. With a nil cache, load is called directly.
+func cachedFetch[T any](ctx context.Context, c *forecastCache, provider, key string, load func(context.Context) (T, error)) (T, CacheStatus, error) {
+	if c == nil {
+		v, err := load(ctx)
+		return v, CacheDisabled, err
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if ok {
+		age := c.now().Sub(entry.fetchedAt)
+		if age < entry.ttl {
+			return entry.value.(T), CacheHit, nil
+		}
+		if age < entry.ttl+c.cfg.StaleWhileRevalidate {
+			// Refresh in the background; the result channel is buffered, so
+			// nobody needs to receive from it.
+			c.group.DoChan(key, cacheLoader(c, context.Background(), provider, key, load))
+			return entry.value.(T), CacheStale, nil
+		}
+	}
+
+	ch := c.group.DoChan(key, cacheLoader(c, context.WithoutCancel(ctx), provider, key, load))
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			var zero T
+			return zero, CacheMiss, res.Err
+		}
+		return res.Val.(T), CacheMiss, nil
+	case <-ctx.Done():
+		var zero T
+		return zero, CacheMiss, ctx.Err()
+	}
+}
+
+// cacheLoader wraps load for the singleflight group, storing successful results.
+// Failures are not cached; a stale entry stays in place until it expires.
+func cacheLoader[T any](c *forecastCache, ctx context.Context, provider, key string, load func(context.Context) (T, error)) func() (any, error) {
+	return func() (any, error) {
+		ctx, cancel := context.WithTimeout(ctx, forecastTimeout)
+		defer cancel()
+
+		v, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.store(key, forecastCacheEntry{value: v, fetchedAt: c.now(), ttl: c.ttl(provider)})
+		return v, nil
+	}
+}
+
+// store saves an entry and drops entries too old to be served at all.
+func (c *forecastCache) store(key string, entry forecastCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for k, e := range c.entries {
+		if now.Sub(e.fetchedAt) >= e.ttl+c.cfg.StaleWhileRevalidate {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = entry
+}
@@ -0,0 +1,144 @@
+package weather
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestCachedFetchCoalescesConcurrentMisses verifies that concurrent misses for
+// the same key share one load and that the result is then served as a hit.
+func TestCachedFetchCoalescesConcurrentMisses(t *testing.T) {
+	c := newForecastCache(ForecastCacheConfig{TTL: time.Minute})
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]int, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, status, err := cachedFetch(context.Background(), c, "p", "key", load)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if status != CacheMiss {
+				t.Errorf("expected %q, got %q", CacheMiss, status)
+			}
+			results[i] = v
+		}(i)
+	}
+
+	// Give every caller time to join the in-flight load.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected 1 upstream call, got %d", n)
+	}
+	for i, v := range results {
+		if v != 42 {
+			t.Fatalf("caller %d: expected 42, got %d", i, v)
+		}
+	}
+
+	v, status, err := cachedFetch(context.Background(), c, "p", "key", load)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status != CacheHit || v != 42 {
+		t.Fatalf("expected cached 42 (%q), got %d (%q)", CacheHit, v, status)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected no further upstream calls, got %d", n)
+	}
+}
+
+// TestCachedFetchServesStaleWhileRevalidating verifies that an expired entry
+// within the stale window is returned immediately while it is refreshed, and
+// that failed loads are not cached.
+func TestCachedFetchServesStaleWhileRevalidating(t *testing.T) {
+	c := newForecastCache(ForecastCacheConfig{
+		TTL:                  time.Hour,
+		ProviderTTLs:         map[string]time.Duration{"p": time.Minute},
+		StaleWhileRevalidate: time.Hour,
+	})
+
+	var mu sync.Mutex
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	var calls atomic.Int32
+	refreshed := make(chan struct{})
+	load := func(ctx context.Context) (int, error) {
+		n := calls.Add(1)
+		if n == 2 {
+			defer close(refreshed)
+		}
+		return int(n), nil
+	}
+
+	if v, status, _ := cachedFetch(context.Background(), c, "p", "key", load); v != 1 || status != CacheMiss {
+		t.Fatalf("expected 1 (%q), got %d (%q)", CacheMiss, v, status)
+	}
+
+	mu.Lock()
+	now = now.Add(2 * time.Minute)
+	mu.Unlock()
+
+	v, status, err := cachedFetch(context.Background(), c, "p", "key", load)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v != 1 || status != CacheStale {
+		t.Fatalf("expected stale 1 (%q), got %d (%q)", CacheStale, v, status)
+	}
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("expected a background refresh")
+	}
+	// The refresh stores its result just after load returns.
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		c.mu.Lock()
+		stored := c.entries["key"].value == 2
+		c.mu.Unlock()
+		if stored {
+			break
+		}
+	}
+
+	if v, status, _ := cachedFetch(context.Background(), c, "p", "key", load); v != 2 || status != CacheHit {
+		t.Fatalf("expected refreshed 2 (%q), got %d (%q)", CacheHit, v, status)
+	}
+
+	failing := func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		return 0, context.DeadlineExceeded
+	}
+	before := calls.Load()
+	for i := 0; i < 2; i++ {
+		if _, _, err := cachedFetch(context.Background(), c, "p", "other", failing); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	if n := calls.Load() - before; n != 2 {
+		t.Fatalf("expected failures not to be cached (2 calls), got %d", n)
+	}
+}
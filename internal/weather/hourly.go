@@ -0,0 +1,91 @@
+package weather
+
+import (
+	"sort"
+	"time"
+)
+
+// maxInterpolationGap is the largest gap between two provider slots that is
+// bridged by interpolation when aligning readings onto the hourly grid.
+const maxInterpolationGap = 3 * time.Hour
+
+// hourlyGrid returns `hours` consecutive UTC hour marks starting at the hour containing now.
+func hourlyGrid(now time.Time, hours int) []time.Time {
+	start := now.UTC().Truncate(time.Hour)
+	grid := make([]time.Time, hours)
+	for i := range grid {
+		grid[i] = start.Add(time.Duration(i) * time.Hour)
+	}
+	return grid
+}
+
+// alignToGrid maps one provider's readings onto the grid. A grid hour gets the
+// reading at exactly that time if there is one; otherwise the surrounding
+// readings are linearly interpolated if they are at most maxInterpolationGap
+// apart. Hours outside the provider's coverage are left out of the result map.
+func alignToGrid(readings []ProviderReading, grid []time.Time) map[time.Time]ProviderReading {
+	sorted := append([]ProviderReading(nil), readings...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	aligned := make(map[time.Time]ProviderReading, len(grid))
+	i := 0
+	for _, g := range grid {
+		// Advance to the last reading at or before g.
+		for i+1 < len(sorted) && !sorted[i+1].Timestamp.After(g) {
+			i++
+		}
+		if len(sorted) == 0 || sorted[i].Timestamp.After(g) {
+			continue
+		}
+
+		prev := sorted[i]
+		if prev.Timestamp.Equal(g) {
+			prev.Timestamp = g
+			aligned[g] = prev
+			continue
+		}
+		if i+1 >= len(sorted) {
+			continue
+		}
+
+		next := sorted[i+1]
+		gap := next.Timestamp.Sub(prev.Timestamp)
+		if gap > maxInterpolationGap {
+			continue
+		}
+
+		aligned[g] = interpolateReading(prev, next, float64(g.Sub(prev.Timestamp))/float64(gap), g)
+	}
+
+	return aligned
+}
+
+// interpolateReading blends two readings at fraction f (0 = a, 1 = b). Numeric
+// fields are only interpolated when both readings report them; the condition is
+// taken from the nearer reading.
+func interpolateReading(a, b ProviderReading, f float64, ts time.Time) ProviderReading {
+	lerp := func(x, y *float64) *float64 {
+		if x == nil || y == nil {
+			return nil
+		}
+		return Float64(*x + f*(*y-*x))
+	}
+
+	cond := a.Condition
+	if f > 0.5 {
+		cond = b.Condition
+	}
+
+	return ProviderReading{
+		ProviderName: a.ProviderName,
+		Timestamp:    ts,
+		TemperatureC: lerp(a.TemperatureC, b.TemperatureC),
+		HumidityPct:  lerp(a.HumidityPct, b.HumidityPct),
+		WindSpeedMS:  lerp(a.WindSpeedMS, b.WindSpeedMS),
+		PressureHpa:  lerp(a.PressureHpa, b.PressureHpa),
+		PrecipMm:     lerp(a.PrecipMm, b.PrecipMm),
+		Condition:    cond,
+	}
+}
@@ -0,0 +1,70 @@
+package weather
+
+import (
+	"testing"
+	"time"
+)
+
+// TestAlignToGridInterpolatesThreeHourSlots verifies that 3-hour provider
+// slots are interpolated onto the hourly grid and that hours outside the
+// provider's coverage are skipped.
+func TestAlignToGridInterpolatesThreeHourSlots(t *testing.T) {
+	base := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	readings := []ProviderReading{
+		{ProviderName: "openweathermap", Timestamp: base.Add(3 * time.Hour), TemperatureC: Float64(16), Condition: ConditionRain},
+		{ProviderName: "openweathermap", Timestamp: base, TemperatureC: Float64(10), HumidityPct: Float64(50), Condition: ConditionClear},
+	}
+
+	grid := hourlyGrid(base.Add(-time.Hour).Add(30*time.Minute), 6)
+	aligned := alignToGrid(readings, grid)
+
+	if _, ok := aligned[base.Add(-time.Hour)]; ok {
+		t.Fatal("expected no reading before the first slot")
+	}
+	if _, ok := aligned[base.Add(4*time.Hour)]; ok {
+		t.Fatal("expected no reading after the last slot")
+	}
+
+	cases := []struct {
+		offset time.Duration
+		temp   float64
+		cond   Condition
+	}{
+		{0, 10, ConditionClear},
+		{time.Hour, 12, ConditionClear},
+		{2 * time.Hour, 14, ConditionRain},
+		{3 * time.Hour, 16, ConditionRain},
+	}
+	for _, tc := range cases {
+		r, ok := aligned[base.Add(tc.offset)]
+		if !ok {
+			t.Fatalf("+%v: expected aligned reading", tc.offset)
+		}
+		if r.TemperatureC == nil || !approxEqual(*r.TemperatureC, tc.temp) {
+			t.Fatalf("+%v: expected temperature %v, got %v", tc.offset, tc.temp, r.TemperatureC)
+		}
+		if r.Condition != tc.cond {
+			t.Fatalf("+%v: expected condition %q, got %q", tc.offset, tc.cond, r.Condition)
+		}
+	}
+
+	// Humidity is only reported by one of the two slots, so it cannot be interpolated.
+	if r := aligned[base.Add(time.Hour)]; r.HumidityPct != nil {
+		t.Fatalf("expected nil humidity, got %v", *r.HumidityPct)
+	}
+}
+
+// TestAlignToGridDoesNotBridgeLargeGaps verifies that slots further apart than
+// maxInterpolationGap are not interpolated.
+func TestAlignToGridDoesNotBridgeLargeGaps(t *testing.T) {
+	base := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	readings := []ProviderReading{
+		{Timestamp: base, TemperatureC: Float64(0)},
+		{Timestamp: base.Add(6 * time.Hour), TemperatureC: Float64(6)},
+	}
+
+	aligned := alignToGrid(readings, hourlyGrid(base, 7))
+	if len(aligned) != 2 {
+		t.Fatalf("expected only the 2 exact slots, got %d", len(aligned))
+	}
+}
@@ -0,0 +1,166 @@
+package weather
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// subscriptionBuffer is the number of undelivered events a subscriber may
+	// lag behind before further events to it are dropped.
+	subscriptionBuffer = 16
+	// replayBuffer is the number of recent events kept for SubscribeAfter.
+	replayBuffer = 1024
+)
+
+// SnapshotEvent is published whenever a new snapshot is saved.
+type SnapshotEvent struct {
+	// Seq orders events across all locations. It starts from the hub's
+	// creation time in microseconds, so it also grows across restarts.
+	Seq      uint64
+	Location Location
+	Snapshot WeatherSnapshot
+}
+
+// Hub is an in-process pub/sub hub for saved snapshots.
+type Hub struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+	seq    uint64          // the sequence number of the latest event
+	recent []SnapshotEvent // the latest events, oldest first
+}
+
+// NewHub creates an empty Hub.
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{}), seq: uint64(time.Now().UnixMicro())}
+}
+
+// Subscription receives events for a set of locations until it is closed.
+type Subscription struct {
+	// C delivers events; it is closed when the subscription or hub is closed.
+	C <-chan SnapshotEvent
+
+	ch   chan SnapshotEvent
+	keys map[string]struct{} // nil means all locations
+	hub  *Hub
+	once sync.Once
+}
+
+// Subscribe registers a subscriber for the given locations; with no locations
+// it receives events for every location. Slow subscribers drop events rather
+// than blocking publishers.
+func (h *Hub) Subscribe(locs ...Location) *Subscription {
+	sub := h.newSubscription(locs)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.register(sub)
+	return sub
+}
+
+// SubscribeAfter is Subscribe for a client resuming after the event with
+// sequence number seq: it also returns the kept events for locs published
+// since then, with no gap or overlap between them and the subscription. A
+// seq ahead of this hub (e.g. from before a restart with the clock set back)
+// gets every kept event for locs.
+func (h *Hub) SubscribeAfter(seq uint64, locs ...Location) (*Subscription, []SnapshotEvent) {
+	sub := h.newSubscription(locs)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if seq > h.seq {
+		seq = 0
+	}
+	var replay []SnapshotEvent
+	for _, ev := range h.recent {
+		if ev.Seq > seq && sub.wants(ev.Location.Key()) {
+			replay = append(replay, ev)
+		}
+	}
+	h.register(sub)
+	return sub, replay
+}
+
+// newSubscription creates an unregistered subscription for locs.
+func (h *Hub) newSubscription(locs []Location) *Subscription {
+	ch := make(chan SnapshotEvent, subscriptionBuffer)
+	sub := &Subscription{C: ch, ch: ch, hub: h}
+
+	if len(locs) > 0 {
+		sub.keys = make(map[string]struct{}, len(locs))
+		for _, loc := range locs {
+			sub.keys[loc.Key()] = struct{}{}
+		}
+	}
+	return sub
+}
+
+// register adds sub to the hub, or closes it if the hub is closed. Callers
+// must hold h.mu.
+func (h *Hub) register(sub *Subscription) {
+	if h.closed {
+		sub.once.Do(func() { close(sub.ch) })
+		return
+	}
+	h.subs[sub] = struct{}{}
+}
+
+// Publish numbers an event, keeps it for SubscribeAfter and delivers it to
+// every subscriber interested in loc.
+func (h *Hub) Publish(loc Location, snapshot WeatherSnapshot) {
+	key := loc.Key()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	event := SnapshotEvent{Seq: h.seq, Location: loc, Snapshot: snapshot}
+	h.recent = append(h.recent, event)
+	if len(h.recent) > replayBuffer {
+		h.recent = h.recent[len(h.recent)-replayBuffer:]
+	}
+
+	for sub := range h.subs {
+		if !sub.wants(key) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			log.Printf("hub: dropping snapshot event for %s; subscriber is not keeping up", key)
+		}
+	}
+}
+
+// Close closes every subscription and rejects new ones.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		sub.once.Do(func() { close(sub.ch) })
+	}
+}
+
+// wants reports whether the subscription is for the location key.
+func (s *Subscription) wants(key string) bool {
+	if s.keys == nil {
+		return true
+	}
+	_, ok := s.keys[key]
+	return ok
+}
+
+// Close unregisters the subscription and closes C.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	delete(s.hub.subs, s)
+	s.once.Do(func() { close(s.ch) })
+}
@@ -0,0 +1,38 @@
+package weather
+
+import "testing"
+
+// TestHubSubscribeAfter verifies that events are numbered across locations,
+// that a resuming subscriber gets the kept events for its locations after its
+// sequence number, that the replay buffer is bounded, and that a sequence
+// number ahead of the hub gets every kept event.
+func TestHubSubscribeAfter(t *testing.T) {
+	h := NewHub()
+	paris, oslo := Location{City: "Paris"}, Location{City: "Oslo"}
+
+	all := h.Subscribe()
+	h.Publish(paris, WeatherSnapshot{})
+	h.Publish(oslo, WeatherSnapshot{})
+	h.Publish(paris, WeatherSnapshot{})
+	first, second, third := <-all.C, <-all.C, <-all.C
+	if second.Seq != first.Seq+1 || third.Seq != second.Seq+1 {
+		t.Fatalf("expected consecutive sequence numbers, got %d, %d, %d", first.Seq, second.Seq, third.Seq)
+	}
+
+	sub, replay := h.SubscribeAfter(first.Seq, paris)
+	defer sub.Close()
+	if len(replay) != 1 || replay[0].Seq != third.Seq {
+		t.Fatalf("expected only the later Paris event, got %+v", replay)
+	}
+
+	for i := 0; i < replayBuffer; i++ {
+		h.Publish(oslo, WeatherSnapshot{})
+	}
+	h.Publish(paris, WeatherSnapshot{})
+	if len(h.recent) != replayBuffer {
+		t.Fatalf("expected %d kept events, got %d", replayBuffer, len(h.recent))
+	}
+	if _, replay := h.SubscribeAfter(h.seq+100, paris); len(replay) != 1 || replay[0].Seq != h.seq {
+		t.Fatalf("expected the one kept Paris event, got %+v", replay)
+	}
+}
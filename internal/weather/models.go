@@ -1,6 +1,9 @@
 package weather
 
 import (
+	"fmt"
+	"math"
+	"strings"
 	"time"
 )
 
@@ -18,39 +21,106 @@ const (
 )
 
 // Location represents a logical place for which we track weather.
-// City/Country must be provided.
+// Either City/Country or Lat/Lon must be provided; when coordinates are
+// present providers query by them instead of by name.
 type Location struct {
-	City    string `json:"city"`
-	Country string `json:"country"`
+	// ID is the canonical identifier of the location. When empty it is
+	// derived from the coordinates or the city/country pair (see Key).
+	ID      string   `json:"id,omitempty"`
+	City    string   `json:"city,omitempty"`
+	Country string   `json:"country,omitempty"`
+	Lat     *float64 `json:"lat,omitempty"`
+	Lon     *float64 `json:"lon,omitempty"`
+}
+
+// HasCoordinates reports whether both latitude and longitude are set.
+func (l Location) HasCoordinates() bool {
+	return l.Lat != nil && l.Lon != nil
 }
 
 // Key returns a canonical string key for indexing this location in stores.
+// Keys are case-insensitive for names ("Paris:FR" and "paris:fr" are the same
+// location) and coordinates are rounded to 4 decimal places (~11m).
 func (l Location) Key() string {
-	return l.City + ":" + l.Country
+	if id := strings.TrimSpace(l.ID); id != "" {
+		return strings.ToLower(id)
+	}
+	if l.HasCoordinates() {
+		return fmt.Sprintf("geo:%.4f,%.4f", roundCoord(*l.Lat), roundCoord(*l.Lon))
+	}
+	return strings.ToLower(strings.TrimSpace(l.City)) + ":" + strings.ToLower(strings.TrimSpace(l.Country))
+}
+
+// Normalize trims names, upper-cases the country code and fills in ID.
+func (l Location) Normalize() Location {
+	l.City = strings.TrimSpace(l.City)
+	l.Country = strings.ToUpper(strings.TrimSpace(l.Country))
+	if l.HasCoordinates() {
+		lat, lon := roundCoord(*l.Lat), roundCoord(*l.Lon)
+		l.Lat, l.Lon = &lat, &lon
+	}
+	l.ID = l.Key()
+	return l
+}
+
+// roundCoord rounds a coordinate to 4 decimal places, avoiding negative zero.
+func roundCoord(v float64) float64 {
+	r := math.Round(v*1e4) / 1e4
+	if r == 0 {
+		return 0
+	}
+	return r
 }
 
 // WeatherSnapshot is the normalized, aggregated weather view at a point in time.
+// Numeric fields are nil (JSON null) when no provider reported them.
 type WeatherSnapshot struct {
 	Location    Location  `json:"location"`
 	Timestamp   time.Time `json:"timestamp"` // always UTC
-	Temperature float64   `json:"temperatureC"`
-	Humidity    float64   `json:"humidityPercent"`
-	WindSpeed   float64   `json:"windSpeed"`
-	Pressure    float64   `json:"pressureHpa"`
-	PrecipMM    float64   `json:"precipMm"`
+	Temperature *float64  `json:"temperatureC"`
+	Humidity    *float64  `json:"humidityPercent"`
+	WindSpeed   *float64  `json:"windSpeed"`
+	Pressure    *float64  `json:"pressureHpa"`
+	PrecipMM    *float64  `json:"precipMm"`
 	Condition   Condition `json:"condition"`
 
 	// Providers contributing to this snapshot.
 	Providers []ProviderContribution `json:"providers,omitempty"`
 }
 
-// Forecast represents a simple multi-day weather forecast
-// as a slice of normalized weather snapshots, one per day.
-// Forecast entries are expected to be ordered by Timestamp ascending.
-type Forecast []WeatherSnapshot
+// DailyForecast is the normalized, aggregated forecast for one calendar day.
+// Numeric fields are nil (JSON null) when no provider reported them.
+type DailyForecast struct {
+	Location Location  `json:"location"`
+	Date     time.Time `json:"date"` // midnight UTC
+
+	TempMinC          *float64  `json:"tempMinC"`
+	TempMaxC          *float64  `json:"tempMaxC"`
+	TempAvgC          *float64  `json:"tempAvgC"`
+	MaxWindSpeed      *float64  `json:"maxWindSpeed"`
+	TotalPrecipMM     *float64  `json:"totalPrecipMm"`
+	PrecipProbability *float64  `json:"precipProbabilityPercent"`
+	Condition         Condition `json:"condition"` // dominant condition of the day
+
+	// Providers contributing to this forecast day.
+	Providers []ProviderContribution `json:"providers,omitempty"`
+}
+
+// Forecast represents a multi-day weather forecast, one entry per day.
+// Forecast entries are expected to be ordered by Date ascending.
+type Forecast []DailyForecast
+
+// HourlyForecast is an hourly weather forecast as a slice of normalized
+// weather snapshots, one per hour on a UTC hour grid, ordered by Timestamp.
+type HourlyForecast []WeatherSnapshot
 
 // ProviderContribution describes data coming from a single provider used in aggregation.
 type ProviderContribution struct {
 	ProviderName string    `json:"provider"`
 	Timestamp    time.Time `json:"timestamp"`
 }
+
+// Float64 returns a pointer to v, for populating optional numeric fields.
+func Float64(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,239 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Defaults for the zero values of OnDemandConfig.
+const (
+	defaultOnDemandTimeout    = 10 * time.Second
+	defaultOnDemandFailureTTL = time.Minute
+	defaultOnDemandIdleTTL    = 24 * time.Hour
+)
+
+// ErrOnDemandLimit is returned by GetCurrent when a location would need an
+// on-demand fetch but the configured location cap or fetch rate is reached.
+var ErrOnDemandLimit = errors.New("on-demand fetch limit reached")
+
+// ErrStale is returned by GetCurrent along with a snapshot older than the
+// configured max age that could not be refreshed.
+var ErrStale = errors.New("stale snapshot")
+
+// OnDemandTracker keeps locations fetched on demand scheduled while they are
+// being requested (see store.OnDemandLocations).
+type OnDemandTracker interface {
+	// Enroll starts tracking loc, or extends its tracking if it is tracked.
+	Enroll(loc Location)
+	// Touch extends the tracking of loc if it is tracked, and is a no-op otherwise.
+	Touch(loc Location)
+}
+
+// OnDemandConfig configures fetching of locations that have no stored snapshot.
+type OnDemandConfig struct {
+	// Timeout bounds the synchronous fetch.
+	Timeout time.Duration
+	// Tracker, if set, is told about locations fetched on demand and about
+	// later requests for them. Nil disables auto-enrollment.
+	Tracker OnDemandTracker
+
+	// MaxAge is how old the snapshot of a location nobody schedules may get
+	// before a request fetches it again. Zero never refetches.
+	MaxAge time.Duration
+	// Scheduled reports whether the scheduler fetches loc, in which case it
+	// is never refetched on demand. Nil means no location is scheduled.
+	Scheduled func(loc Location) bool
+
+	// FailureTTL is how long a failed on-demand fetch is remembered; requests
+	// for the location get the same error until then. Zero means one minute.
+	FailureTTL time.Duration
+	// MaxLocations caps the locations fetched on demand that were requested
+	// within the last IdleTTL (24h if zero). Zero means no cap.
+	MaxLocations int
+	IdleTTL      time.Duration
+	// RatePerMinute limits on-demand fetches across all locations. Zero means
+	// no limit.
+	RatePerMinute int
+}
+
+// onDemandFetcher is the state of on-demand fetching: the locations fetched
+// so far, recent failures, and the fetch rate limit.
+type onDemandFetcher struct {
+	cfg     OnDemandConfig
+	limiter *rate.Limiter // nil without a rate limit
+	now     func() time.Time
+
+	mu        sync.Mutex
+	locations map[string]onDemandLocation
+	failures  map[string]onDemandFailure
+}
+
+type onDemandLocation struct {
+	fetched   time.Time
+	requested time.Time
+}
+
+type onDemandFailure struct {
+	until time.Time
+	err   error
+}
+
+// WithOnDemandFetch makes GetCurrent fetch a location synchronously when the
+// store has no snapshot for it, instead of returning ErrNotFound.
+func WithOnDemandFetch(cfg OnDemandConfig) ServiceOption {
+	return func(s *Service) {
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = defaultOnDemandTimeout
+		}
+		if cfg.FailureTTL <= 0 {
+			cfg.FailureTTL = defaultOnDemandFailureTTL
+		}
+		if cfg.IdleTTL <= 0 {
+			cfg.IdleTTL = defaultOnDemandIdleTTL
+		}
+		f := &onDemandFetcher{
+			cfg:       cfg,
+			now:       time.Now,
+			locations: make(map[string]onDemandLocation),
+			failures:  make(map[string]onDemandFailure),
+		}
+		if cfg.RatePerMinute > 0 {
+			f.limiter = rate.NewLimiter(rate.Every(time.Minute/time.Duration(cfg.RatePerMinute)), cfg.RatePerMinute)
+		}
+		s.onDemand = f
+	}
+}
+
+// GetCurrent returns the latest snapshot for loc. With on-demand fetching
+// enabled, a location without a snapshot is fetched and stored first, as is
+// an unscheduled location whose snapshot is older than the configured max
+// age; if that refresh fails or ctx is done first, the old snapshot is
+// returned with an error wrapping ErrStale. Concurrent requests
+// for the same location share one fetch, which runs detached from ctx (up to
+// the configured timeout) so that one client giving up does not fail the
+// others.
+func (s *Service) GetCurrent(ctx context.Context, loc Location) (WeatherSnapshot, error) {
+	snapshot, err := s.store.GetLatest(ctx, loc)
+	od := s.onDemand
+	if od == nil {
+		return snapshot, err
+	}
+	found := err == nil
+	if found {
+		if od.cfg.Tracker != nil {
+			od.cfg.Tracker.Touch(loc)
+		}
+		if !od.requested(loc, snapshot) {
+			return snapshot, nil
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return snapshot, err
+	}
+
+	ch := s.fetchGroup.DoChan(loc.Key(), func() (any, error) {
+		if err := od.admit(loc.Key()); err != nil {
+			return nil, err
+		}
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), od.cfg.Timeout)
+		defer cancel()
+		err := s.FetchAndStore(fetchCtx, loc)
+		od.fetched(loc.Key(), err)
+		return nil, err
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			if found {
+				return snapshot, fmt.Errorf("%w: refresh failed: %w", ErrStale, res.Err)
+			}
+			return WeatherSnapshot{}, res.Err
+		}
+	case <-ctx.Done():
+		if found {
+			return snapshot, fmt.Errorf("%w: %w", ErrStale, ctx.Err())
+		}
+		return WeatherSnapshot{}, ctx.Err()
+	}
+
+	if od.cfg.Tracker != nil {
+		od.cfg.Tracker.Enroll(loc)
+	}
+	return s.store.GetLatest(ctx, loc)
+}
+
+// requested marks loc, whose latest snapshot is snapshot, as just requested
+// and reports whether it should be fetched again.
+func (f *onDemandFetcher) requested(loc Location, snapshot WeatherSnapshot) bool {
+	now := f.now()
+	key := loc.Key()
+
+	f.mu.Lock()
+	// The snapshot is as old as its newest reading, which can lag behind
+	// the fetch that stored it.
+	fetched := snapshot.Timestamp
+	if l, ok := f.locations[key]; ok {
+		l.requested = now
+		f.locations[key] = l
+		if l.fetched.After(fetched) {
+			fetched = l.fetched
+		}
+	}
+	f.mu.Unlock()
+
+	if f.cfg.MaxAge <= 0 || now.Sub(fetched) < f.cfg.MaxAge {
+		return false
+	}
+	return f.cfg.Scheduled == nil || !f.cfg.Scheduled(loc)
+}
+
+// admit returns the remembered error of a recent failed fetch of the location
+// key, or ErrOnDemandLimit if fetching it would exceed the location cap or
+// the fetch rate.
+func (f *onDemandFetcher) admit(key string) error {
+	now := f.now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for k, failure := range f.failures {
+		if !now.Before(failure.until) {
+			delete(f.failures, k)
+		}
+	}
+	if failure, ok := f.failures[key]; ok {
+		return failure.err
+	}
+
+	for k, l := range f.locations {
+		if now.Sub(l.requested) >= f.cfg.IdleTTL {
+			delete(f.locations, k)
+		}
+	}
+	if _, ok := f.locations[key]; !ok && f.cfg.MaxLocations > 0 && len(f.locations) >= f.cfg.MaxLocations {
+		return fmt.Errorf("%w: at most %d locations are fetched on demand", ErrOnDemandLimit, f.cfg.MaxLocations)
+	}
+	if f.limiter != nil && !f.limiter.AllowN(now, 1) {
+		return fmt.Errorf("%w: at most %d fetches per minute", ErrOnDemandLimit, f.cfg.RatePerMinute)
+	}
+	return nil
+}
+
+// fetched records the outcome of an on-demand fetch of the location key.
+func (f *onDemandFetcher) fetched(key string, err error) {
+	now := f.now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err != nil {
+		f.failures[key] = onDemandFailure{until: now.Add(f.cfg.FailureTTL), err: err}
+		return
+	}
+	delete(f.failures, key)
+	f.locations[key] = onDemandLocation{fetched: now, requested: now}
+}
@@ -0,0 +1,175 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// keyedStore is a minimal Store keeping the latest snapshot per location.
+type keyedStore struct {
+	mu    sync.Mutex
+	snaps map[string]WeatherSnapshot
+}
+
+func (s *keyedStore) SaveSnapshot(ctx context.Context, loc Location, snapshot WeatherSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snaps == nil {
+		s.snaps = make(map[string]WeatherSnapshot)
+	}
+	s.snaps[loc.Key()] = snapshot
+	return nil
+}
+
+func (s *keyedStore) GetLatest(ctx context.Context, loc Location) (WeatherSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, ok := s.snaps[loc.Key()]
+	if !ok {
+		return WeatherSnapshot{}, ErrNotFound
+	}
+	return snap, nil
+}
+
+func (s *keyedStore) GetRange(ctx context.Context, loc Location, from, to time.Time) ([]WeatherSnapshot, error) {
+	return nil, ErrNotFound
+}
+
+// newOnDemandService returns a service fetching on demand from one provider
+// that fails while fail is set, with a clock the test advances.
+func newOnDemandService(cfg OnDemandConfig, fail *atomic.Bool, calls *atomic.Int32) (*Service, *time.Time) {
+	s := NewService(&keyedStore{}, []Provider{switchProvider{name: "stub", fail: fail, calls: calls}}, WithOnDemandFetch(cfg))
+	now := time.Now()
+	s.onDemand.now = func() time.Time { return now }
+	return s, &now
+}
+
+// TestOnDemandLimits verifies that failed on-demand fetches are remembered for
+// the failure TTL, and that the location cap and the fetch rate reject
+// further fetches with ErrOnDemandLimit.
+func TestOnDemandLimits(t *testing.T) {
+	ctx := context.Background()
+	var (
+		fail  atomic.Bool
+		calls atomic.Int32
+	)
+	s, now := newOnDemandService(OnDemandConfig{FailureTTL: time.Minute, MaxLocations: 2, IdleTTL: time.Hour, RatePerMinute: 3}, &fail, &calls)
+
+	fail.Store(true)
+	nowhere := Location{City: "Nowhere"}
+	for i := 0; i < 3; i++ {
+		if _, err := s.GetCurrent(ctx, nowhere); len(ProviderErrors(err)) != 1 {
+			t.Fatalf("request %d: expected the provider failure, got %v", i, err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected 1 provider call while the failure is remembered, got %d", n)
+	}
+
+	fail.Store(false)
+	*now = now.Add(time.Minute)
+	for _, city := range []string{"Nowhere", "Oslo"} {
+		if _, err := s.GetCurrent(ctx, Location{City: city}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", city, err)
+		}
+	}
+	if _, err := s.GetCurrent(ctx, Location{City: "Paris"}); !errors.Is(err, ErrOnDemandLimit) {
+		t.Fatalf("expected the location cap to be reached, got %v", err)
+	}
+
+	// Idle locations stop counting against the cap. Then use up the rest of
+	// the fetch rate.
+	*now = now.Add(time.Hour)
+	if _, err := s.GetCurrent(ctx, Location{City: "Paris"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.onDemand.limiter.AllowN(*now, 2)
+	if _, err := s.GetCurrent(ctx, Location{City: "Rome"}); !errors.Is(err, ErrOnDemandLimit) {
+		t.Fatalf("expected the fetch rate to be reached, got %v", err)
+	}
+	if n := calls.Load(); n != 4 {
+		t.Fatalf("expected 4 provider calls, got %d", n)
+	}
+}
+
+// TestOnDemandRefetchesStale verifies that an unscheduled location is fetched
+// again once its snapshot is older than the max age, that the old snapshot is
+// returned if that fetch fails, and that scheduled locations are left to the
+// scheduler.
+func TestOnDemandRefetchesStale(t *testing.T) {
+	ctx := context.Background()
+	var (
+		fail      atomic.Bool
+		calls     atomic.Int32
+		scheduled atomic.Bool
+	)
+	s, now := newOnDemandService(OnDemandConfig{
+		MaxAge:     15 * time.Minute,
+		Scheduled:  func(Location) bool { return scheduled.Load() },
+		FailureTTL: time.Minute,
+	}, &fail, &calls)
+	oslo := Location{City: "Oslo"}
+
+	first, err := s.GetCurrent(ctx, oslo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	*now = now.Add(10 * time.Minute)
+	if _, err := s.GetCurrent(ctx, oslo); err != nil || calls.Load() != 1 {
+		t.Fatalf("expected the fresh snapshot to be served, got %d calls, error %v", calls.Load(), err)
+	}
+
+	*now = now.Add(10 * time.Minute)
+	fail.Store(true)
+	snap, err := s.GetCurrent(ctx, oslo)
+	if !errors.Is(err, ErrStale) || calls.Load() != 2 || !snap.Timestamp.Equal(first.Timestamp) {
+		t.Fatalf("expected a refetch and the old snapshot marked stale, got %d calls, %+v, error %v", calls.Load(), snap, err)
+	}
+
+	*now = now.Add(time.Minute)
+	fail.Store(false)
+	if _, err := s.GetCurrent(ctx, oslo); err != nil || calls.Load() != 3 {
+		t.Fatalf("expected a refetch, got %d calls, error %v", calls.Load(), err)
+	}
+
+	*now = now.Add(time.Hour)
+	scheduled.Store(true)
+	if _, err := s.GetCurrent(ctx, oslo); err != nil || calls.Load() != 3 {
+		t.Fatalf("expected no refetch of a scheduled location, got %d calls, error %v", calls.Load(), err)
+	}
+}
+
+// TestOnDemandServesStaleOnCancel verifies that a caller giving up while a
+// stale location is refreshed gets the old snapshot marked stale, and that a
+// caller without any snapshot gets its context error.
+func TestOnDemandServesStaleOnCancel(t *testing.T) {
+	var fail atomic.Bool
+	release := make(chan struct{})
+	s := NewService(&keyedStore{}, []Provider{switchProvider{name: "stub", fail: &fail, release: release}}, WithOnDemandFetch(OnDemandConfig{MaxAge: 15 * time.Minute}))
+	now := time.Now()
+	s.onDemand.now = func() time.Time { return now }
+	oslo := Location{City: "Oslo"}
+
+	go func() { release <- struct{}{} }()
+	first, err := s.GetCurrent(context.Background(), oslo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	now = now.Add(time.Hour)
+	snap, err := s.GetCurrent(cancelled, oslo)
+	if !errors.Is(err, ErrStale) || !errors.Is(err, context.Canceled) || !snap.Timestamp.Equal(first.Timestamp) {
+		t.Fatalf("expected the old snapshot marked stale, got %+v, error %v", snap, err)
+	}
+	if _, err := s.GetCurrent(cancelled, Location{City: "Bergen"}); !errors.Is(err, context.Canceled) || errors.Is(err, ErrStale) {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+	release <- struct{}{}
+	release <- struct{}{}
+}
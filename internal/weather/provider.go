@@ -7,15 +7,18 @@ import (
 
 // ProviderReading represents a single provider's normalized reading
 // that can be aggregated into a WeatherSnapshot.
+//
+// Numeric fields are nil when the provider did not report them, so that
+// aggregation can tell a missing value apart from a real zero.
 type ProviderReading struct {
 	ProviderName string
 	Timestamp    time.Time
 
-	TemperatureC float64
-	HumidityPct  float64
-	WindSpeedMS  float64
-	PressureHpa  float64
-	PrecipMm     float64
+	TemperatureC *float64
+	HumidityPct  *float64
+	WindSpeedMS  *float64
+	PressureHpa  *float64
+	PrecipMm     *float64
 	Condition    Condition
 }
 
@@ -25,22 +28,73 @@ type Provider interface {
 	Fetch(ctx context.Context, loc Location) (ProviderReading, error)
 }
 
+// DailyReading represents a single provider's normalized forecast for one
+// calendar day, filled from the provider's native daily (or sub-daily) data.
+//
+// Numeric fields are nil when the provider did not report them.
+type DailyReading struct {
+	ProviderName string
+	Date         time.Time // midnight UTC
+
+	TempMinC          *float64
+	TempMaxC          *float64
+	TempAvgC          *float64
+	MaxWindSpeedMS    *float64
+	TotalPrecipMm     *float64
+	PrecipProbability *float64 // percent, 0-100
+	Condition         Condition
+}
+
 // ForecastProvider is an optional extension of Provider that can return
-// a multi-day forecast as a slice of normalized provider readings, one
-// per day, ordered by ascending date.
+// a multi-day forecast as a slice of daily readings, one per day, ordered
+// by ascending date.
 //
 // Implementations are expected to:
-//   - Normalize timestamps to UTC.
+//   - Normalize dates to midnight UTC.
 //   - Return at most `days` entries, starting from "today" (provider-defined).
 //   - Include the provider name in each reading.
 type ForecastProvider interface {
 	Provider
-	FetchForecast(ctx context.Context, loc Location, days int) ([]ProviderReading, error)
+	FetchForecast(ctx context.Context, loc Location, days int) ([]DailyReading, error)
+}
+
+// HourlyForecastProvider is an optional extension of Provider that can return
+// an hourly forecast as provider readings ordered by ascending time.
+//
+// Implementations are expected to:
+//   - Normalize timestamps to UTC.
+//   - Cover the `hours` hours starting from the current hour. Providers with a
+//     coarser native resolution (e.g. 3-hour slots) return their native slots,
+//     including one slot past the window; the service interpolates them onto
+//     an hourly grid.
+//   - Report precipitation as mm per hour.
+type HourlyForecastProvider interface {
+	Provider
+	FetchHourlyForecast(ctx context.Context, loc Location, hours int) ([]ProviderReading, error)
+}
+
+// HistoryProvider is an optional extension of Provider that can return past
+// observations as hourly provider readings ordered by ascending time.
+//
+// Implementations are expected to:
+//   - Normalize timestamps to UTC, on the hour.
+//   - Return readings in [from, to); a provider may cover less than that when
+//     its history does not reach back to from.
+//   - Report precipitation as mm per hour.
+type HistoryProvider interface {
+	Provider
+	FetchHistory(ctx context.Context, loc Location, from, to time.Time) ([]ProviderReading, error)
 }
 
 // Store is the contract the in-memory store (and any future persistent store) must satisfy.
+// Implementations that do I/O should give up when ctx is done. GetLatest and
+// GetRange return ErrNotFound when there is no matching snapshot.
+//
+// Snapshots are kept ordered by timestamp, so a snapshot older than the
+// latest one (e.g. from a backfill) is inserted into the history and does not
+// become the latest.
 type Store interface {
-	SaveSnapshot(loc Location, snapshot WeatherSnapshot)
-	GetLatest(loc Location) (WeatherSnapshot, error)
-	GetRange(loc Location, from, to time.Time) ([]WeatherSnapshot, error)
+	SaveSnapshot(ctx context.Context, loc Location, snapshot WeatherSnapshot) error
+	GetLatest(ctx context.Context, loc Location) (WeatherSnapshot, error)
+	GetRange(ctx context.Context, loc Location, from, to time.Time) ([]WeatherSnapshot, error)
 }
@@ -0,0 +1,147 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sony/gobreaker"
+
+	"github.com/i474232898/weather-data-aggregation/internal/metrics"
+)
+
+// CircuitBreaker wraps a gobreaker.CircuitBreaker so it can be reset by an
+// operator, and records the outcome of recent calls for status reporting.
+type CircuitBreaker struct {
+	settings gobreaker.Settings
+
+	mu          sync.RWMutex
+	cb          *gobreaker.CircuitBreaker
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastErr     string
+}
+
+// BreakerStatus is a point-in-time view of a CircuitBreaker.
+type BreakerStatus struct {
+	State       string        `json:"state"`
+	Counts      BreakerCounts `json:"counts"`
+	LastSuccess *time.Time    `json:"lastSuccess,omitempty"`
+	LastFailure *time.Time    `json:"lastFailure,omitempty"`
+	LastError   string        `json:"lastError,omitempty"`
+}
+
+// BreakerCounts are the breaker's request counts. In the closed state they
+// cover the current breaker interval only.
+type BreakerCounts struct {
+	Requests             uint32 `json:"requests"`
+	TotalSuccesses       uint32 `json:"totalSuccesses"`
+	TotalFailures        uint32 `json:"totalFailures"`
+	ConsecutiveSuccesses uint32 `json:"consecutiveSuccesses"`
+	ConsecutiveFailures  uint32 `json:"consecutiveFailures"`
+}
+
+// BreakerProvider is implemented by providers that call their upstream
+// through a CircuitBreaker.
+type BreakerProvider interface {
+	Breaker() *CircuitBreaker
+}
+
+// newCircuitBreaker creates a CircuitBreaker. settings.Name is the provider
+// name used in metrics.
+func newCircuitBreaker(settings gobreaker.Settings) *CircuitBreaker {
+	next := settings.OnStateChange
+	settings.OnStateChange = func(name string, from, to gobreaker.State) {
+		metrics.CircuitBreakerState.WithLabelValues(name).Set(float64(to))
+		if next != nil {
+			next(name, from, to)
+		}
+	}
+
+	b := &CircuitBreaker{settings: settings, cb: gobreaker.NewCircuitBreaker(settings)}
+	metrics.CircuitBreakerState.WithLabelValues(settings.Name).Set(float64(gobreaker.StateClosed))
+	return b
+}
+
+// Name returns the name of the breaker, which is the provider name.
+func (b *CircuitBreaker) Name() string {
+	return b.settings.Name
+}
+
+// Execute runs req through the breaker.
+func (b *CircuitBreaker) Execute(req func() (interface{}, error)) (interface{}, error) {
+	b.mu.RLock()
+	cb := b.cb
+	b.mu.RUnlock()
+
+	return cb.Execute(req)
+}
+
+// open reports whether the breaker rejects every call.
+func (b *CircuitBreaker) open() bool {
+	b.mu.RLock()
+	cb := b.cb
+	b.mu.RUnlock()
+
+	return cb.State() == gobreaker.StateOpen
+}
+
+// Reset closes the breaker and clears its counts, e.g. once an upstream
+// outage is known to be resolved. Calls already in flight are not counted
+// against the new breaker.
+func (b *CircuitBreaker) Reset() {
+	b.mu.Lock()
+	b.cb = gobreaker.NewCircuitBreaker(b.settings)
+	b.mu.Unlock()
+
+	metrics.CircuitBreakerState.WithLabelValues(b.settings.Name).Set(float64(gobreaker.StateClosed))
+}
+
+// Status returns the current breaker state, counts and last call outcome.
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	counts := b.cb.Counts()
+	status := BreakerStatus{
+		State: b.cb.State().String(),
+		Counts: BreakerCounts{
+			Requests:             counts.Requests,
+			TotalSuccesses:       counts.TotalSuccesses,
+			TotalFailures:        counts.TotalFailures,
+			ConsecutiveSuccesses: counts.ConsecutiveSuccesses,
+			ConsecutiveFailures:  counts.ConsecutiveFailures,
+		},
+		LastError: b.lastErr,
+	}
+	if !b.lastSuccess.IsZero() {
+		t := b.lastSuccess
+		status.LastSuccess = &t
+	}
+	if !b.lastFailure.IsZero() {
+		t := b.lastFailure
+		status.LastFailure = &t
+	}
+	return status
+}
+
+// record notes the outcome of a provider call. Only the class of a failure
+// and the upstream status are kept: error texts can quote the request URL,
+// and with it the API key.
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now().UTC()
+	if err == nil {
+		b.lastSuccess = now
+		return
+	}
+	b.lastFailure = now
+	b.lastErr = errorClass(err)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		b.lastErr += fmt.Sprintf(": HTTP %d", statusErr.status)
+	}
+}
@@ -4,11 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"math"
+	"math/rand/v2"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sony/gobreaker"
+
+	"github.com/i474232898/weather-data-aggregation/internal/metrics"
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
 )
 
 // BackoffConfig controls exponential backoff behaviour.
@@ -16,14 +23,44 @@ type BackoffConfig struct {
 	MaxRetries      int
 	InitialInterval time.Duration
 	MaxInterval     time.Duration
+	// Jitter randomizes delays so that many clients don't retry in lockstep.
+	// The zero value is JitterFull.
+	Jitter JitterStrategy
 }
 
+// JitterStrategy selects how retry delays are randomized.
+type JitterStrategy int
+
+const (
+	// JitterFull sleeps a random duration between 0 and the exponential delay.
+	JitterFull JitterStrategy = iota
+	// JitterDecorrelated sleeps a random duration between InitialInterval and
+	// three times the previous delay, capped at MaxInterval.
+	JitterDecorrelated
+	// JitterNone uses the plain exponential delay.
+	JitterNone
+)
+
 // HTTPClientConfig bundles HTTP client and resilience settings.
 type HTTPClientConfig struct {
 	Client  *http.Client
 	Backoff BackoffConfig
+	// Quota, if set, budgets every HTTP attempt including retries.
+	Quota *Quota
+	// DecodeError extracts the upstream error code and message from an
+	// error response body. Optional.
+	DecodeError func(body []byte) (code, message string)
 }
 
+// Operations, used in metrics and ProviderError.
+const (
+	opCurrent  = weather.OperationCurrent
+	opForecast = weather.OperationForecast
+	opHourly   = weather.OperationHourly
+	opHistory  = weather.OperationHistory
+	opGeocode  = "geocode"
+)
+
 var (
 	errRateLimited   = errors.New("rate limited")
 	errServerError   = errors.New("server error")
@@ -33,14 +70,34 @@ var (
 	errInvalidConfig = errors.New("invalid backoff configuration")
 )
 
-// doRequestWithResilience executes the HTTP request with retries, exponential backoff,
-// and a circuit breaker.
+// doRequestWithResilience executes the HTTP request with retries, jittered
+// exponential backoff, a circuit breaker and an optional request quota. A
+// Retry-After header on 429/503 responses takes precedence over the backoff.
+// The call is recorded in the provider metrics under op and in the breaker's status.
+//
+// Errors are returned as *weather.ProviderError wrapping one of the sentinels
+// above. Non-retryable failures (4xx responses other than 429) are not retried.
 func doRequestWithResilience(
 	ctx context.Context,
 	cfg HTTPClientConfig,
-	cb *gobreaker.CircuitBreaker,
+	cb *CircuitBreaker,
+	op string,
 	buildRequest func() (*http.Request, error),
-) (*http.Response, error) {
+) (resp *http.Response, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ProviderRequestDuration.WithLabelValues(cb.Name(), op).Observe(time.Since(start).Seconds())
+		metrics.ProviderRequests.WithLabelValues(cb.Name(), op, errorClass(err)).Inc()
+		// A caller that gave up, or a request we never sent, says nothing
+		// about the provider's health.
+		if !errors.Is(err, context.Canceled) && !errors.Is(err, errQuotaExceeded) {
+			cb.record(err)
+		}
+		if err != nil {
+			err = newProviderError(cb.Name(), op, err)
+		}
+	}()
+
 	if cfg.Client == nil {
 		return nil, errNoHTTPClient
 	}
@@ -50,14 +107,31 @@ func doRequestWithResilience(
 
 	var attempt int
 	var lastErr error
+	var delay time.Duration
 
 	for {
 		if ctx.Err() != nil {
 			return nil, ctx.Err()
 		}
 
+		// An open breaker rejects the call without sending a request, so it
+		// must not use the budget.
+		if cb.open() {
+			return nil, fmt.Errorf("%w: %v", errCircuitOpen, gobreaker.ErrOpenState)
+		}
+
+		release, err := cfg.Quota.take()
+		if err != nil {
+			if attempt > 0 {
+				// Out of budget for retries; report the upstream failure.
+				return nil, lastErr
+			}
+			return nil, err
+		}
+
 		req, err := buildRequest()
 		if err != nil {
+			release()
 			return nil, err
 		}
 
@@ -70,18 +144,14 @@ func doRequestWithResilience(
 				return nil, execErr
 			}
 
-			// Handle rate limiting and server errors explicitly.
-			if resp.StatusCode == http.StatusTooManyRequests {
-				return nil, errRateLimited
-			}
-			if resp.StatusCode >= 500 {
-				return nil, errServerError
-			}
-			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-				return nil, fmt.Errorf("%w: %d", errUnexpected, resp.StatusCode)
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return resp, nil
 			}
 
-			return resp, nil
+			// Error responses are not handed to the caller, so release the
+			// connection here.
+			defer closeBody(resp)
+			return nil, newStatusError(resp, cfg.DecodeError)
 		})
 
 		if err == nil {
@@ -93,20 +163,29 @@ func doRequestWithResilience(
 			return resp, nil
 		}
 
-		// If circuit is open, propagate immediately.
+		// If circuit is open, propagate immediately. No request was sent, so
+		// the budget is given back (this happens when the breaker opens
+		// concurrently or limits half-open calls).
 		if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+			release()
 			return nil, fmt.Errorf("%w: %v", errCircuitOpen, err)
 		}
 
 		lastErr = err
-		if attempt >= cfg.Backoff.MaxRetries {
+		if attempt >= cfg.Backoff.MaxRetries || !isRetryable(err) {
 			return nil, lastErr
 		}
 
-		// Backoff with exponential delay.
-		delay := cfg.Backoff.InitialInterval * time.Duration(math.Pow(2, float64(attempt)))
-		if delay > cfg.Backoff.MaxInterval && cfg.Backoff.MaxInterval > 0 {
-			delay = cfg.Backoff.MaxInterval
+		delay = backoffDelay(cfg.Backoff, attempt, delay)
+
+		// The server knows best when it can take the next request.
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.hasRetryAfter {
+			delay = statusErr.retryAfter
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				// We'd be cancelled before the retry; fail now instead.
+				return nil, lastErr
+			}
 		}
 
 		timer := time.NewTimer(delay)
@@ -119,5 +198,187 @@ func doRequestWithResilience(
 		}
 
 		attempt++
+		metrics.ProviderRetries.WithLabelValues(cb.Name(), op).Inc()
+	}
+}
+
+// backoffDelay returns the delay before retry number attempt+1; prev is the
+// previous delay (used by JitterDecorrelated).
+func backoffDelay(cfg BackoffConfig, attempt int, prev time.Duration) time.Duration {
+	capDelay := func(d time.Duration) time.Duration {
+		if cfg.MaxInterval > 0 && d > cfg.MaxInterval {
+			return cfg.MaxInterval
+		}
+		return d
+	}
+
+	exp := capDelay(cfg.InitialInterval * time.Duration(math.Pow(2, float64(attempt))))
+
+	switch cfg.Jitter {
+	case JitterNone:
+		return exp
+	case JitterDecorrelated:
+		if prev < cfg.InitialInterval {
+			prev = cfg.InitialInterval
+		}
+		return capDelay(cfg.InitialInterval + rand.N(3*prev-cfg.InitialInterval+1))
+	default:
+		return rand.N(exp + 1)
+	}
+}
+
+// statusError is a non-2xx upstream response.
+type statusError struct {
+	err     error // errRateLimited, errServerError or errUnexpected
+	status  int
+	code    string
+	message string
+
+	retryAfter    time.Duration
+	hasRetryAfter bool
+}
+
+// newStatusError classifies an error response and decodes its body with
+// decode, if given.
+func newStatusError(resp *http.Response, decode func([]byte) (string, string)) *statusError {
+	e := &statusError{err: statusClass(resp.StatusCode), status: resp.StatusCode}
+	if e.err != errUnexpected {
+		e.retryAfter, e.hasRetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+
+	if decode != nil {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		e.code, e.message = decode(body)
+	}
+	return e
+}
+
+// statusClass returns the sentinel for an error response status. Rate
+// limiting and server errors are handled explicitly.
+func statusClass(status int) error {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return errRateLimited
+	case status >= 500:
+		return errServerError
+	default:
+		return errUnexpected
+	}
+}
+
+func (e *statusError) Error() string {
+	msg := fmt.Sprintf("%v: %d", e.err, e.status)
+	if e.message != "" {
+		msg += ": " + e.message
+	}
+	if e.hasRetryAfter {
+		msg += fmt.Sprintf(" (retry after %s)", e.retryAfter)
+	}
+	return msg
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+// isRetryable reports whether a failed attempt may succeed if repeated.
+func isRetryable(err error) bool {
+	switch {
+	case errors.Is(err, errUnexpected),
+		errors.Is(err, errNoHTTPClient),
+		errors.Is(err, errInvalidConfig),
+		errors.Is(err, context.Canceled):
+		return false
+	default:
+		return true
+	}
+}
+
+// newProviderError wraps a doRequestWithResilience error in a
+// weather.ProviderError, filling in the upstream details when the provider
+// answered with an error response.
+func newProviderError(provider, op string, err error) *weather.ProviderError {
+	pe := &weather.ProviderError{
+		Provider:  provider,
+		Operation: op,
+		Retryable: isRetryable(err),
+		Message:   weather.ErrorMessage(err),
+		Err:       err,
+	}
+
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		pe.StatusCode = statusErr.status
+		pe.Code = statusErr.code
+		if statusErr.message != "" {
+			pe.Message = statusErr.message
+		} else {
+			pe.Message = statusErr.err.Error()
+		}
+	}
+	return pe
+}
+
+// parseRetryAfter parses a Retry-After header in either delay-seconds or
+// HTTP-date form. Dates in the past yield a zero wait.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// closeBody drains (up to a limit) and closes a response body so the
+// connection can be reused.
+func closeBody(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
+
+// errorClass maps a doRequestWithResilience error to its metrics label.
+func errorClass(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, errRateLimited):
+		return "rate_limited"
+	case errors.Is(err, errServerError):
+		return "server_error"
+	case errors.Is(err, errCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, errQuotaExceeded):
+		return "quota_exceeded"
+	case errors.Is(err, errUnexpected):
+		return "unexpected_status"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	default:
+		return "error"
+	}
+}
+
+// minPtr returns the smaller of *cur and v, treating a nil cur as unset.
+func minPtr(cur *float64, v float64) *float64 {
+	if cur != nil && *cur <= v {
+		return cur
+	}
+	return &v
+}
+
+// maxPtr returns the larger of *cur and v, treating a nil cur as unset.
+func maxPtr(cur *float64, v float64) *float64 {
+	if cur != nil && *cur >= v {
+		return cur
 	}
+	return &v
 }
@@ -0,0 +1,211 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sony/gobreaker"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// TestParseRetryAfter verifies both Retry-After forms.
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"7", 7 * time.Second, true},
+		{"Mon, 15 Jan 2024 12:00:30 GMT", 30 * time.Second, true},
+		{"Mon, 15 Jan 2024 11:59:00 GMT", 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, tc := range cases {
+		got, ok := parseRetryAfter(tc.header, now)
+		if got != tc.want || ok != tc.ok {
+			t.Fatalf("parseRetryAfter(%q) = %v, %v; want %v, %v", tc.header, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+// TestBackoffDelayJitter verifies that jittered delays stay within bounds.
+func TestBackoffDelayJitter(t *testing.T) {
+	cfg := BackoffConfig{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second}
+
+	for i := 0; i < 100; i++ {
+		if d := backoffDelay(cfg, 3, 0); d < 0 || d > 800*time.Millisecond {
+			t.Fatalf("full jitter delay %v out of range", d)
+		}
+	}
+
+	cfg.Jitter = JitterDecorrelated
+	for i := 0; i < 100; i++ {
+		if d := backoffDelay(cfg, 0, 500*time.Millisecond); d < cfg.InitialInterval || d > cfg.MaxInterval {
+			t.Fatalf("decorrelated jitter delay %v out of range", d)
+		}
+	}
+
+	cfg.Jitter = JitterNone
+	if d := backoffDelay(cfg, 5, 0); d != cfg.MaxInterval {
+		t.Fatalf("expected capped delay %v, got %v", cfg.MaxInterval, d)
+	}
+}
+
+// TestRetryAfterBeyondDeadlineFailsFast verifies that a Retry-After longer
+// than the caller's deadline ends the call instead of sleeping into it.
+func TestRetryAfterBeyondDeadlineFailsFast(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	cfg := HTTPClientConfig{
+		Client:  srv.Client(),
+		Backoff: BackoffConfig{MaxRetries: 3, InitialInterval: time.Millisecond},
+	}
+	cb := newCircuitBreaker(gobreaker.Settings{Name: "test"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, err := doRequestWithResilience(ctx, cfg, cb, opCurrent, func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, srv.URL, nil)
+	})
+	if !errors.Is(err, errRateLimited) {
+		t.Fatalf("expected rate limited error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected to fail fast, took %v", elapsed)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+}
+
+// TestClientErrorIsDecodedAndNotRetried verifies that a 4xx response is
+// returned as a non-retryable ProviderError carrying the upstream details.
+func TestClientErrorIsDecodedAndNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"cod":401, "message": "Invalid API key."}`))
+	}))
+	defer srv.Close()
+
+	cfg := HTTPClientConfig{
+		Client:      srv.Client(),
+		Backoff:     BackoffConfig{MaxRetries: 3, InitialInterval: time.Millisecond},
+		DecodeError: decodeOpenWeatherError,
+	}
+	cb := newCircuitBreaker(gobreaker.Settings{Name: "openweathermap"})
+
+	_, err := doRequestWithResilience(context.Background(), cfg, cb, opForecast, func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, srv.URL, nil)
+	})
+
+	var pe *weather.ProviderError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected ProviderError, got %v", err)
+	}
+	if pe.Provider != "openweathermap" || pe.Operation != weather.OperationForecast || pe.StatusCode != http.StatusUnauthorized ||
+		pe.Retryable || pe.Code != "401" || pe.Message != "Invalid API key." {
+		t.Fatalf("unexpected provider error: %+v", pe)
+	}
+	if !errors.Is(err, errUnexpected) {
+		t.Fatalf("expected errUnexpected in chain, got %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+}
+
+// TestTransportErrorHidesAPIKey verifies that the message of a failed
+// request does not expose the API key from the request URL.
+func TestTransportErrorHidesAPIKey(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close() // connection refused
+
+	const key = "SECRETKEY"
+	p, err := DefaultRegistry().Build(OpenWeatherName, Config{
+		APIKey:  key,
+		BaseURL: srv.URL,
+		Backoff: BackoffConfig{MaxRetries: 0, InitialInterval: time.Millisecond},
+	}, Deps{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = p.Fetch(context.Background(), weather.Location{City: "Paris", Country: "FR"})
+	var pe *weather.ProviderError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected ProviderError, got %v", err)
+	}
+	if strings.Contains(err.Error(), key) || strings.Contains(pe.Message, key) {
+		t.Fatalf("expected the API key to be hidden, got %q", pe.Message)
+	}
+	if !strings.Contains(pe.Message, srv.URL) {
+		t.Fatalf("expected the message to keep the URL without its query, got %q", pe.Message)
+	}
+	if last := p.(BreakerProvider).Breaker().Status().LastError; last != "error" {
+		t.Fatalf("expected the breaker to record only the error class, got %q", last)
+	}
+
+	urlErr := &url.Error{Op: "Get", URL: srv.URL + "/current.json?key=" + key + "&q=Paris", Err: context.DeadlineExceeded}
+	if pe := weather.AsProviderError(WeatherAPIName, weather.OperationCurrent, urlErr); strings.Contains(pe.Message, key) {
+		t.Fatalf("expected the API key to be hidden, got %q", pe.Message)
+	}
+}
+
+// TestCallerCancellationLeavesBreakerClosed verifies that calls canceled by
+// their caller don't count as provider failures in the circuit breaker.
+func TestCallerCancellationLeavesBreakerClosed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cfg := HTTPClientConfig{Client: srv.Client(), Backoff: BackoffConfig{InitialInterval: time.Millisecond}}
+	cb := newCircuitBreaker(DefaultBreaker.settings("test"))
+	call := func(ctx context.Context, query string) error {
+		_, err := doRequestWithResilience(ctx, cfg, cb, opCurrent, func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL+query, nil)
+		})
+		return err
+	}
+
+	for i := 0; i <= 2*int(DefaultBreaker.ConsecutiveFailures); i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		if err := call(ctx, "?slow=1"); !errors.Is(err, context.Canceled) {
+			t.Fatalf("call %d: expected a canceled call, got %v", i, err)
+		}
+	}
+	if state := cb.Status().State; state != "closed" {
+		t.Fatalf("expected a closed breaker, got %s", state)
+	}
+	if err := call(context.Background(), ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,427 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sony/gobreaker"
+
+	"github.com/i474232898/weather-data-aggregation/internal/metrics"
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// Fault kinds.
+const (
+	// FaultLatency delays calls by Latency.
+	FaultLatency = "latency"
+	// FaultError fails calls as if the upstream answered with Status.
+	FaultError = "error"
+	// FaultStale moves the timestamp of current readings back by Staleness.
+	FaultStale = "stale"
+	// FaultOutlier adds Offset to reported temperatures.
+	FaultOutlier = "outlier"
+)
+
+var faultKinds = []string{FaultLatency, FaultError, FaultStale, FaultOutlier}
+
+var faultOperations = []string{opCurrent, opForecast, opHourly, opHistory}
+
+// FaultRule injects one kind of fault into a provider's calls.
+type FaultRule struct {
+	Kind string
+	// Probability is the chance, in (0, 1], that the rule applies to a call
+	// while it is active.
+	Probability float64
+	// Every and For schedule the rule: it is active for the first For of
+	// every Every, counted from when the rules were set. A zero Every means
+	// always active.
+	Every, For time.Duration
+	// Operations limits the rule to some of current, forecast, hourly and
+	// history; empty means all.
+	Operations []string
+
+	Latency   time.Duration // FaultLatency
+	Status    int           // FaultError; 503 if zero
+	Staleness time.Duration // FaultStale
+	Offset    float64       // FaultOutlier, in °C
+}
+
+// problems returns every problem with the rule.
+func (r FaultRule) problems() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(slices.Contains(faultKinds, r.Kind), "kind: must be one of %v, got %q", faultKinds, r.Kind)
+	check(r.Probability > 0 && r.Probability <= 1, "probability: must be in (0, 1], got %v", r.Probability)
+	check(r.Every >= 0, "every: must not be negative, got %v", r.Every)
+	if r.Every > 0 {
+		check(r.For > 0 && r.For <= r.Every, "for: must be positive and at most every (%v), got %v", r.Every, r.For)
+	} else {
+		check(r.For == 0, "for: needs every")
+	}
+	for _, op := range r.Operations {
+		check(slices.Contains(faultOperations, op), "operations: must be some of %v, got %q", faultOperations, op)
+	}
+
+	switch r.Kind {
+	case FaultLatency:
+		check(r.Latency > 0, "latency: must be positive, got %v", r.Latency)
+	case FaultError:
+		check(r.Status == 0 || (r.Status >= 400 && r.Status <= 599), "status: must be a 4xx or 5xx status, got %d", r.Status)
+	case FaultStale:
+		check(r.Staleness > 0, "staleness: must be positive, got %v", r.Staleness)
+	case FaultOutlier:
+		check(r.Offset != 0, "offset: must not be zero")
+	}
+	return errs
+}
+
+// activeAt reports whether the rule is scheduled to apply to a call of op,
+// elapsed after the rules were set.
+func (r FaultRule) activeAt(op string, elapsed time.Duration) bool {
+	if len(r.Operations) > 0 && !slices.Contains(r.Operations, op) {
+		return false
+	}
+	return r.Every == 0 || elapsed%r.Every < r.For
+}
+
+// FaultInjector holds fault rules per provider and applies them to the
+// providers it wraps. Rules are kept by provider name, so they survive
+// providers being rebuilt on config reload as long as the new providers
+// are wrapped too.
+type FaultInjector struct {
+	now  func() time.Time
+	roll func() float64
+
+	mu    sync.RWMutex
+	rules map[string]faultRules
+}
+
+type faultRules struct {
+	set   time.Time
+	rules []FaultRule
+}
+
+// NewFaultInjector returns a FaultInjector without rules.
+func NewFaultInjector() *FaultInjector {
+	return &FaultInjector{now: time.Now, roll: rand.Float64, rules: make(map[string]faultRules)}
+}
+
+// SetRules replaces the rules of the provider called name and restarts their
+// schedules. No rules clears them. Invalid rules are rejected as a whole.
+func (f *FaultInjector) SetRules(name string, rules []FaultRule) error {
+	var errs []error
+	for i, r := range rules {
+		for _, err := range r.problems() {
+			errs = append(errs, fmt.Errorf("rules[%d]: %w", i, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(rules) == 0 {
+		delete(f.rules, name)
+		log.Printf("providers: fault injection for %s cleared", name)
+		return nil
+	}
+	f.rules[name] = faultRules{set: f.now(), rules: slices.Clone(rules)}
+	log.Printf("providers: fault injection for %s: %d rule(s)", name, len(rules))
+	return nil
+}
+
+// Rules returns the rules of the provider called name.
+func (f *FaultInjector) Rules(name string) []FaultRule {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return slices.Clone(f.rules[name].rules)
+}
+
+// AllRules returns the rules of every provider that has some.
+func (f *FaultInjector) AllRules() map[string][]FaultRule {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	all := make(map[string][]FaultRule, len(f.rules))
+	for name, fr := range f.rules {
+		all[name] = slices.Clone(fr.rules)
+	}
+	return all
+}
+
+// Clear removes the rules of every provider.
+func (f *FaultInjector) Clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rules = make(map[string]faultRules)
+	log.Printf("providers: fault injection cleared")
+}
+
+// active returns the rules that apply to a call of op to the provider called
+// name, rolling each rule's probability.
+func (f *FaultInjector) active(name, op string) []FaultRule {
+	f.mu.RLock()
+	fr, ok := f.rules[name]
+	f.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	elapsed := f.now().Sub(fr.set)
+	var active []FaultRule
+	for _, r := range fr.rules {
+		if r.activeAt(op, elapsed) && f.roll() < r.Probability {
+			active = append(active, r)
+			metrics.ProviderInjectedFaults.WithLabelValues(name, op, r.Kind).Inc()
+		}
+	}
+	return active
+}
+
+// Wrap returns provs with faults injected into their calls. The wrapped
+// providers keep the forecast, hourly forecast and history capabilities, the
+// circuit breaker and the quota of the originals.
+func (f *FaultInjector) Wrap(provs []weather.Provider) []weather.Provider {
+	wrapped := make([]weather.Provider, 0, len(provs))
+	for _, p := range provs {
+		wrapped = append(wrapped, f.wrap(p))
+	}
+	return wrapped
+}
+
+func (f *FaultInjector) wrap(p weather.Provider) weather.Provider {
+	fp := &faultProvider{inner: p, faults: f}
+	_, forecast := p.(weather.ForecastProvider)
+	_, hourly := p.(weather.HourlyForecastProvider)
+	_, history := p.(weather.HistoryProvider)
+
+	switch {
+	case forecast && hourly && history:
+		return struct {
+			*faultProvider
+			faultForecast
+			faultHourly
+			faultHistory
+		}{fp, faultForecast{fp}, faultHourly{fp}, faultHistory{fp}}
+	case forecast && hourly:
+		return struct {
+			*faultProvider
+			faultForecast
+			faultHourly
+		}{fp, faultForecast{fp}, faultHourly{fp}}
+	case forecast && history:
+		return struct {
+			*faultProvider
+			faultForecast
+			faultHistory
+		}{fp, faultForecast{fp}, faultHistory{fp}}
+	case hourly && history:
+		return struct {
+			*faultProvider
+			faultHourly
+			faultHistory
+		}{fp, faultHourly{fp}, faultHistory{fp}}
+	case forecast:
+		return struct {
+			*faultProvider
+			faultForecast
+		}{fp, faultForecast{fp}}
+	case hourly:
+		return struct {
+			*faultProvider
+			faultHourly
+		}{fp, faultHourly{fp}}
+	case history:
+		return struct {
+			*faultProvider
+			faultHistory
+		}{fp, faultHistory{fp}}
+	default:
+		return fp
+	}
+}
+
+// faultProvider injects faults into the current weather calls of a provider.
+// The optional capabilities are added by faultForecast, faultHourly and
+// faultHistory.
+type faultProvider struct {
+	inner  weather.Provider
+	faults *FaultInjector
+}
+
+func (p *faultProvider) Name() string {
+	return p.inner.Name()
+}
+
+// Breaker returns the circuit breaker of the wrapped provider, or nil.
+func (p *faultProvider) Breaker() *CircuitBreaker {
+	if bp, ok := p.inner.(BreakerProvider); ok {
+		return bp.Breaker()
+	}
+	return nil
+}
+
+// Quota returns the quota of the wrapped provider, or nil.
+func (p *faultProvider) Quota() *Quota {
+	if qp, ok := p.inner.(QuotaProvider); ok {
+		return qp.Quota()
+	}
+	return nil
+}
+
+func (p *faultProvider) Fetch(ctx context.Context, loc weather.Location) (weather.ProviderReading, error) {
+	rules, err := p.before(ctx, opCurrent)
+	if err != nil {
+		return weather.ProviderReading{}, err
+	}
+	r, err := p.inner.Fetch(ctx, loc)
+	if err != nil {
+		return r, err
+	}
+	return distortReading(r, rules, true), nil
+}
+
+// before injects the active latency and error faults ahead of a call of op
+// and returns the active rules, to be applied to its result.
+func (p *faultProvider) before(ctx context.Context, op string) ([]FaultRule, error) {
+	rules := p.faults.active(p.Name(), op)
+
+	var delay time.Duration
+	for _, r := range rules {
+		if r.Kind == FaultLatency {
+			delay += r.Latency
+		}
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, newProviderError(p.Name(), op, ctx.Err())
+		case <-timer.C:
+		}
+	}
+
+	for _, r := range rules {
+		if r.Kind == FaultError {
+			return nil, p.injectError(op, r.Status)
+		}
+	}
+	return rules, nil
+}
+
+// injectError fails a call of op as if the upstream had answered with
+// status. The failure goes through the provider's circuit breaker and
+// metrics like a real one, so that injected outages open the breaker.
+func (p *faultProvider) injectError(op string, status int) error {
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	var err error = &statusError{err: statusClass(status), status: status, message: "injected fault"}
+
+	if cb := p.Breaker(); cb != nil {
+		injected := err
+		_, err = cb.Execute(func() (interface{}, error) { return nil, injected })
+		if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+			err = fmt.Errorf("%w: %v", errCircuitOpen, err)
+		}
+		cb.record(err)
+	}
+	metrics.ProviderRequests.WithLabelValues(p.Name(), op, errorClass(err)).Inc()
+	return newProviderError(p.Name(), op, err)
+}
+
+type faultForecast struct{ p *faultProvider }
+
+func (f faultForecast) FetchForecast(ctx context.Context, loc weather.Location, days int) ([]weather.DailyReading, error) {
+	rules, err := f.p.before(ctx, opForecast)
+	if err != nil {
+		return nil, err
+	}
+	out, err := f.p.inner.(weather.ForecastProvider).FetchForecast(ctx, loc, days)
+	if err != nil {
+		return out, err
+	}
+	for i := range out {
+		for _, r := range rules {
+			if r.Kind == FaultOutlier {
+				out[i].TempMinC = offset(out[i].TempMinC, r.Offset)
+				out[i].TempMaxC = offset(out[i].TempMaxC, r.Offset)
+				out[i].TempAvgC = offset(out[i].TempAvgC, r.Offset)
+			}
+		}
+	}
+	return out, nil
+}
+
+type faultHourly struct{ p *faultProvider }
+
+func (f faultHourly) FetchHourlyForecast(ctx context.Context, loc weather.Location, hours int) ([]weather.ProviderReading, error) {
+	rules, err := f.p.before(ctx, opHourly)
+	if err != nil {
+		return nil, err
+	}
+	out, err := f.p.inner.(weather.HourlyForecastProvider).FetchHourlyForecast(ctx, loc, hours)
+	if err != nil {
+		return out, err
+	}
+	for i := range out {
+		out[i] = distortReading(out[i], rules, false)
+	}
+	return out, nil
+}
+
+type faultHistory struct{ p *faultProvider }
+
+func (f faultHistory) FetchHistory(ctx context.Context, loc weather.Location, from, to time.Time) ([]weather.ProviderReading, error) {
+	rules, err := f.p.before(ctx, opHistory)
+	if err != nil {
+		return nil, err
+	}
+	out, err := f.p.inner.(weather.HistoryProvider).FetchHistory(ctx, loc, from, to)
+	if err != nil {
+		return out, err
+	}
+	for i := range out {
+		out[i] = distortReading(out[i], rules, false)
+	}
+	return out, nil
+}
+
+// distortReading applies the outlier rules, and the stale rules if stale is
+// set, to r. Only current readings are made stale: moving the timestamps of
+// forecast or history hours would change which hour they describe.
+func distortReading(r weather.ProviderReading, rules []FaultRule, stale bool) weather.ProviderReading {
+	for _, rule := range rules {
+		switch {
+		case rule.Kind == FaultOutlier:
+			r.TemperatureC = offset(r.TemperatureC, rule.Offset)
+		case rule.Kind == FaultStale && stale:
+			r.Timestamp = r.Timestamp.Add(-rule.Staleness)
+		}
+	}
+	return r
+}
+
+// offset returns v plus d, or nil if v is nil.
+func offset(v *float64, d float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	return weather.Float64(*v + d)
+}
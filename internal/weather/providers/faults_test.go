@@ -0,0 +1,112 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// TestFaultInjector verifies that wrapped providers keep their capabilities,
+// that outlier and stale faults distort readings, and that injected errors
+// go through the provider's circuit breaker until it opens.
+func TestFaultInjector(t *testing.T) {
+	inner := fixtureProvider(t, WeatherAPIName, "/v1", "WEATHERAPI_API_KEY")
+	faults := NewFaultInjector()
+	p := faults.Wrap([]weather.Provider{inner})[0]
+
+	_, forecast := p.(weather.ForecastProvider)
+	_, hourly := p.(weather.HourlyForecastProvider)
+	_, history := p.(weather.HistoryProvider)
+	bp, ok := p.(BreakerProvider)
+	if !forecast || !hourly || !history || !ok || bp.Breaker() != inner.(BreakerProvider).Breaker() {
+		t.Fatalf("expected the wrapped provider to keep its capabilities, got %T", p)
+	}
+
+	ctx := context.Background()
+	want, err := inner.Fetch(ctx, fixtureLocation)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := faults.SetRules(WeatherAPIName, []FaultRule{
+		{Kind: FaultOutlier, Probability: 1, Offset: 40},
+		{Kind: FaultStale, Probability: 1, Staleness: 3 * time.Hour},
+		{Kind: FaultError, Probability: 1, Operations: []string{opForecast}},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := p.Fetch(ctx, fixtureLocation)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *got.TemperatureC != *want.TemperatureC+40 || !got.Timestamp.Equal(want.Timestamp.Add(-3*time.Hour)) {
+		t.Fatalf("expected an outlier 3h old, got %+v (real %+v)", got, want)
+	}
+
+	if err := faults.SetRules(WeatherAPIName, []FaultRule{{Kind: FaultError, Probability: 1, Status: http.StatusBadGateway}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The breaker opens after more than ConsecutiveFailures failures.
+	for i := 0; i <= int(DefaultBreaker.ConsecutiveFailures); i++ {
+		_, err := p.Fetch(ctx, fixtureLocation)
+		var perr *weather.ProviderError
+		if !errors.As(err, &perr) || perr.StatusCode != http.StatusBadGateway || !perr.Retryable {
+			t.Fatalf("call %d: expected an injected 502, got %v", i, err)
+		}
+	}
+	if _, err := p.Fetch(ctx, fixtureLocation); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("expected the breaker to open, got %v", err)
+	}
+	if state := bp.Breaker().Status().State; state != "open" {
+		t.Fatalf("expected an open breaker, got %s", state)
+	}
+
+	faults.Clear()
+	bp.Breaker().Reset()
+	if _, err := p.Fetch(ctx, fixtureLocation); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// TestFaultRuleSchedule verifies the schedule windows, operation filters and
+// validation of fault rules.
+func TestFaultRuleSchedule(t *testing.T) {
+	rule := FaultRule{Kind: FaultLatency, Probability: 1, Latency: time.Second, Every: time.Minute, For: 10 * time.Second, Operations: []string{opCurrent}}
+	for _, tc := range []struct {
+		op      string
+		elapsed time.Duration
+		want    bool
+	}{
+		{opCurrent, 0, true},
+		{opCurrent, 9 * time.Second, true},
+		{opCurrent, 10 * time.Second, false},
+		{opCurrent, 65 * time.Second, true},
+		{opForecast, 0, false},
+	} {
+		if got := rule.activeAt(tc.op, tc.elapsed); got != tc.want {
+			t.Errorf("%s at %v: expected active %v, got %v", tc.op, tc.elapsed, tc.want, got)
+		}
+	}
+
+	faults := NewFaultInjector()
+	if err := faults.SetRules(OpenMeteoName, []FaultRule{rule}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := faults.SetRules(OpenMeteoName, []FaultRule{
+		{Kind: "slow", Probability: 2},
+		{Kind: FaultError, Probability: 1, Status: 200, For: time.Second, Operations: []string{"geocode"}},
+	})
+	for _, want := range []string{"rules[0]: kind", "rules[0]: probability", "rules[1]: for", "rules[1]: operations", "rules[1]: status"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %q, got %v", want, err)
+		}
+	}
+	if rules := faults.Rules(OpenMeteoName); len(rules) != 1 || rules[0].Kind != FaultLatency {
+		t.Fatalf("expected the invalid rules to be rejected, got %+v", rules)
+	}
+}
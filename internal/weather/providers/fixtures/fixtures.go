@@ -0,0 +1,198 @@
+// Package fixtures records provider HTTP exchanges into golden files and
+// replays them from an httptest.Server, so that providers can be tested
+// offline against real API responses.
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces the values of sensitive query parameters in recordings.
+const Redacted = "REDACTED"
+
+// SensitiveParams are the query parameters whose values are redacted, such as
+// OpenWeather's appid and WeatherAPI's key. Names are matched case-insensitively.
+var SensitiveParams = []string{"appid", "key", "apikey", "api_key", "token"}
+
+// Exchange is one recorded request and its response.
+type Exchange struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Query is the encoded query with sensitive parameters redacted and keys
+	// sorted, see RedactQuery.
+	Query       string `json:"query"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	RetryAfter  string `json:"retry_after,omitempty"`
+	// Body holds a JSON response body as is, keeping golden files readable.
+	// Other bodies are stored in Text.
+	Body json.RawMessage `json:"body,omitempty"`
+	Text string          `json:"text,omitempty"`
+}
+
+// Cassette is the golden file of a sequence of exchanges.
+type Cassette struct {
+	Exchanges []Exchange `json:"exchanges"`
+}
+
+// Load reads the cassette at path.
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("fixtures: invalid cassette %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to path, creating its directory if needed.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// RedactQuery returns the encoded query of values with the values of
+// SensitiveParams replaced by Redacted. Keys are sorted, so the result can be
+// compared between recording and replay.
+func RedactQuery(values url.Values) string {
+	redacted := make(url.Values, len(values))
+	for k, v := range values {
+		if isSensitive(k) {
+			v = []string{Redacted}
+		}
+		redacted[k] = v
+	}
+	return redacted.Encode()
+}
+
+func isSensitive(param string) bool {
+	for _, s := range SensitiveParams {
+		if strings.EqualFold(param, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Recorder is an http.RoundTripper that sends requests with Next and records
+// each exchange, with sensitive query parameters redacted.
+type Recorder struct {
+	// Next sends the requests. If nil, http.DefaultTransport is used.
+	Next http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := r.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	ex := Exchange{
+		Method:      req.Method,
+		Path:        req.URL.Path,
+		Query:       RedactQuery(req.URL.Query()),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		RetryAfter:  resp.Header.Get("Retry-After"),
+	}
+	if json.Valid(body) {
+		ex.Body = body
+	} else {
+		ex.Text = string(body)
+	}
+
+	r.mu.Lock()
+	r.cassette.Exchanges = append(r.cassette.Exchanges, ex)
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// Cassette returns the exchanges recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Cassette{Exchanges: append([]Exchange(nil), r.cassette.Exchanges...)}
+}
+
+// NewServer starts a server replaying c. A request is answered with the next
+// unused exchange of the same method, path and redacted query, or the last
+// one once they are all used, so that retries and repeated calls replay a
+// recorded sequence. Requests matching no exchange get 404 with the request
+// in the body. The caller must Close the server.
+func NewServer(c *Cassette) *httptest.Server {
+	var mu sync.Mutex
+	used := make([]bool, len(c.Exchanges))
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := RedactQuery(req.URL.Query())
+
+		mu.Lock()
+		match := -1
+		for i, ex := range c.Exchanges {
+			if ex.Method != req.Method || ex.Path != req.URL.Path || ex.Query != query {
+				continue
+			}
+			match = i
+			if !used[i] {
+				used[i] = true
+				break
+			}
+		}
+		mu.Unlock()
+
+		if match < 0 {
+			http.Error(w, fmt.Sprintf("fixtures: no recorded exchange for %s %s?%s", req.Method, req.URL.Path, query), http.StatusNotFound)
+			return
+		}
+
+		ex := c.Exchanges[match]
+		if ex.ContentType != "" {
+			w.Header().Set("Content-Type", ex.ContentType)
+		}
+		if ex.RetryAfter != "" {
+			w.Header().Set("Retry-After", ex.RetryAfter)
+		}
+		w.WriteHeader(ex.Status)
+		if ex.Body != nil {
+			w.Write(ex.Body)
+		} else {
+			io.WriteString(w, ex.Text)
+		}
+	}))
+}
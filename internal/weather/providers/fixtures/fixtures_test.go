@@ -0,0 +1,75 @@
+package fixtures
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRecordAndReplay verifies that recorded exchanges have their secrets
+// redacted, survive a save and load, and are replayed in order for requests
+// with any key.
+func TestRecordAndReplay(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "3")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"main": {"temp": 12.5}}`)
+	}))
+	defer upstream.Close()
+
+	rec := &Recorder{}
+	client := &http.Client{Transport: rec}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(upstream.URL + "/data/2.5/weather?q=Paris&appid=secret")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := rec.Cassette().Save(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cassette, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cassette.Exchanges) != 2 || cassette.Exchanges[0].Query != "appid=REDACTED&q=Paris" {
+		t.Fatalf("unexpected exchanges: %+v", cassette.Exchanges)
+	}
+
+	srv := NewServer(cassette)
+	defer srv.Close()
+
+	get := func(query string) (int, string) {
+		resp, err := http.Get(srv.URL + "/data/2.5/weather?" + query)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, _ := get("appid=other&q=Paris"); status != http.StatusTooManyRequests {
+		t.Fatalf("expected the recorded 429 first, got %d", status)
+	}
+	for i := 0; i < 2; i++ {
+		if status, body := get("q=Paris&appid=other"); status != http.StatusOK || !strings.Contains(body, "12.5") {
+			t.Fatalf("expected the recorded reading, got %d %q", status, body)
+		}
+	}
+	if status, _ := get("q=Berlin&appid=other"); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unrecorded request, got %d", status)
+	}
+}
@@ -0,0 +1,201 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+var errLocationNotFound = errors.New("location not found")
+
+// Coordinates is a resolved latitude/longitude pair.
+type Coordinates struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Geocoder resolves a location (city/country) into coordinates for providers
+// that only accept lat/lon queries.
+type Geocoder interface {
+	Geocode(ctx context.Context, loc weather.Location) (Coordinates, error)
+}
+
+// OpenMeteoGeocoder implements Geocoder using Open-Meteo's keyless geocoding API.
+type OpenMeteoGeocoder struct {
+	baseURL string
+	httpCfg HTTPClientConfig
+	circuit *CircuitBreaker
+}
+
+// NewOpenMeteoGeocoder creates the Open-Meteo geocoder. Its API root defaults
+// to https://geocoding-api.open-meteo.com/v1.
+func NewOpenMeteoGeocoder(client *http.Client, opts ...Option) *OpenMeteoGeocoder {
+	o := newOptions("https://geocoding-api.open-meteo.com/v1", opts)
+
+	return &OpenMeteoGeocoder{
+		baseURL: o.baseURL,
+		httpCfg: HTTPClientConfig{
+			Client:      client,
+			Backoff:     o.backoff,
+			DecodeError: decodeOpenMeteoError,
+		},
+		circuit: newCircuitBreaker(o.breaker.settings("openmeteo-geocoding")),
+	}
+}
+
+// Geocode searches for the city by name and returns the first result whose
+// country code (or country name) matches the location's country.
+func (g *OpenMeteoGeocoder) Geocode(ctx context.Context, loc weather.Location) (Coordinates, error) {
+	if strings.TrimSpace(loc.City) == "" {
+		return Coordinates{}, fmt.Errorf("city is required for geocoding")
+	}
+
+	buildRequest := func() (*http.Request, error) {
+		values := url.Values{}
+		values.Set("name", loc.City)
+		values.Set("count", "10")
+		values.Set("language", "en")
+		values.Set("format", "json")
+
+		u := fmt.Sprintf("%s/search?%s", g.baseURL, values.Encode())
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+
+	resp, err := doRequestWithResilience(ctx, g.httpCfg, g.circuit, opGeocode, buildRequest)
+	if err != nil {
+		return Coordinates{}, err
+	}
+	defer resp.Body.Close()
+
+	var payload struct {
+		Results []struct {
+			Name        string  `json:"name"`
+			Latitude    float64 `json:"latitude"`
+			Longitude   float64 `json:"longitude"`
+			CountryCode string  `json:"country_code"`
+			Country     string  `json:"country"`
+		} `json:"results"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return Coordinates{}, err
+	}
+
+	for _, r := range payload.Results {
+		if loc.Country == "" ||
+			strings.EqualFold(r.CountryCode, loc.Country) ||
+			strings.EqualFold(r.Country, loc.Country) {
+			return Coordinates{Latitude: r.Latitude, Longitude: r.Longitude}, nil
+		}
+	}
+
+	return Coordinates{}, fmt.Errorf("%w: %s, %s", errLocationNotFound, loc.City, loc.Country)
+}
+
+// CachedGeocoder wraps another Geocoder with an in-memory cache that is
+// persisted to a JSON file, so coordinates survive restarts and each location
+// is only looked up once.
+type CachedGeocoder struct {
+	next Geocoder
+	path string // empty disables persistence
+
+	mu      sync.RWMutex
+	entries map[string]Coordinates
+}
+
+// NewCachedGeocoder creates a CachedGeocoder backed by the file at path.
+// A missing or unreadable cache file is not fatal; the cache starts empty.
+func NewCachedGeocoder(next Geocoder, path string) *CachedGeocoder {
+	g := &CachedGeocoder{
+		next:    next,
+		path:    path,
+		entries: make(map[string]Coordinates),
+	}
+
+	if path != "" {
+		if err := g.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("geocoder: ignoring unreadable cache %s: %v", path, err)
+		}
+	}
+
+	return g
+}
+
+func (g *CachedGeocoder) Geocode(ctx context.Context, loc weather.Location) (Coordinates, error) {
+	key := loc.Key()
+
+	g.mu.RLock()
+	coords, ok := g.entries[key]
+	g.mu.RUnlock()
+	if ok {
+		return coords, nil
+	}
+
+	coords, err := g.next.Geocode(ctx, loc)
+	if err != nil {
+		return Coordinates{}, err
+	}
+
+	g.mu.Lock()
+	g.entries[key] = coords
+	err = g.save()
+	g.mu.Unlock()
+	if err != nil {
+		// The lookup itself succeeded; a failed write only costs a repeat lookup after restart.
+		log.Printf("geocoder: failed to persist cache %s: %v", g.path, err)
+	}
+
+	return coords, nil
+}
+
+func (g *CachedGeocoder) load() error {
+	data, err := os.ReadFile(g.path)
+	if err != nil {
+		return err
+	}
+
+	var entries map[string]Coordinates
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	for k, v := range entries {
+		g.entries[k] = v
+	}
+	return nil
+}
+
+// save writes the cache atomically. Callers must hold g.mu.
+func (g *CachedGeocoder) save() error {
+	if g.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(g.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(g.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := g.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, g.path)
+}
@@ -6,43 +6,50 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/i474232898/weather-data-aggregation/internal/weather"
-	"github.com/kelvins/geocoder"
-	"github.com/sony/gobreaker"
 )
 
+// openMeteoTimeLayout is the local ISO8601 format Open-Meteo uses for hourly/current times.
+const openMeteoTimeLayout = "2006-01-02T15:04"
+
 // OpenMeteoProvider implements the weather.Provider interface for Open-Meteo.
 type OpenMeteoProvider struct {
-	name        string
-	baseURL     string
-	httpCfg     HTTPClientConfig
-	circuit     *gobreaker.CircuitBreaker
-	geocoderKey string
+	name     string
+	baseURL  string
+	httpCfg  HTTPClientConfig
+	circuit  *CircuitBreaker
+	geocoder Geocoder
 }
 
-func NewOpenMeteoProvider(client *http.Client, geocoderKey string) *OpenMeteoProvider {
-	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
-		Name:        "openmeteo",
-		MaxRequests: 5,
-		Interval:    1 * time.Minute,
-		Timeout:     2 * time.Minute,
-	})
+var (
+	_ weather.ForecastProvider       = (*OpenMeteoProvider)(nil)
+	_ weather.HourlyForecastProvider = (*OpenMeteoProvider)(nil)
+	_ weather.HistoryProvider        = (*OpenMeteoProvider)(nil)
+	_ BreakerProvider                = (*OpenMeteoProvider)(nil)
+	_ QuotaProvider                  = (*OpenMeteoProvider)(nil)
+)
+
+// NewOpenMeteoProvider creates the keyless Open-Meteo provider, which resolves
+// city/country locations with geocoder. Its API root defaults to
+// https://api.open-meteo.com/v1.
+func NewOpenMeteoProvider(client *http.Client, geocoder Geocoder, quota *Quota, opts ...Option) *OpenMeteoProvider {
+	o := newOptions("https://api.open-meteo.com/v1", opts)
 
 	return &OpenMeteoProvider{
-		name:        "openmeteo",
-		baseURL:     "https://api.open-meteo.com/v1/forecast",
-		geocoderKey: geocoderKey,
+		name:     OpenMeteoName,
+		baseURL:  o.baseURL,
+		geocoder: geocoder,
 		httpCfg: HTTPClientConfig{
-			Client: client,
-			Backoff: BackoffConfig{
-				MaxRetries:      3,
-				InitialInterval: 500 * time.Millisecond,
-				MaxInterval:     5 * time.Second,
-			},
+			Client:      client,
+			Backoff:     o.backoff,
+			Quota:       quota,
+			DecodeError: decodeOpenMeteoError,
 		},
-		circuit: cb,
+		circuit: newCircuitBreaker(o.breaker.settings(OpenMeteoName)),
 	}
 }
 
@@ -50,26 +57,27 @@ func (p *OpenMeteoProvider) Name() string {
 	return p.name
 }
 
-// NOTE: The forecast HTTP endpoint currently uses a placeholder implementation
-// based on the latest aggregated snapshot rather than calling a dedicated
-// provider-level forecast API. This provider continues to supply current
-// conditions only via Fetch; it can be extended in the future to expose
-// true multi-day forecast data when needed.
+// Breaker returns the provider's circuit breaker.
+func (p *OpenMeteoProvider) Breaker() *CircuitBreaker {
+	return p.circuit
+}
+
+// Quota returns the provider's request budget.
+func (p *OpenMeteoProvider) Quota() *Quota {
+	return p.httpCfg.Quota
+}
 
 func (p *OpenMeteoProvider) Fetch(ctx context.Context, loc weather.Location) (weather.ProviderReading, error) {
-	// Geocode city and country to get latitude and longitude
-	lat, lon, err := p.geocodeLocation(ctx, loc)
+	coords, err := p.geocodeLocation(ctx, loc)
 	if err != nil {
-		return weather.ProviderReading{}, fmt.Errorf("failed to geocode location %s: %w", loc.Key(), err)
+		return weather.ProviderReading{}, err
 	}
 
 	buildRequest := func() (*http.Request, error) {
-		values := url.Values{}
-		values.Set("latitude", fmt.Sprintf("%f", lat))
-		values.Set("longitude", fmt.Sprintf("%f", lon))
+		values := p.baseQuery(coords)
 		values.Set("current_weather", "true")
 
-		u := fmt.Sprintf("%s?%s", p.baseURL, values.Encode())
+		u := fmt.Sprintf("%s/forecast?%s", p.baseURL, values.Encode())
 		req, err := http.NewRequest(http.MethodGet, u, nil)
 		if err != nil {
 			return nil, err
@@ -77,7 +85,7 @@ func (p *OpenMeteoProvider) Fetch(ctx context.Context, loc weather.Location) (we
 		return req, nil
 	}
 
-	resp, err := doRequestWithResilience(ctx, p.httpCfg, p.circuit, buildRequest)
+	resp, err := doRequestWithResilience(ctx, p.httpCfg, p.circuit, opCurrent, buildRequest)
 	if err != nil {
 		return weather.ProviderReading{}, err
 	}
@@ -85,10 +93,10 @@ func (p *OpenMeteoProvider) Fetch(ctx context.Context, loc weather.Location) (we
 
 	var payload struct {
 		CurrentWeather struct {
-			Temperature float64 `json:"temperature"`
-			WindSpeed   float64 `json:"windspeed"`
-			Time        string  `json:"time"`
-			WeatherCode int     `json:"weathercode"`
+			Temperature *float64 `json:"temperature"`
+			WindSpeed   *float64 `json:"windspeed"`
+			Time        string   `json:"time"`
+			WeatherCode *int     `json:"weathercode"`
 		} `json:"current_weather"`
 	}
 
@@ -96,25 +104,303 @@ func (p *OpenMeteoProvider) Fetch(ctx context.Context, loc weather.Location) (we
 		return weather.ProviderReading{}, err
 	}
 
-	ts, err := time.Parse(time.RFC3339, payload.CurrentWeather.Time)
+	ts, err := time.Parse(openMeteoTimeLayout, payload.CurrentWeather.Time)
 	if err != nil {
 		ts = time.Now().UTC()
 	} else {
 		ts = ts.UTC()
 	}
 
-	cond := mapOpenMeteoCondition(payload.CurrentWeather.WeatherCode)
+	cond := weather.ConditionUnknown
+	if code := payload.CurrentWeather.WeatherCode; code != nil {
+		cond = mapOpenMeteoCondition(*code)
+	}
 
 	return weather.ProviderReading{
 		ProviderName: p.name,
 		Timestamp:    ts,
 		TemperatureC: payload.CurrentWeather.Temperature,
-		// Open-Meteo current_weather has limited fields; we fill what we can.
+		// Open-Meteo current_weather has limited fields; humidity, pressure
+		// and precipitation are left unset rather than reported as zero.
 		WindSpeedMS: payload.CurrentWeather.WindSpeed,
 		Condition:   cond,
 	}, nil
 }
 
+// FetchForecast retrieves a multi-day forecast using Open-Meteo's daily
+// variables and returns one DailyReading per day, ordered by ascending date.
+// The daily mean temperature is computed from the hourly temperatures of the
+// same request, since the daily variables only carry the extremes.
+func (p *OpenMeteoProvider) FetchForecast(ctx context.Context, loc weather.Location, days int) ([]weather.DailyReading, error) {
+	if days <= 0 {
+		return nil, fmt.Errorf("days must be greater than zero")
+	}
+
+	// Open-Meteo supports up to 16 forecast days.
+	if days > 16 {
+		days = 16
+	}
+
+	coords, err := p.geocodeLocation(ctx, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	buildRequest := func() (*http.Request, error) {
+		values := p.baseQuery(coords)
+		values.Set("daily", strings.Join([]string{
+			"weathercode",
+			"temperature_2m_max",
+			"temperature_2m_min",
+			"precipitation_sum",
+			"precipitation_probability_max",
+			"windspeed_10m_max",
+		}, ","))
+		values.Set("hourly", "temperature_2m")
+		values.Set("forecast_days", strconv.Itoa(days))
+
+		u := fmt.Sprintf("%s/forecast?%s", p.baseURL, values.Encode())
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+
+	resp, err := doRequestWithResilience(ctx, p.httpCfg, p.circuit, opForecast, buildRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var payload struct {
+		Daily struct {
+			Time             []string   `json:"time"`
+			WeatherCode      []*int     `json:"weathercode"`
+			TemperatureMax   []*float64 `json:"temperature_2m_max"`
+			TemperatureMin   []*float64 `json:"temperature_2m_min"`
+			PrecipitationSum []*float64 `json:"precipitation_sum"`
+			PrecipProbMax    []*float64 `json:"precipitation_probability_max"`
+			WindSpeedMax     []*float64 `json:"windspeed_10m_max"`
+		} `json:"daily"`
+		Hourly struct {
+			Time        []string   `json:"time"`
+			Temperature []*float64 `json:"temperature_2m"`
+		} `json:"hourly"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	daily := payload.Daily
+	n := len(daily.Time)
+	if len(daily.WeatherCode) < n || len(daily.TemperatureMax) < n || len(daily.TemperatureMin) < n ||
+		len(daily.PrecipitationSum) < n || len(daily.PrecipProbMax) < n || len(daily.WindSpeedMax) < n {
+		return nil, fmt.Errorf("openmeteo daily forecast arrays have mismatched lengths")
+	}
+
+	// Mean of hourly temperatures per date ("2006-01-02" prefix of the hourly time).
+	type tempAcc struct {
+		sum   float64
+		count int
+	}
+	hourlyTemps := make(map[string]*tempAcc)
+	for i, t := range payload.Hourly.Time {
+		if i >= len(payload.Hourly.Temperature) || payload.Hourly.Temperature[i] == nil || len(t) < 10 {
+			continue
+		}
+		acc, ok := hourlyTemps[t[:10]]
+		if !ok {
+			acc = &tempAcc{}
+			hourlyTemps[t[:10]] = acc
+		}
+		acc.sum += *payload.Hourly.Temperature[i]
+		acc.count++
+	}
+
+	readings := make([]weather.DailyReading, 0, n)
+	for i := 0; i < n && len(readings) < days; i++ {
+		ts, err := time.Parse("2006-01-02", daily.Time[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid openmeteo forecast date %q: %w", daily.Time[i], err)
+		}
+
+		var avg *float64
+		if acc, ok := hourlyTemps[daily.Time[i]]; ok && acc.count > 0 {
+			avg = weather.Float64(acc.sum / float64(acc.count))
+		}
+
+		cond := weather.ConditionUnknown
+		if code := daily.WeatherCode[i]; code != nil {
+			cond = mapOpenMeteoCondition(*code)
+		}
+
+		readings = append(readings, weather.DailyReading{
+			ProviderName:      p.name,
+			Date:              ts.UTC(),
+			TempMinC:          daily.TemperatureMin[i],
+			TempMaxC:          daily.TemperatureMax[i],
+			TempAvgC:          avg,
+			MaxWindSpeedMS:    daily.WindSpeedMax[i],
+			TotalPrecipMm:     daily.PrecipitationSum[i],
+			PrecipProbability: daily.PrecipProbMax[i],
+			Condition:         cond,
+		})
+	}
+
+	return readings, nil
+}
+
+// FetchHourlyForecast retrieves Open-Meteo's hourly forecast for the next
+// `hours` hours, starting from the current hour, ordered by time.
+func (p *OpenMeteoProvider) FetchHourlyForecast(ctx context.Context, loc weather.Location, hours int) ([]weather.ProviderReading, error) {
+	if hours <= 0 {
+		return nil, fmt.Errorf("hours must be greater than zero")
+	}
+
+	// Request whole days covering the window (today included), up to the 16-day limit.
+	days := hours/24 + 2
+	if days > 16 {
+		days = 16
+	}
+
+	start := time.Now().UTC().Truncate(time.Hour)
+	end := start.Add(time.Duration(hours) * time.Hour)
+
+	values := url.Values{}
+	values.Set("forecast_days", strconv.Itoa(days))
+	return p.fetchHourly(ctx, loc, values, opHourly, start, end)
+}
+
+// openMeteoMaxPastDays is the furthest back the forecast API's past_days reaches.
+const openMeteoMaxPastDays = 92
+
+// FetchHistory returns Open-Meteo's hourly data for [from, to), using the
+// forecast API's past_days, which reaches back up to 92 days.
+func (p *OpenMeteoProvider) FetchHistory(ctx context.Context, loc weather.Location, from, to time.Time) ([]weather.ProviderReading, error) {
+	now := time.Now().UTC()
+	if !from.Before(to) || !from.Before(now) {
+		return nil, nil
+	}
+
+	// past_days counts whole days before today.
+	today := now.Truncate(24 * time.Hour)
+	pastDays := int(today.Sub(from.UTC().Truncate(24*time.Hour)) / (24 * time.Hour))
+	if pastDays > openMeteoMaxPastDays {
+		pastDays = openMeteoMaxPastDays
+	}
+
+	values := url.Values{}
+	values.Set("past_days", strconv.Itoa(pastDays))
+	values.Set("forecast_days", "1")
+	if to.After(now) {
+		to = now
+	}
+	return p.fetchHourly(ctx, loc, values, opHistory, from.UTC(), to.UTC())
+}
+
+// fetchHourly requests Open-Meteo's hourly variables with the given extra
+// query parameters and returns the readings in [start, end), ordered by time.
+// op labels the request in metrics.
+func (p *OpenMeteoProvider) fetchHourly(ctx context.Context, loc weather.Location, extra url.Values, op string, start, end time.Time) ([]weather.ProviderReading, error) {
+	coords, err := p.geocodeLocation(ctx, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	buildRequest := func() (*http.Request, error) {
+		values := p.baseQuery(coords)
+		values.Set("hourly", strings.Join([]string{
+			"weathercode",
+			"temperature_2m",
+			"relative_humidity_2m",
+			"pressure_msl",
+			"precipitation",
+			"windspeed_10m",
+		}, ","))
+		for k, v := range extra {
+			values[k] = v
+		}
+
+		u := fmt.Sprintf("%s/forecast?%s", p.baseURL, values.Encode())
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+
+	resp, err := doRequestWithResilience(ctx, p.httpCfg, p.circuit, op, buildRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var payload struct {
+		Hourly struct {
+			Time          []string   `json:"time"`
+			WeatherCode   []*int     `json:"weathercode"`
+			Temperature   []*float64 `json:"temperature_2m"`
+			Humidity      []*float64 `json:"relative_humidity_2m"`
+			Pressure      []*float64 `json:"pressure_msl"`
+			Precipitation []*float64 `json:"precipitation"`
+			WindSpeed     []*float64 `json:"windspeed_10m"`
+		} `json:"hourly"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	hourly := payload.Hourly
+	n := len(hourly.Time)
+	if len(hourly.WeatherCode) < n || len(hourly.Temperature) < n || len(hourly.Humidity) < n ||
+		len(hourly.Pressure) < n || len(hourly.Precipitation) < n || len(hourly.WindSpeed) < n {
+		return nil, fmt.Errorf("openmeteo hourly arrays have mismatched lengths")
+	}
+
+	var readings []weather.ProviderReading
+	for i := 0; i < n; i++ {
+		ts, err := time.Parse(openMeteoTimeLayout, hourly.Time[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid openmeteo hourly time %q: %w", hourly.Time[i], err)
+		}
+		if ts.Before(start) || !ts.Before(end) {
+			continue
+		}
+
+		cond := weather.ConditionUnknown
+		if code := hourly.WeatherCode[i]; code != nil {
+			cond = mapOpenMeteoCondition(*code)
+		}
+
+		readings = append(readings, weather.ProviderReading{
+			ProviderName: p.name,
+			Timestamp:    ts.UTC(),
+			TemperatureC: hourly.Temperature[i],
+			HumidityPct:  hourly.Humidity[i],
+			WindSpeedMS:  hourly.WindSpeed[i],
+			PressureHpa:  hourly.Pressure[i],
+			PrecipMm:     hourly.Precipitation[i],
+			Condition:    cond,
+		})
+	}
+
+	return readings, nil
+}
+
+// baseQuery returns the query parameters shared by all Open-Meteo forecast requests.
+// Times are requested in UTC and wind speed in m/s to match the normalized model.
+func (p *OpenMeteoProvider) baseQuery(coords Coordinates) url.Values {
+	values := url.Values{}
+	values.Set("latitude", strconv.FormatFloat(coords.Latitude, 'f', 4, 64))
+	values.Set("longitude", strconv.FormatFloat(coords.Longitude, 'f', 4, 64))
+	values.Set("timezone", "UTC")
+	values.Set("windspeed_unit", "ms")
+	return values
+}
+
 func mapOpenMeteoCondition(code int) weather.Condition {
 	// Mapping based on Open-Meteo weather codes (simplified).
 	switch {
@@ -122,9 +408,11 @@ func mapOpenMeteoCondition(code int) weather.Condition {
 		return weather.ConditionClear
 	case code >= 1 && code <= 3:
 		return weather.ConditionCloudy
+	case code == 45 || code == 48:
+		return weather.ConditionMist
 	case (code >= 51 && code <= 67) || (code >= 80 && code <= 82):
 		return weather.ConditionRain
-	case code >= 71 && code <= 77:
+	case (code >= 71 && code <= 77) || code == 85 || code == 86:
 		return weather.ConditionSnow
 	case code >= 95:
 		return weather.ConditionStorm
@@ -133,28 +421,32 @@ func mapOpenMeteoCondition(code int) weather.Condition {
 	}
 }
 
-// geocodeLocation converts a city and country name to latitude and longitude using geocoder.
-func (p *OpenMeteoProvider) geocodeLocation(ctx context.Context, loc weather.Location) (float64, float64, error) {
-	// Set the geocoder API key if provided
-	if p.geocoderKey != "" {
-		geocoder.ApiKey = p.geocoderKey
+// geocodeLocation returns the location's own coordinates when present, or
+// resolves them via the configured Geocoder.
+func (p *OpenMeteoProvider) geocodeLocation(ctx context.Context, loc weather.Location) (Coordinates, error) {
+	if loc.HasCoordinates() {
+		return Coordinates{Latitude: *loc.Lat, Longitude: *loc.Lon}, nil
 	}
-
-	// Build the address for geocoding
-	address := geocoder.Address{
-		City:    loc.City,
-		Country: loc.Country,
+	if p.geocoder == nil {
+		return Coordinates{}, fmt.Errorf("openmeteo geocoder is not configured")
 	}
 
-	// Perform geocoding
-	location, err := geocoder.Geocoding(address)
+	coords, err := p.geocoder.Geocode(ctx, loc)
 	if err != nil {
-		return 0, 0, fmt.Errorf("geocoding failed: %w", err)
+		return Coordinates{}, fmt.Errorf("failed to geocode location %s: %w", loc.Key(), err)
 	}
+	return coords, nil
+}
 
-	if location.Latitude == 0 && location.Longitude == 0 {
-		return 0, 0, fmt.Errorf("geocoding returned zero coordinates for %s, %s", loc.City, loc.Country)
+// decodeOpenMeteoError reads Open-Meteo's error body, e.g.
+// {"error": true, "reason": "Latitude must be in range of -90 to 90°."}.
+// It has no error codes. The geocoding API uses the same format.
+func decodeOpenMeteoError(body []byte) (code, message string) {
+	var payload struct {
+		Reason string `json:"reason"`
 	}
-
-	return location.Latitude, location.Longitude, nil
+	if json.Unmarshal(body, &payload) != nil {
+		return "", ""
+	}
+	return "", payload.Reason
 }
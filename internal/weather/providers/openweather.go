@@ -7,11 +7,11 @@ import (
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/i474232898/weather-data-aggregation/internal/weather"
-	"github.com/sony/gobreaker"
 )
 
 // OpenWeatherProvider implements the weather.Provider interface for OpenWeatherMap.
@@ -20,30 +20,32 @@ type OpenWeatherProvider struct {
 	apiKey  string
 	baseURL string
 	httpCfg HTTPClientConfig
-	circuit *gobreaker.CircuitBreaker
+	circuit *CircuitBreaker
 }
 
-func NewOpenWeatherProvider(client *http.Client, apiKey string) *OpenWeatherProvider {
-	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
-		Name:        "openweather",
-		MaxRequests: 5,
-		Interval:    1 * time.Minute,
-		Timeout:     2 * time.Minute,
-	})
+var (
+	_ weather.ForecastProvider       = (*OpenWeatherProvider)(nil)
+	_ weather.HourlyForecastProvider = (*OpenWeatherProvider)(nil)
+	_ BreakerProvider                = (*OpenWeatherProvider)(nil)
+	_ QuotaProvider                  = (*OpenWeatherProvider)(nil)
+)
+
+// NewOpenWeatherProvider creates the OpenWeatherMap provider. Its API root
+// defaults to https://api.openweathermap.org/data/2.5.
+func NewOpenWeatherProvider(client *http.Client, apiKey string, quota *Quota, opts ...Option) *OpenWeatherProvider {
+	o := newOptions("https://api.openweathermap.org/data/2.5", opts)
 
 	return &OpenWeatherProvider{
-		name:    "openweathermap",
+		name:    OpenWeatherName,
 		apiKey:  apiKey,
-		baseURL: "https://api.openweathermap.org/data/2.5/weather",
+		baseURL: o.baseURL,
 		httpCfg: HTTPClientConfig{
-			Client: client,
-			Backoff: BackoffConfig{
-				MaxRetries:      3,
-				InitialInterval: 500 * time.Millisecond,
-				MaxInterval:     5 * time.Second,
-			},
+			Client:      client,
+			Backoff:     o.backoff,
+			Quota:       quota,
+			DecodeError: decodeOpenWeatherError,
 		},
-		circuit: cb,
+		circuit: newCircuitBreaker(o.breaker.settings(OpenWeatherName)),
 	}
 }
 
@@ -51,23 +53,28 @@ func (p *OpenWeatherProvider) Name() string {
 	return p.name
 }
 
+// Breaker returns the provider's circuit breaker.
+func (p *OpenWeatherProvider) Breaker() *CircuitBreaker {
+	return p.circuit
+}
+
+// Quota returns the provider's request budget.
+func (p *OpenWeatherProvider) Quota() *Quota {
+	return p.httpCfg.Quota
+}
+
 func (p *OpenWeatherProvider) Fetch(ctx context.Context, loc weather.Location) (weather.ProviderReading, error) {
 	if p.apiKey == "" {
-		return weather.ProviderReading{}, fmt.Errorf("openweather api key is not configured")
+		return weather.ProviderReading{}, fmt.Errorf("openweather %w", ErrMissingAPIKey)
 	}
 
 	buildRequest := func() (*http.Request, error) {
 		values := url.Values{}
 		values.Set("appid", p.apiKey)
 		values.Set("units", "metric")
+		setOpenWeatherLocation(values, loc)
 
-		q := loc.City
-		if loc.Country != "" {
-			q = fmt.Sprintf("%s,%s", loc.City, loc.Country)
-		}
-		values.Set("q", q)
-
-		u := fmt.Sprintf("%s?%s", p.baseURL, values.Encode())
+		u := fmt.Sprintf("%s/weather?%s", p.baseURL, values.Encode())
 		req, err := http.NewRequest(http.MethodGet, u, nil)
 		if err != nil {
 			return nil, err
@@ -75,7 +82,7 @@ func (p *OpenWeatherProvider) Fetch(ctx context.Context, loc weather.Location) (
 		return req, nil
 	}
 
-	resp, err := doRequestWithResilience(ctx, p.httpCfg, p.circuit, buildRequest)
+	resp, err := doRequestWithResilience(ctx, p.httpCfg, p.circuit, opCurrent, buildRequest)
 	if err != nil {
 		return weather.ProviderReading{}, err
 	}
@@ -84,16 +91,16 @@ func (p *OpenWeatherProvider) Fetch(ctx context.Context, loc weather.Location) (
 	var payload struct {
 		Dt   int64 `json:"dt"`
 		Main struct {
-			Temp     float64 `json:"temp"`
-			Humidity float64 `json:"humidity"`
-			Pressure float64 `json:"pressure"`
+			Temp     *float64 `json:"temp"`
+			Humidity *float64 `json:"humidity"`
+			Pressure *float64 `json:"pressure"`
 		} `json:"main"`
 		Wind struct {
-			Speed float64 `json:"speed"`
+			Speed *float64 `json:"speed"`
 		} `json:"wind"`
 		Rain struct {
-			OneH   float64 `json:"1h"`
-			ThreeH float64 `json:"3h"`
+			OneH   *float64 `json:"1h"`
+			ThreeH *float64 `json:"3h"`
 		} `json:"rain"`
 		Weather []struct {
 			Main string `json:"main"`
@@ -109,10 +116,14 @@ func (p *OpenWeatherProvider) Fetch(ctx context.Context, loc weather.Location) (
 		ts = time.Now().UTC()
 	}
 
+	// OpenWeather omits the rain block entirely when it is dry, so absence means 0 mm.
 	precip := payload.Rain.OneH
-	if precip == 0 {
+	if precip == nil {
 		precip = payload.Rain.ThreeH
 	}
+	if precip == nil {
+		precip = weather.Float64(0)
+	}
 
 	cond := mapOpenWeatherCondition(payload.Weather)
 
@@ -129,12 +140,12 @@ func (p *OpenWeatherProvider) Fetch(ctx context.Context, loc weather.Location) (
 }
 
 // FetchForecast retrieves a multi-day forecast from OpenWeatherMap's 5-day / 3-hour
-// forecast API, normalizes it into one representative reading per day, and returns
-// at most `days` entries ordered by ascending date.
-func (p *OpenWeatherProvider) FetchForecast(ctx context.Context, loc weather.Location, days int) ([]weather.ProviderReading, error) {
-	if p.apiKey == "" {
-		return nil, fmt.Errorf("openweather api key is not configured")
-	}
+// forecast API and summarizes the slots of each UTC day into a DailyReading:
+// min/max/mean of slot temperatures, max wind, summed precipitation, the highest
+// slot probability of precipitation and the most frequent condition. The first
+// and last day may only be partially covered by slots. At most `days` entries are
+// returned, ordered by ascending date.
+func (p *OpenWeatherProvider) FetchForecast(ctx context.Context, loc weather.Location, days int) ([]weather.DailyReading, error) {
 	if days <= 0 {
 		return nil, fmt.Errorf("days must be greater than zero")
 	}
@@ -144,18 +155,118 @@ func (p *OpenWeatherProvider) FetchForecast(ctx context.Context, loc weather.Loc
 		days = 5
 	}
 
-	forecastURL := strings.Replace(p.baseURL, "/weather", "/forecast", 1)
+	slots, err := p.fetchForecastSlots(ctx, loc, opForecast)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []weather.DailyReading
+	var conditions []weather.Condition
+	var tempSum float64
+	var tempCount int
+
+	flush := func() {
+		if len(result) == 0 {
+			return
+		}
+		day := &result[len(result)-1]
+		if tempCount > 0 {
+			day.TempAvgC = weather.Float64(tempSum / float64(tempCount))
+		}
+		day.Condition = weather.DominantCondition(conditions)
+	}
+
+	for _, slot := range slots {
+		r := slot.reading
+		date := time.Date(r.Timestamp.Year(), r.Timestamp.Month(), r.Timestamp.Day(), 0, 0, 0, 0, time.UTC)
+
+		if len(result) == 0 || !result[len(result)-1].Date.Equal(date) {
+			flush()
+			if len(result) >= days {
+				return result, nil
+			}
+			result = append(result, weather.DailyReading{ProviderName: p.name, Date: date})
+			conditions, tempSum, tempCount = nil, 0, 0
+		}
+
+		day := &result[len(result)-1]
+		if r.TemperatureC != nil {
+			day.TempMinC = minPtr(day.TempMinC, *r.TemperatureC)
+			day.TempMaxC = maxPtr(day.TempMaxC, *r.TemperatureC)
+			tempSum += *r.TemperatureC
+			tempCount++
+		}
+		if r.WindSpeedMS != nil {
+			day.MaxWindSpeedMS = maxPtr(day.MaxWindSpeedMS, *r.WindSpeedMS)
+		}
+		if r.PrecipMm != nil {
+			total := *r.PrecipMm
+			if day.TotalPrecipMm != nil {
+				total += *day.TotalPrecipMm
+			}
+			day.TotalPrecipMm = weather.Float64(total)
+		}
+		if slot.pop != nil {
+			day.PrecipProbability = maxPtr(day.PrecipProbability, *slot.pop*100)
+		}
+		conditions = append(conditions, r.Condition)
+	}
+	flush()
+
+	return result, nil
+}
+
+// FetchHourlyForecast returns the raw 3-hour forecast slots covering the next
+// `hours` hours. Precipitation is converted from the 3-hour total to mm per hour;
+// the service interpolates the slots onto an hourly grid.
+func (p *OpenWeatherProvider) FetchHourlyForecast(ctx context.Context, loc weather.Location, hours int) ([]weather.ProviderReading, error) {
+	if hours <= 0 {
+		return nil, fmt.Errorf("hours must be greater than zero")
+	}
+
+	slots, err := p.fetchForecastSlots(ctx, loc, opHourly)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep one slot past the horizon so the last hours can still be interpolated.
+	horizon := time.Now().UTC().Truncate(time.Hour).Add(time.Duration(hours) * time.Hour)
+
+	result := make([]weather.ProviderReading, 0, len(slots))
+	for _, slot := range slots {
+		r := slot.reading
+		if r.PrecipMm != nil {
+			r.PrecipMm = weather.Float64(*r.PrecipMm / 3)
+		}
+		result = append(result, r)
+		if !r.Timestamp.Before(horizon) {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// openWeatherSlot is one 3-hour entry of the forecast API.
+type openWeatherSlot struct {
+	reading weather.ProviderReading // PrecipMm holds the 3-hour total
+	pop     *float64                // probability of precipitation, 0-1
+}
+
+// fetchForecastSlots calls the 5-day / 3-hour forecast API and returns every
+// slot ordered by time. op labels the request in metrics.
+func (p *OpenWeatherProvider) fetchForecastSlots(ctx context.Context, loc weather.Location, op string) ([]openWeatherSlot, error) {
+	if p.apiKey == "" {
+		return nil, fmt.Errorf("openweather %w", ErrMissingAPIKey)
+	}
+
+	forecastURL := p.baseURL + "/forecast"
 
 	buildRequest := func() (*http.Request, error) {
 		values := url.Values{}
 		values.Set("appid", p.apiKey)
 		values.Set("units", "metric")
-
-		q := loc.City
-		if loc.Country != "" {
-			q = fmt.Sprintf("%s,%s", loc.City, loc.Country)
-		}
-		values.Set("q", q)
+		setOpenWeatherLocation(values, loc)
 
 		u := fmt.Sprintf("%s?%s", forecastURL, values.Encode())
 		req, err := http.NewRequest(http.MethodGet, u, nil)
@@ -165,7 +276,7 @@ func (p *OpenWeatherProvider) FetchForecast(ctx context.Context, loc weather.Loc
 		return req, nil
 	}
 
-	resp, err := doRequestWithResilience(ctx, p.httpCfg, p.circuit, buildRequest)
+	resp, err := doRequestWithResilience(ctx, p.httpCfg, p.circuit, op, buildRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -175,16 +286,17 @@ func (p *OpenWeatherProvider) FetchForecast(ctx context.Context, loc weather.Loc
 		List []struct {
 			Dt   int64 `json:"dt"`
 			Main struct {
-				Temp     float64 `json:"temp"`
-				Humidity float64 `json:"humidity"`
-				Pressure float64 `json:"pressure"`
+				Temp     *float64 `json:"temp"`
+				Humidity *float64 `json:"humidity"`
+				Pressure *float64 `json:"pressure"`
 			} `json:"main"`
 			Wind struct {
-				Speed float64 `json:"speed"`
+				Speed *float64 `json:"speed"`
 			} `json:"wind"`
 			Rain struct {
-				ThreeH float64 `json:"3h"`
+				ThreeH *float64 `json:"3h"`
 			} `json:"rain"`
+			Pop     *float64 `json:"pop"`
 			Weather []struct {
 				Main string `json:"main"`
 			} `json:"weather"`
@@ -195,69 +307,48 @@ func (p *OpenWeatherProvider) FetchForecast(ctx context.Context, loc weather.Loc
 		return nil, err
 	}
 
-	type daySummary struct {
-		reading    weather.ProviderReading
-		middaySeen bool
-	}
-
-	daysMap := make(map[string]*daySummary)
-
+	slots := make([]openWeatherSlot, 0, len(payload.List))
 	for _, item := range payload.List {
-		ts := time.Unix(item.Dt, 0).UTC()
-		dateKey := ts.Format("2006-01-02")
-
 		precip := item.Rain.ThreeH
-		cond := mapOpenWeatherCondition(item.Weather)
-
-		r := weather.ProviderReading{
-			ProviderName: p.name,
-			Timestamp:    ts,
-			TemperatureC: item.Main.Temp,
-			HumidityPct:  item.Main.Humidity,
-			WindSpeedMS:  item.Wind.Speed,
-			PressureHpa:  item.Main.Pressure,
-			PrecipMm:     precip,
-			Condition:    cond,
+		if precip == nil {
+			precip = weather.Float64(0)
 		}
 
-		summary, ok := daysMap[dateKey]
-		if !ok {
-			daysMap[dateKey] = &daySummary{
-				reading:    r,
-				middaySeen: ts.Hour() == 12,
-			}
-			continue
-		}
-
-		// Prefer a forecast around midday (12:00) for each day; if we
-		// haven't seen one yet and this entry is at 12:00, replace.
-		if !summary.middaySeen && ts.Hour() == 12 {
-			summary.reading = r
-			summary.middaySeen = true
-		}
+		slots = append(slots, openWeatherSlot{
+			reading: weather.ProviderReading{
+				ProviderName: p.name,
+				Timestamp:    time.Unix(item.Dt, 0).UTC(),
+				TemperatureC: item.Main.Temp,
+				HumidityPct:  item.Main.Humidity,
+				WindSpeedMS:  item.Wind.Speed,
+				PressureHpa:  item.Main.Pressure,
+				PrecipMm:     precip,
+				Condition:    mapOpenWeatherCondition(item.Weather),
+			},
+			pop: item.Pop,
+		})
 	}
 
-	if len(daysMap) == 0 {
-		return nil, nil
-	}
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].reading.Timestamp.Before(slots[j].reading.Timestamp)
+	})
 
-	keys := make([]string, 0, len(daysMap))
-	for k := range daysMap {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
+	return slots, nil
+}
 
-	result := make([]weather.ProviderReading, 0, days)
-	for _, k := range keys {
-		if len(result) >= days {
-			break
-		}
-		if summary := daysMap[k]; summary != nil {
-			result = append(result, summary.reading)
-		}
+// setOpenWeatherLocation queries by coordinates when available, otherwise by "city,country".
+func setOpenWeatherLocation(values url.Values, loc weather.Location) {
+	if loc.HasCoordinates() {
+		values.Set("lat", strconv.FormatFloat(*loc.Lat, 'f', -1, 64))
+		values.Set("lon", strconv.FormatFloat(*loc.Lon, 'f', -1, 64))
+		return
 	}
 
-	return result, nil
+	q := loc.City
+	if loc.Country != "" {
+		q = fmt.Sprintf("%s,%s", loc.City, loc.Country)
+	}
+	values.Set("q", q)
 }
 
 func mapOpenWeatherCondition(items []struct {
@@ -281,3 +372,17 @@ func mapOpenWeatherCondition(items []struct {
 		return weather.ConditionUnknown
 	}
 }
+
+// decodeOpenWeatherError reads OpenWeatherMap's error body, e.g.
+// {"cod": 401, "message": "Invalid API key"}. cod is a number or a string
+// depending on the endpoint.
+func decodeOpenWeatherError(body []byte) (code, message string) {
+	var payload struct {
+		Cod     json.RawMessage `json:"cod"`
+		Message string          `json:"message"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		return "", ""
+	}
+	return strings.Trim(string(payload.Cod), `"`), payload.Message
+}
@@ -0,0 +1,101 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sony/gobreaker"
+)
+
+// DefaultBackoff is the retry policy providers use unless overridden with WithBackoff.
+var DefaultBackoff = BackoffConfig{
+	MaxRetries:      3,
+	InitialInterval: 500 * time.Millisecond,
+	MaxInterval:     5 * time.Second,
+}
+
+// BreakerConfig tunes a provider's circuit breaker.
+type BreakerConfig struct {
+	// MaxRequests is the number of trial requests let through while half-open.
+	MaxRequests uint32
+	// Interval is the cyclic period after which the closed breaker clears
+	// its counts. Zero never clears them.
+	Interval time.Duration
+	// Timeout is how long the breaker stays open before going half-open.
+	Timeout time.Duration
+	// ConsecutiveFailures trips the breaker once more than this many calls
+	// have failed in a row.
+	ConsecutiveFailures uint32
+}
+
+// DefaultBreaker is the breaker configuration providers use unless
+// overridden with WithBreaker. Its trip threshold is gobreaker's default.
+var DefaultBreaker = BreakerConfig{
+	MaxRequests:         5,
+	Interval:            time.Minute,
+	Timeout:             2 * time.Minute,
+	ConsecutiveFailures: 5,
+}
+
+// settings returns the gobreaker settings for a breaker named name.
+func (c BreakerConfig) settings(name string) gobreaker.Settings {
+	threshold := c.ConsecutiveFailures
+	return gobreaker.Settings{
+		Name:        name,
+		MaxRequests: c.MaxRequests,
+		Interval:    c.Interval,
+		Timeout:     c.Timeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures > threshold
+		},
+		// A caller that gave up says nothing about the provider's health.
+		IsSuccessful: func(err error) bool {
+			return err == nil || errors.Is(err, context.Canceled)
+		},
+	}
+}
+
+// Option overrides a default of a provider (or geocoder) constructor.
+type Option func(*options)
+
+type options struct {
+	baseURL string
+	backoff BackoffConfig
+	breaker BreakerConfig
+}
+
+// WithBaseURL points a provider at a different API root, e.g. a mock server.
+// The URL is the root the provider's endpoints are relative to, such as
+// "https://api.weatherapi.com/v1". An empty URL keeps the default.
+func WithBaseURL(u string) Option {
+	return func(o *options) {
+		if u != "" {
+			o.baseURL = strings.TrimRight(u, "/")
+		}
+	}
+}
+
+// WithBackoff replaces the provider's retry policy.
+func WithBackoff(b BackoffConfig) Option {
+	return func(o *options) {
+		o.backoff = b
+	}
+}
+
+// WithBreaker replaces the provider's circuit breaker configuration.
+func WithBreaker(b BreakerConfig) Option {
+	return func(o *options) {
+		o.breaker = b
+	}
+}
+
+// newOptions applies opts over the defaults, with baseURL as the default API root.
+func newOptions(baseURL string, opts []Option) options {
+	o := options{baseURL: baseURL, backoff: DefaultBackoff, breaker: DefaultBreaker}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,175 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaConfig sets a provider's request budget. Zero means unlimited.
+type QuotaConfig struct {
+	PerMinute int
+	PerDay    int
+}
+
+// Quota throttles a provider's upstream requests ahead of time so that free
+// tier limits are not hit. The per-minute limit is a token bucket (bursts of
+// up to PerMinute requests); the per-day limit is a counter that resets at
+// midnight UTC. Every HTTP attempt, including retries, uses one request.
+type Quota struct {
+	cfg    QuotaConfig
+	minute *rate.Limiter // nil when unlimited
+
+	mu       sync.Mutex
+	day      time.Time // UTC midnight of the current day
+	used     int
+	rejected int
+}
+
+// QuotaUsage reports how much of a provider's budget has been used today.
+type QuotaUsage struct {
+	PerMinute      int       `json:"perMinute,omitempty"`
+	PerDay         int       `json:"perDay,omitempty"`
+	UsedToday      int       `json:"usedToday"`
+	RemainingToday *int      `json:"remainingToday,omitempty"`
+	RejectedToday  int       `json:"rejectedToday"`
+	ResetsAt       time.Time `json:"resetsAt"`
+}
+
+// QuotaProvider is implemented by providers whose requests are budgeted by a Quota.
+type QuotaProvider interface {
+	Quota() *Quota
+}
+
+// NewQuota creates a Quota. A zero QuotaConfig only counts usage.
+func NewQuota(cfg QuotaConfig) *Quota {
+	q := &Quota{cfg: cfg}
+	if cfg.PerMinute > 0 {
+		q.minute = rate.NewLimiter(rate.Limit(float64(cfg.PerMinute)/60), cfg.PerMinute)
+	}
+	return q
+}
+
+// SetConfig changes the budget, e.g. on a configuration reload. Today's
+// usage is kept, so a lower daily budget may already be used up.
+func (q *Quota) SetConfig(cfg QuotaConfig) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if cfg == q.cfg {
+		return
+	}
+	q.cfg = cfg
+	q.minute = nil
+	if cfg.PerMinute > 0 {
+		q.minute = rate.NewLimiter(rate.Limit(float64(cfg.PerMinute)/60), cfg.PerMinute)
+	}
+}
+
+// Allow takes one request from the budget, or returns an error wrapping
+// errQuotaExceeded that names the exhausted limit. A nil Quota allows everything.
+func (q *Quota) Allow() error {
+	_, err := q.take()
+	return err
+}
+
+// take is Allow, returning a function that gives the request back to the
+// daily budget if it is not sent after all, e.g. because the circuit breaker
+// rejects it. The per-minute token is not given back; it refills anyway.
+func (q *Quota) take() (release func(), err error) {
+	if q == nil {
+		return func() {}, nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rollover(time.Now())
+
+	if q.cfg.PerDay > 0 && q.used >= q.cfg.PerDay {
+		q.rejected++
+		return nil, fmt.Errorf("%w: daily budget of %d requests used up", errQuotaExceeded, q.cfg.PerDay)
+	}
+	if q.minute != nil && !q.minute.Allow() {
+		q.rejected++
+		return nil, fmt.Errorf("%w: rate limit of %d requests per minute reached", errQuotaExceeded, q.cfg.PerMinute)
+	}
+
+	q.used++
+	day := q.day
+	return func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		if q.day.Equal(day) && q.used > 0 {
+			q.used--
+		}
+	}, nil
+}
+
+// Usage returns the budget and today's usage.
+func (q *Quota) Usage() QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rollover(time.Now())
+
+	usage := QuotaUsage{
+		PerMinute:     q.cfg.PerMinute,
+		PerDay:        q.cfg.PerDay,
+		UsedToday:     q.used,
+		RejectedToday: q.rejected,
+		ResetsAt:      q.day.AddDate(0, 0, 1),
+	}
+	if q.cfg.PerDay > 0 {
+		remaining := max(q.cfg.PerDay-q.used, 0)
+		usage.RemainingToday = &remaining
+	}
+	return usage
+}
+
+// rollover resets the daily counters when a new UTC day has started.
+// Callers must hold q.mu.
+func (q *Quota) rollover(now time.Time) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	if today.After(q.day) {
+		q.day = today
+		q.used = 0
+		q.rejected = 0
+	}
+}
+
+// PacingRate returns the highest rate, in fetches per second, at which
+// locations can be fetched without outrunning any provider's per-minute or
+// per-day budget, assuming one request per provider per fetch. It returns 0
+// if no provider has a budget.
+func PacingRate(provs []weather.Provider) rate.Limit {
+	var limit rate.Limit
+	lower := func(l rate.Limit) {
+		if limit == 0 || l < limit {
+			limit = l
+		}
+	}
+
+	for _, p := range provs {
+		qp, ok := p.(QuotaProvider)
+		if !ok || qp.Quota() == nil {
+			continue
+		}
+		usage := qp.Quota().Usage()
+		if usage.PerMinute > 0 {
+			lower(rate.Limit(float64(usage.PerMinute) / 60))
+		}
+		if usage.PerDay > 0 {
+			lower(rate.Limit(float64(usage.PerDay) / (24 * 60 * 60)))
+		}
+	}
+	return limit
+}
@@ -0,0 +1,99 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// TestQuotaEnforcesBudgets verifies that the per-minute and per-day limits
+// reject requests once exhausted and that usage is reported.
+func TestQuotaEnforcesBudgets(t *testing.T) {
+	q := NewQuota(QuotaConfig{PerMinute: 2, PerDay: 3})
+
+	for i := 0; i < 2; i++ {
+		if err := q.Allow(); err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+	}
+	if err := q.Allow(); !errors.Is(err, errQuotaExceeded) {
+		t.Fatalf("expected per-minute limit, got %v", err)
+	}
+
+	usage := q.Usage()
+	if usage.UsedToday != 2 || usage.RejectedToday != 1 || usage.RemainingToday == nil || *usage.RemainingToday != 1 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+
+	daily := NewQuota(QuotaConfig{PerDay: 1})
+	if err := daily.Allow(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := daily.Allow(); !errors.Is(err, errQuotaExceeded) {
+		t.Fatalf("expected daily limit, got %v", err)
+	}
+
+	var unlimited *Quota
+	if err := unlimited.Allow(); err != nil {
+		t.Fatalf("expected nil quota to allow requests, got %v", err)
+	}
+}
+
+// TestPacingRate verifies that pacing follows the tightest provider budget.
+func TestPacingRate(t *testing.T) {
+	if got := PacingRate(nil); got != 0 {
+		t.Fatalf("expected no pacing without budgets, got %v", got)
+	}
+
+	provs := []weather.Provider{
+		NewOpenWeatherProvider(http.DefaultClient, "", NewQuota(QuotaConfig{PerMinute: 60})),
+		NewWeatherAPIProvider(http.DefaultClient, "", NewQuota(QuotaConfig{PerDay: 8640})),
+	}
+	if got := PacingRate(provs); got != rate.Limit(0.1) {
+		t.Fatalf("expected 0.1 fetches/s, got %v", got)
+	}
+}
+
+// TestOpenBreakerLeavesQuota verifies that calls rejected by an open circuit
+// breaker use neither the per-minute nor the daily budget.
+func TestOpenBreakerLeavesQuota(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	q := NewQuota(QuotaConfig{PerMinute: 3, PerDay: 10})
+	cfg := HTTPClientConfig{Client: srv.Client(), Backoff: BackoffConfig{InitialInterval: time.Millisecond}, Quota: q}
+	cb := newCircuitBreaker(BreakerConfig{MaxRequests: 1, Timeout: time.Hour}.settings("test"))
+	call := func() error {
+		_, err := doRequestWithResilience(context.Background(), cfg, cb, opCurrent, func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL, nil)
+		})
+		return err
+	}
+
+	if err := call(); !errors.Is(err, errServerError) {
+		t.Fatalf("expected a server error, got %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := call(); !errors.Is(err, errCircuitOpen) {
+			t.Fatalf("call %d: expected an open breaker, got %v", i, err)
+		}
+	}
+
+	if usage := q.Usage(); usage.UsedToday != 1 || usage.RejectedToday != 0 {
+		t.Fatalf("expected only the sent request to be counted, got %+v", usage)
+	}
+	for i := 0; i < 2; i++ {
+		if err := q.Allow(); err != nil {
+			t.Fatalf("request %d: expected the per-minute budget to be left, got %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// Names of the built-in providers, as registered by DefaultRegistry.
+const (
+	OpenWeatherName = "openweathermap"
+	WeatherAPIName  = "weatherapi"
+	OpenMeteoName   = "openmeteo"
+)
+
+// DefaultTimeout bounds each HTTP request of a provider built from a Config
+// without a Timeout.
+const DefaultTimeout = 10 * time.Second
+
+// ErrMissingAPIKey is returned by factories of providers that need an API key
+// when Config.APIKey is empty.
+var ErrMissingAPIKey = errors.New("api key is not configured")
+
+// Config is the configuration block of one provider. Zero values select the
+// defaults: the public API, DefaultTimeout, DefaultBackoff and DefaultBreaker.
+type Config struct {
+	APIKey string
+	// BaseURL is the API root, e.g. a mock server (see WithBaseURL).
+	BaseURL string
+	// Timeout bounds each HTTP request to the provider.
+	Timeout time.Duration
+	Quota   QuotaConfig
+	Backoff BackoffConfig
+	Breaker BreakerConfig
+}
+
+// options returns the constructor options for the non-zero settings of c.
+func (c Config) options() []Option {
+	opts := []Option{WithBaseURL(c.BaseURL)}
+	if c.Backoff != (BackoffConfig{}) {
+		opts = append(opts, WithBackoff(c.Backoff))
+	}
+	if c.Breaker != (BreakerConfig{}) {
+		opts = append(opts, WithBreaker(c.Breaker))
+	}
+	return opts
+}
+
+// Deps are the shared objects a provider is built with.
+type Deps struct {
+	// Quota budgets the provider's requests. If nil, a Quota is created from
+	// Config.Quota.
+	Quota *Quota
+	// Geocoder resolves city/country locations for providers that only take
+	// coordinates.
+	Geocoder Geocoder
+	// Transport, if set, is used for the provider's HTTP requests instead of
+	// http.DefaultTransport, e.g. to record or replay responses.
+	Transport http.RoundTripper
+}
+
+// Factory builds a provider from its configuration. The client has the
+// configured timeout and transport.
+type Factory func(client *http.Client, cfg Config, deps Deps) (weather.Provider, error)
+
+// Registry maps provider names to the factories that build them.
+type Registry struct {
+	factories map[string]Factory
+	names     []string // in registration order
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]Factory)}
+}
+
+// DefaultRegistry returns a Registry with the built-in providers.
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.Register(OpenWeatherName, func(client *http.Client, cfg Config, deps Deps) (weather.Provider, error) {
+		if cfg.APIKey == "" {
+			return nil, ErrMissingAPIKey
+		}
+		return NewOpenWeatherProvider(client, cfg.APIKey, deps.Quota, cfg.options()...), nil
+	})
+	r.Register(WeatherAPIName, func(client *http.Client, cfg Config, deps Deps) (weather.Provider, error) {
+		if cfg.APIKey == "" {
+			return nil, ErrMissingAPIKey
+		}
+		return NewWeatherAPIProvider(client, cfg.APIKey, deps.Quota, cfg.options()...), nil
+	})
+	r.Register(OpenMeteoName, func(client *http.Client, cfg Config, deps Deps) (weather.Provider, error) {
+		// Open-Meteo is keyless; city/country locations need a geocoder.
+		if deps.Geocoder == nil {
+			return nil, errors.New("no geocoder configured")
+		}
+		return NewOpenMeteoProvider(client, deps.Geocoder, deps.Quota, cfg.options()...), nil
+	})
+	return r
+}
+
+// Register adds the factory for name, replacing any previous one.
+func (r *Registry) Register(name string, f Factory) {
+	if _, ok := r.factories[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.factories[name] = f
+}
+
+// Names returns the registered provider names in registration order.
+func (r *Registry) Names() []string {
+	return append([]string(nil), r.names...)
+}
+
+// Has reports whether a factory is registered for name.
+func (r *Registry) Has(name string) bool {
+	_, ok := r.factories[name]
+	return ok
+}
+
+// Build builds the provider called name from cfg.
+func (r *Registry) Build(name string, cfg Config, deps Deps) (weather.Provider, error) {
+	f, ok := r.factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q", name)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if deps.Quota == nil {
+		deps.Quota = NewQuota(cfg.Quota)
+	}
+	return f(&http.Client{Timeout: cfg.Timeout, Transport: deps.Transport}, cfg, deps)
+}
+
+// Set builds providers from their configuration blocks with a Registry and
+// keeps them across rebuilds, e.g. on configuration reload: a provider whose
+// block did not change is reused with its circuit breaker state, and every
+// provider keeps its Quota so that today's usage is not forgotten.
+type Set struct {
+	registry *Registry
+	deps     Deps
+
+	mu     sync.Mutex
+	built  map[string]builtProvider
+	quotas map[string]*Quota
+}
+
+type builtProvider struct {
+	cfg      Config
+	provider weather.Provider
+}
+
+// NewSet creates a Set building providers with registry. deps are passed to
+// every factory; their Quota is ignored.
+func NewSet(registry *Registry, deps Deps) *Set {
+	deps.Quota = nil
+	return &Set{
+		registry: registry,
+		deps:     deps,
+		built:    make(map[string]builtProvider),
+		quotas:   make(map[string]*Quota),
+	}
+}
+
+// Build returns the providers configured in configs, in registry order.
+// Providers that cannot be built, such as those missing an API key, are
+// disabled up front and logged rather than failing every fetch. It returns
+// an error without building anything if configs names an unknown provider.
+func (s *Set) Build(configs map[string]Config) ([]weather.Provider, error) {
+	for name := range configs {
+		if !s.registry.Has(name) {
+			return nil, fmt.Errorf("unknown provider %q", name)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var provs []weather.Provider
+	for _, name := range s.registry.Names() {
+		cfg, ok := configs[name]
+		if !ok {
+			delete(s.built, name)
+			continue
+		}
+
+		quota, ok := s.quotas[name]
+		if ok {
+			quota.SetConfig(cfg.Quota)
+		} else {
+			quota = NewQuota(cfg.Quota)
+			s.quotas[name] = quota
+		}
+
+		if b, ok := s.built[name]; ok && b.cfg == cfg {
+			provs = append(provs, b.provider)
+			continue
+		}
+		delete(s.built, name)
+
+		deps := s.deps
+		deps.Quota = quota
+		p, err := s.registry.Build(name, cfg, deps)
+		if err != nil {
+			log.Printf("providers: %s disabled: %v", name, err)
+			continue
+		}
+		s.built[name] = builtProvider{cfg: cfg, provider: p}
+		provs = append(provs, p)
+	}
+	return provs, nil
+}
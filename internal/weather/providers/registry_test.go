@@ -0,0 +1,73 @@
+package providers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/i474232898/weather-data-aggregation/internal/weather"
+)
+
+// fixedGeocoder resolves every location to the same coordinates.
+type fixedGeocoder struct{}
+
+func (fixedGeocoder) Geocode(context.Context, weather.Location) (Coordinates, error) {
+	return Coordinates{Latitude: 50, Longitude: 14}, nil
+}
+
+// TestSetBuildsConfiguredProviders verifies that providers without an API key
+// are disabled, that configured breaker and base URL settings are applied,
+// and that rebuilding keeps unchanged providers and every quota.
+func TestSetBuildsConfiguredProviders(t *testing.T) {
+	set := NewSet(DefaultRegistry(), Deps{Geocoder: fixedGeocoder{}})
+
+	configs := map[string]Config{
+		OpenWeatherName: {},
+		WeatherAPIName: {
+			APIKey:  "key",
+			BaseURL: "http://localhost:9090/weatherapi/",
+			Quota:   QuotaConfig{PerMinute: 10},
+			Breaker: BreakerConfig{MaxRequests: 2, Timeout: time.Minute, ConsecutiveFailures: 3},
+		},
+		OpenMeteoName: {},
+	}
+
+	provs, err := set.Build(configs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(provs) != 2 || provs[0].Name() != WeatherAPIName || provs[1].Name() != OpenMeteoName {
+		t.Fatalf("expected weatherapi and openmeteo, got %v", provs)
+	}
+
+	wa := provs[0].(*WeatherAPIProvider)
+	if wa.baseURL != "http://localhost:9090/weatherapi" {
+		t.Fatalf("expected the base URL override, got %q", wa.baseURL)
+	}
+	if got := wa.Breaker().settings.MaxRequests; got != 2 {
+		t.Fatalf("expected breaker max requests 2, got %d", got)
+	}
+	if got := wa.Quota().Usage().PerMinute; got != 10 {
+		t.Fatalf("expected a budget of 10 requests per minute, got %d", got)
+	}
+
+	// Only the weatherapi block changes.
+	configs[WeatherAPIName] = Config{APIKey: "key", Quota: QuotaConfig{PerMinute: 20}}
+	rebuilt, err := set.Build(configs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rebuilt[1] != provs[1] {
+		t.Fatal("expected the unchanged openmeteo provider to be reused")
+	}
+	if rebuilt[0] == provs[0] {
+		t.Fatal("expected the changed weatherapi provider to be rebuilt")
+	}
+	if q := rebuilt[0].(QuotaProvider).Quota(); q != wa.Quota() || q.Usage().PerMinute != 20 {
+		t.Fatalf("expected the weatherapi quota to be kept with its new budget, got %+v", q.Usage())
+	}
+
+	if _, err := set.Build(map[string]Config{"darksky": {}}); err == nil {
+		t.Fatal("expected an error for an unknown provider")
+	}
+}
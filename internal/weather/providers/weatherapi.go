@@ -13,7 +13,6 @@ import (
 
 	"github.com/i474232898/weather-data-aggregation/internal/common"
 	"github.com/i474232898/weather-data-aggregation/internal/weather"
-	"github.com/sony/gobreaker"
 )
 
 // WeatherAPIProvider implements the weather.Provider interface for WeatherAPI.com.
@@ -22,30 +21,33 @@ type WeatherAPIProvider struct {
 	apiKey  string
 	baseURL string
 	httpCfg HTTPClientConfig
-	circuit *gobreaker.CircuitBreaker
+	circuit *CircuitBreaker
 }
 
-func NewWeatherAPIProvider(client *http.Client, apiKey string) *WeatherAPIProvider {
-	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
-		Name:        "weatherapi",
-		MaxRequests: 5,
-		Interval:    1 * time.Minute,
-		Timeout:     2 * time.Minute,
-	})
+var (
+	_ weather.ForecastProvider       = (*WeatherAPIProvider)(nil)
+	_ weather.HourlyForecastProvider = (*WeatherAPIProvider)(nil)
+	_ weather.HistoryProvider        = (*WeatherAPIProvider)(nil)
+	_ BreakerProvider                = (*WeatherAPIProvider)(nil)
+	_ QuotaProvider                  = (*WeatherAPIProvider)(nil)
+)
+
+// NewWeatherAPIProvider creates the WeatherAPI.com provider. Its API root
+// defaults to https://api.weatherapi.com/v1.
+func NewWeatherAPIProvider(client *http.Client, apiKey string, quota *Quota, opts ...Option) *WeatherAPIProvider {
+	o := newOptions("https://api.weatherapi.com/v1", opts)
 
 	return &WeatherAPIProvider{
-		name:    "weatherapi",
+		name:    WeatherAPIName,
 		apiKey:  apiKey,
-		baseURL: "https://api.weatherapi.com/v1/current.json",
+		baseURL: o.baseURL,
 		httpCfg: HTTPClientConfig{
-			Client: client,
-			Backoff: BackoffConfig{
-				MaxRetries:      3,
-				InitialInterval: 500 * time.Millisecond,
-				MaxInterval:     5 * time.Second,
-			},
+			Client:      client,
+			Backoff:     o.backoff,
+			Quota:       quota,
+			DecodeError: decodeWeatherAPIError,
 		},
-		circuit: cb,
+		circuit: newCircuitBreaker(o.breaker.settings(WeatherAPIName)),
 	}
 }
 
@@ -53,22 +55,27 @@ func (p *WeatherAPIProvider) Name() string {
 	return p.name
 }
 
+// Breaker returns the provider's circuit breaker.
+func (p *WeatherAPIProvider) Breaker() *CircuitBreaker {
+	return p.circuit
+}
+
+// Quota returns the provider's request budget.
+func (p *WeatherAPIProvider) Quota() *Quota {
+	return p.httpCfg.Quota
+}
+
 func (p *WeatherAPIProvider) Fetch(ctx context.Context, loc weather.Location) (weather.ProviderReading, error) {
 	if p.apiKey == "" {
-		return weather.ProviderReading{}, fmt.Errorf("weatherapi api key is not configured")
+		return weather.ProviderReading{}, fmt.Errorf("weatherapi %w", ErrMissingAPIKey)
 	}
 
 	buildRequest := func() (*http.Request, error) {
 		values := url.Values{}
 		values.Set("key", p.apiKey)
-		// WeatherAPI uses "q" for location; it accepts "city,country" or "lat,lon".
-		q := loc.City
-		if loc.Country != "" {
-			q = fmt.Sprintf("%s,%s", loc.City, loc.Country)
-		}
-		values.Set("q", q)
+		values.Set("q", weatherAPIQuery(loc))
 
-		u := fmt.Sprintf("%s?%s", p.baseURL, values.Encode())
+		u := fmt.Sprintf("%s/current.json?%s", p.baseURL, values.Encode())
 		req, err := http.NewRequest(http.MethodGet, u, nil)
 		if err != nil {
 			return nil, err
@@ -76,7 +83,7 @@ func (p *WeatherAPIProvider) Fetch(ctx context.Context, loc weather.Location) (w
 		return req, nil
 	}
 
-	resp, err := doRequestWithResilience(ctx, p.httpCfg, p.circuit, buildRequest)
+	resp, err := doRequestWithResilience(ctx, p.httpCfg, p.circuit, opCurrent, buildRequest)
 	if err != nil {
 		return weather.ProviderReading{}, err
 	}
@@ -87,11 +94,11 @@ func (p *WeatherAPIProvider) Fetch(ctx context.Context, loc weather.Location) (w
 			LocaltimeEpoch int64 `json:"localtime_epoch"`
 		} `json:"location"`
 		Current struct {
-			TempC      float64 `json:"temp_c"`
-			Humidity   float64 `json:"humidity"`
-			WindKph    float64 `json:"wind_kph"`
-			PressureMb float64 `json:"pressure_mb"`
-			PrecipMm   float64 `json:"precip_mm"`
+			TempC      *float64 `json:"temp_c"`
+			Humidity   *float64 `json:"humidity"`
+			WindKph    *float64 `json:"wind_kph"`
+			PressureMb *float64 `json:"pressure_mb"`
+			PrecipMm   *float64 `json:"precip_mm"`
 			Condition  struct {
 				Text string `json:"text"`
 			} `json:"condition"`
@@ -107,9 +114,6 @@ func (p *WeatherAPIProvider) Fetch(ctx context.Context, loc weather.Location) (w
 		ts = time.Now().UTC()
 	}
 
-	// Convert wind from kph to m/s (approx).
-	windMS := payload.Current.WindKph / 3.6
-
 	cond := mapWeatherAPICondition(payload.Current.Condition.Text)
 
 	return weather.ProviderReading{
@@ -117,42 +121,227 @@ func (p *WeatherAPIProvider) Fetch(ctx context.Context, loc weather.Location) (w
 		Timestamp:    ts,
 		TemperatureC: payload.Current.TempC,
 		HumidityPct:  payload.Current.Humidity,
-		WindSpeedMS:  windMS,
+		WindSpeedMS:  kphToMS(payload.Current.WindKph),
 		PressureHpa:  payload.Current.PressureMb,
 		PrecipMm:     payload.Current.PrecipMm,
 		Condition:    cond,
 	}, nil
 }
 
-// FetchForecast retrieves a multi-day forecast from WeatherAPI.com and returns
-// one normalized ProviderReading per day, ordered by ascending date.
-func (p *WeatherAPIProvider) FetchForecast(ctx context.Context, loc weather.Location, days int) ([]weather.ProviderReading, error) {
-	if p.apiKey == "" {
-		return nil, fmt.Errorf("weatherapi api key is not configured")
+// weatherAPIForecastDay is one entry of forecast.forecastday in forecast.json
+// and history.json.
+type weatherAPIForecastDay struct {
+	DateEpoch int64 `json:"date_epoch"`
+	Day       struct {
+		MinTempC          *float64 `json:"mintemp_c"`
+		MaxTempC          *float64 `json:"maxtemp_c"`
+		AvgTempC          *float64 `json:"avgtemp_c"`
+		MaxWindKph        *float64 `json:"maxwind_kph"`
+		TotalPrecipMm     *float64 `json:"totalprecip_mm"`
+		DailyChanceOfRain *float64 `json:"daily_chance_of_rain"`
+		DailyChanceOfSnow *float64 `json:"daily_chance_of_snow"`
+		Condition         struct {
+			Text string `json:"text"`
+		} `json:"condition"`
+	} `json:"day"`
+	Hour []weatherAPIHour `json:"hour"`
+}
+
+// weatherAPIHour is one hour of a weatherAPIForecastDay.
+type weatherAPIHour struct {
+	TimeEpoch  int64    `json:"time_epoch"`
+	TempC      *float64 `json:"temp_c"`
+	Humidity   *float64 `json:"humidity"`
+	WindKph    *float64 `json:"wind_kph"`
+	PressureMb *float64 `json:"pressure_mb"`
+	PrecipMm   *float64 `json:"precip_mm"`
+	Condition  struct {
+		Text string `json:"text"`
+	} `json:"condition"`
+}
+
+// weatherAPIHourReading converts an hour of forecast or history data to a reading.
+func weatherAPIHourReading(provider string, ts time.Time, h weatherAPIHour) weather.ProviderReading {
+	return weather.ProviderReading{
+		ProviderName: provider,
+		Timestamp:    ts,
+		TemperatureC: h.TempC,
+		HumidityPct:  h.Humidity,
+		WindSpeedMS:  kphToMS(h.WindKph),
+		PressureHpa:  h.PressureMb,
+		PrecipMm:     h.PrecipMm,
+		Condition:    mapWeatherAPICondition(h.Condition.Text),
 	}
+}
+
+// FetchForecast retrieves a multi-day forecast from WeatherAPI.com and returns
+// one DailyReading per day from its native daily summary, ordered by ascending date.
+func (p *WeatherAPIProvider) FetchForecast(ctx context.Context, loc weather.Location, days int) ([]weather.DailyReading, error) {
 	if days <= 0 {
 		return nil, fmt.Errorf("days must be greater than zero")
 	}
 
+	forecastDays, err := p.fetchForecastDays(ctx, loc, days, opForecast)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(forecastDays) == 0 {
+		return nil, nil
+	}
+
+	readings := make([]weather.DailyReading, 0, len(forecastDays))
+	for _, fd := range forecastDays {
+		ts := time.Unix(fd.DateEpoch, 0).UTC()
+		cond := mapWeatherAPICondition(fd.Day.Condition.Text)
+
+		// Precipitation probability is reported separately for rain and snow.
+		pop := fd.Day.DailyChanceOfRain
+		if snow := fd.Day.DailyChanceOfSnow; snow != nil && (pop == nil || *snow > *pop) {
+			pop = snow
+		}
+
+		readings = append(readings, weather.DailyReading{
+			ProviderName:      p.name,
+			Date:              ts,
+			TempMinC:          fd.Day.MinTempC,
+			TempMaxC:          fd.Day.MaxTempC,
+			TempAvgC:          fd.Day.AvgTempC,
+			MaxWindSpeedMS:    kphToMS(fd.Day.MaxWindKph),
+			TotalPrecipMm:     fd.Day.TotalPrecipMm,
+			PrecipProbability: pop,
+			Condition:         cond,
+		})
+	}
+
+	// Ensure readings are ordered by date ascending.
+	sort.Slice(readings, func(i, j int) bool {
+		return readings[i].Date.Before(readings[j].Date)
+	})
+
+	if len(readings) > days {
+		readings = readings[:days]
+	}
+
+	return readings, nil
+}
+
+// FetchHourlyForecast returns WeatherAPI.com's hourly forecast for the next
+// `hours` hours, starting from the current hour, ordered by time.
+func (p *WeatherAPIProvider) FetchHourlyForecast(ctx context.Context, loc weather.Location, hours int) ([]weather.ProviderReading, error) {
+	if hours <= 0 {
+		return nil, fmt.Errorf("hours must be greater than zero")
+	}
+
+	// Forecast days are calendar days in the location's timezone, so request
+	// one extra day to cover the remainder of today.
+	forecastDays, err := p.fetchForecastDays(ctx, loc, hours/24+2, opHourly)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now().UTC().Truncate(time.Hour)
+	end := start.Add(time.Duration(hours) * time.Hour)
+
+	var readings []weather.ProviderReading
+	for _, fd := range forecastDays {
+		for _, h := range fd.Hour {
+			ts := time.Unix(h.TimeEpoch, 0).UTC()
+			if ts.Before(start) || !ts.Before(end) {
+				continue
+			}
+
+			readings = append(readings, weatherAPIHourReading(p.name, ts, h))
+		}
+	}
+
+	sort.Slice(readings, func(i, j int) bool {
+		return readings[i].Timestamp.Before(readings[j].Timestamp)
+	})
+
+	return readings, nil
+}
+
+// weatherAPIHistoryDays is how many past days history.json serves on the
+// free plan, today included.
+const weatherAPIHistoryDays = 7
+
+// FetchHistory returns WeatherAPI.com's hourly history for [from, to) from
+// history.json, one request per calendar day. The free plan only serves the
+// last 7 days, so older parts of the window are left out.
+func (p *WeatherAPIProvider) FetchHistory(ctx context.Context, loc weather.Location, from, to time.Time) ([]weather.ProviderReading, error) {
+	now := time.Now().UTC()
+	if to.After(now) {
+		to = now
+	}
+	if oldest := now.Truncate(24*time.Hour).AddDate(0, 0, -(weatherAPIHistoryDays - 1)); from.Before(oldest) {
+		from = oldest
+	}
+	from, to = from.UTC(), to.UTC()
+	if !from.Before(to) {
+		return nil, nil
+	}
+
+	var readings []weather.ProviderReading
+	for day := from.Truncate(24 * time.Hour); day.Before(to); day = day.AddDate(0, 0, 1) {
+		values := url.Values{}
+		values.Set("dt", day.Format("2006-01-02"))
+
+		historyDays, err := p.fetchDays(ctx, loc, "history.json", values, opHistory)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, fd := range historyDays {
+			for _, h := range fd.Hour {
+				ts := time.Unix(h.TimeEpoch, 0).UTC()
+				if ts.Before(from) || !ts.Before(to) {
+					continue
+				}
+				readings = append(readings, weatherAPIHourReading(p.name, ts, h))
+			}
+		}
+	}
+
+	sort.Slice(readings, func(i, j int) bool {
+		return readings[i].Timestamp.Before(readings[j].Timestamp)
+	})
+
+	return readings, nil
+}
+
+// fetchForecastDays calls forecast.json for the given number of days. op labels
+// the request in metrics.
+func (p *WeatherAPIProvider) fetchForecastDays(ctx context.Context, loc weather.Location, days int, op string) ([]weatherAPIForecastDay, error) {
 	// WeatherAPI free tier supports up to 10 days of forecast data.
 	if days > 10 {
 		days = 10
 	}
 
-	forecastURL := strings.Replace(p.baseURL, "current.json", "forecast.json", 1)
+	values := url.Values{}
+	values.Set("days", strconv.Itoa(days))
+	return p.fetchDays(ctx, loc, "forecast.json", values, op)
+}
+
+// fetchDays calls an endpoint returning forecast days (forecast.json or
+// history.json) with the given extra query parameters. op labels the request
+// in metrics.
+func (p *WeatherAPIProvider) fetchDays(ctx context.Context, loc weather.Location, endpoint string, extra url.Values, op string) ([]weatherAPIForecastDay, error) {
+	if p.apiKey == "" {
+		return nil, fmt.Errorf("weatherapi %w", ErrMissingAPIKey)
+	}
+
+	endpointURL := p.baseURL + "/" + endpoint
 
 	buildRequest := func() (*http.Request, error) {
 		values := url.Values{}
 		values.Set("key", p.apiKey)
-
-		q := loc.City
-		if loc.Country != "" {
-			q = fmt.Sprintf("%s,%s", loc.City, loc.Country)
+		values.Set("q", weatherAPIQuery(loc))
+		for k, v := range extra {
+			values[k] = v
 		}
-		values.Set("q", q)
-		values.Set("days", strconv.Itoa(days))
 
-		u := fmt.Sprintf("%s?%s", forecastURL, values.Encode())
+		u := fmt.Sprintf("%s?%s", endpointURL, values.Encode())
 		req, err := http.NewRequest(http.MethodGet, u, nil)
 		if err != nil {
 			return nil, err
@@ -160,7 +349,7 @@ func (p *WeatherAPIProvider) FetchForecast(ctx context.Context, loc weather.Loca
 		return req, nil
 	}
 
-	resp, err := doRequestWithResilience(ctx, p.httpCfg, p.circuit, buildRequest)
+	resp, err := doRequestWithResilience(ctx, p.httpCfg, p.circuit, op, buildRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -168,18 +357,7 @@ func (p *WeatherAPIProvider) FetchForecast(ctx context.Context, loc weather.Loca
 
 	var payload struct {
 		Forecast struct {
-			Forecastday []struct {
-				DateEpoch int64 `json:"date_epoch"`
-				Day       struct {
-					AvgTempC      float64 `json:"avgtemp_c"`
-					Avghumidity   float64 `json:"avghumidity"`
-					MaxWindKph    float64 `json:"maxwind_kph"`
-					TotalPrecipMm float64 `json:"totalprecip_mm"`
-					Condition     struct {
-						Text string `json:"text"`
-					} `json:"condition"`
-				} `json:"day"`
-			} `json:"forecastday"`
+			Forecastday []weatherAPIForecastDay `json:"forecastday"`
 		} `json:"forecast"`
 	}
 
@@ -187,36 +365,26 @@ func (p *WeatherAPIProvider) FetchForecast(ctx context.Context, loc weather.Loca
 		return nil, err
 	}
 
-	if len(payload.Forecast.Forecastday) == 0 {
-		return nil, nil
-	}
-
-	readings := make([]weather.ProviderReading, 0, len(payload.Forecast.Forecastday))
-	for _, fd := range payload.Forecast.Forecastday {
-		ts := time.Unix(fd.DateEpoch, 0).UTC()
-		cond := mapWeatherAPICondition(fd.Day.Condition.Text)
+	return payload.Forecast.Forecastday, nil
+}
 
-		// Convert wind from kph to m/s (approx).
-		windMS := fd.Day.MaxWindKph / 3.6
-
-		readings = append(readings, weather.ProviderReading{
-			ProviderName: p.name,
-			Timestamp:    ts,
-			TemperatureC: fd.Day.AvgTempC,
-			HumidityPct:  fd.Day.Avghumidity,
-			WindSpeedMS:  windMS,
-			// Pressure is not provided in the aggregated daily forecast; leave as zero.
-			PrecipMm:  fd.Day.TotalPrecipMm,
-			Condition: cond,
-		})
+// kphToMS converts an optional wind speed from kph to m/s (approx).
+func kphToMS(kph *float64) *float64 {
+	if kph == nil {
+		return nil
 	}
+	return weather.Float64(*kph / 3.6)
+}
 
-	// Ensure readings are ordered by date ascending.
-	sort.Slice(readings, func(i, j int) bool {
-		return readings[i].Timestamp.Before(readings[j].Timestamp)
-	})
-
-	return readings, nil
+// weatherAPIQuery builds the "q" parameter; WeatherAPI accepts "lat,lon" or "city,country".
+func weatherAPIQuery(loc weather.Location) string {
+	if loc.HasCoordinates() {
+		return strconv.FormatFloat(*loc.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(*loc.Lon, 'f', -1, 64)
+	}
+	if loc.Country != "" {
+		return fmt.Sprintf("%s,%s", loc.City, loc.Country)
+	}
+	return loc.City
 }
 
 func mapWeatherAPICondition(text string) weather.Condition {
@@ -239,3 +407,18 @@ func mapWeatherAPICondition(text string) weather.Condition {
 		return weather.ConditionUnknown
 	}
 }
+
+// decodeWeatherAPIError reads WeatherAPI.com's error body, e.g.
+// {"error": {"code": 1006, "message": "No matching location found."}}.
+func decodeWeatherAPIError(body []byte) (code, message string) {
+	var payload struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) != nil || payload.Error.Code == 0 {
+		return "", ""
+	}
+	return strconv.Itoa(payload.Error.Code), payload.Error.Message
+}
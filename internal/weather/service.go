@@ -2,43 +2,129 @@ package weather
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sort"
 	"sync"
 	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
 // Service orchestrates fetching from multiple providers and persisting snapshots.
 type Service struct {
-	store     Store
-	providers []Provider
+	store Store
+	hub   *Hub
+
+	// Replaced together by Reconfigure.
+	mu         sync.RWMutex
+	providers  []Provider
+	aggregator Aggregator
+	// forecastCache is nil unless WithForecastCache is used.
+	forecastCache *forecastCache
+
+	// onDemand is nil unless WithOnDemandFetch is used.
+	onDemand   *onDemandFetcher
+	fetchGroup singleflight.Group
+
+	// Provider failures from the most recent FetchAndStore per location key,
+	// for locations where some provider failed. At most maxFetchErrors
+	// locations are kept; the oldest entry is evicted first.
+	errMu       sync.RWMutex
+	fetchErrors map[string]fetchFailures
+}
+
+// maxFetchErrors caps the locations whose provider failures are remembered,
+// since on-demand fetching accepts arbitrary locations.
+const maxFetchErrors = 1000
+
+type fetchFailures struct {
+	at       time.Time
+	failures []*ProviderError
+}
+
+// ServiceOption customizes a Service created by NewService.
+type ServiceOption func(*Service)
+
+// WithAggregator sets the strategy used to combine provider readings.
+// The default is the plain mean (see NewMeanAggregator).
+func WithAggregator(a Aggregator) ServiceOption {
+	return func(s *Service) {
+		s.aggregator = a
+	}
 }
 
 // NewService creates a new Service.
-func NewService(store Store, providers []Provider) *Service {
-	return &Service{
-		store:     store,
-		providers: providers,
+func NewService(store Store, providers []Provider, opts ...ServiceOption) *Service {
+	s := &Service{
+		store:       store,
+		providers:   providers,
+		aggregator:  NewMeanAggregator(),
+		hub:         NewHub(),
+		fetchErrors: make(map[string]fetchFailures),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Providers returns the configured providers.
+func (s *Service) Providers() []Provider {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Provider(nil), s.providers...)
+}
+
+// Reconfigure replaces the providers and applies opts, e.g. after a
+// configuration reload. The aggregator and forecast cache are replaced too:
+// they are reset to their defaults unless set by opts, and cached forecasts
+// are dropped. Other options (WithOnDemandFetch) are ignored. Calls already
+// in progress finish with the previous providers.
+func (s *Service) Reconfigure(providers []Provider, opts ...ServiceOption) {
+	next := &Service{
+		providers:  providers,
+		aggregator: NewMeanAggregator(),
 	}
+	for _, opt := range opts {
+		opt(next)
+	}
+
+	s.mu.Lock()
+	s.providers = next.providers
+	s.aggregator = next.aggregator
+	s.forecastCache = next.forecastCache
+	s.mu.Unlock()
+}
+
+// components returns the providers, aggregator and forecast cache in use.
+func (s *Service) components() ([]Provider, Aggregator, *forecastCache) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.providers, s.aggregator, s.forecastCache
 }
 
 // FetchAndStore fetches data from all providers concurrently for the given location,
-// aggregates successful readings, and stores a snapshot.
+// aggregates successful readings, and stores a snapshot. Failed providers are
+// remembered (see LastFetchErrors); if every provider fails, the returned error
+// wraps their *ProviderError values.
 func (s *Service) FetchAndStore(ctx context.Context, loc Location) error {
 	var (
 		wg       sync.WaitGroup
 		mu       sync.Mutex
 		readings []ProviderReading
+		failures []*ProviderError
 	)
 
-	log.Printf("DEBUG: FetchAndStore called for %s with %d providers", loc.Key(), len(s.providers))
-	if len(s.providers) == 0 {
+	providers, aggregator, _ := s.components()
+
+	if len(providers) == 0 {
 		log.Printf("ERROR: No providers available to fetch weather data for %s", loc.Key())
 		return fmt.Errorf("no weather providers configured")
 	}
 
-	for _, p := range s.providers {
+	for _, p := range providers {
 		p := p
 		wg.Add(1)
 		go func() {
@@ -48,74 +134,129 @@ func (s *Service) FetchAndStore(ctx context.Context, loc Location) error {
 			if err != nil {
 				// Log and continue; we want partial success when possible.
 				log.Printf("provider %s fetch failed for %s: %v", p.Name(), loc.Key(), err)
+				mu.Lock()
+				failures = append(failures, AsProviderError(p.Name(), OperationCurrent, err))
+				mu.Unlock()
 				return
 			}
 
 			mu.Lock()
 			readings = append(readings, r)
-			fmt.Println("readings>>", readings)
 			mu.Unlock()
 		}()
 	}
 
 	wg.Wait()
 
+	sortProviderErrors(failures)
+	s.setFetchErrors(loc.Key(), failures)
+
 	if len(readings) == 0 {
 		// No providers succeeded; do not overwrite last good snapshot.
 		log.Printf("no successful provider readings for %s; keeping last good snapshot if any", loc.Key())
-		return nil
+		return noDataError("no successful provider readings for "+loc.Key(), failures)
 	}
 
-	snapshot := AggregateReadings(loc, readings)
+	snapshot := aggregator.Aggregate(loc, readings)
 	if snapshot.Timestamp.IsZero() {
 		snapshot.Timestamp = time.Now().UTC()
 	}
-	s.store.SaveSnapshot(loc, snapshot)
+	if err := s.saveSnapshot(ctx, loc, snapshot); err != nil {
+		return fmt.Errorf("save snapshot for %s: %w", loc.Key(), err)
+	}
 	return nil
 }
 
-// GetForecast generates a simple multi-day forecast based on the latest snapshot.
-// For now this is a placeholder implementation that extrapolates from the most
-// recent reading by repeating its values for the requested number of days and
-// advancing the timestamp by whole days.
-func (s *Service) getForecastPlaceholder(loc Location, days int) (Forecast, error) {
-	// latest, err := s.store.GetLatest(loc)
-	// if err != nil {
-	// 	return nil, err
-	// }
+// LastFetchErrors returns the provider failures from the most recent
+// FetchAndStore for loc, or nil if every provider succeeded.
+func (s *Service) LastFetchErrors(loc Location) []*ProviderError {
+	s.errMu.RLock()
+	defer s.errMu.RUnlock()
+	return s.fetchErrors[loc.Key()].failures
+}
+
+// setFetchErrors remembers the provider failures of the latest fetch of the
+// location key, forgetting the location once every provider succeeds.
+func (s *Service) setFetchErrors(key string, failures []*ProviderError) {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+
+	if len(failures) == 0 {
+		delete(s.fetchErrors, key)
+		return
+	}
+	if _, ok := s.fetchErrors[key]; !ok && len(s.fetchErrors) >= maxFetchErrors {
+		oldest := ""
+		for k, f := range s.fetchErrors {
+			if oldest == "" || f.at.Before(s.fetchErrors[oldest].at) {
+				oldest = k
+			}
+		}
+		delete(s.fetchErrors, oldest)
+	}
+	s.fetchErrors[key] = fetchFailures{at: time.Now(), failures: failures}
+}
+
+// sortProviderErrors orders failures by provider name for stable output.
+func sortProviderErrors(errs []*ProviderError) {
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Provider < errs[j].Provider
+	})
+}
+
+// noDataError reports that no provider returned data, wrapping their
+// failures (joined with errors.Join) if there were any.
+func noDataError(msg string, failures []*ProviderError) error {
+	if len(failures) == 0 {
+		return errors.New(msg)
+	}
+
+	sortProviderErrors(failures)
+	joined := make([]error, len(failures))
+	for i, e := range failures {
+		joined[i] = e
+	}
+	return fmt.Errorf("%s: %w", msg, errors.Join(joined...))
+}
 
-	// // Normalize the base date to midnight UTC for clearer daily buckets.
-	// baseDate := time.Date(
-	// 	latest.Timestamp.Year(),
-	// 	latest.Timestamp.Month(),
-	// 	latest.Timestamp.Day(),
-	// 	0, 0, 0, 0,
-	// 	time.UTC,
-	// )
+// saveSnapshot persists a snapshot and notifies live subscribers.
+func (s *Service) saveSnapshot(ctx context.Context, loc Location, snapshot WeatherSnapshot) error {
+	if err := s.store.SaveSnapshot(ctx, loc, snapshot); err != nil {
+		return err
+	}
+	s.hub.Publish(loc, snapshot)
+	return nil
+}
 
-	// forecast := make(Forecast, 0, days)
-	// for i := 0; i < days; i++ {
-	// 	snap := latest
-	// 	snap.Timestamp = baseDate.AddDate(0, 0, i)
-	// 	forecast = append(forecast, snap)
-	// }
+// Subscribe returns a subscription to snapshots saved for the given locations
+// (all locations if none are given). Callers must Close it when done.
+func (s *Service) Subscribe(locs ...Location) *Subscription {
+	return s.hub.Subscribe(locs...)
+}
 
-	// return forecast, nil
+// SubscribeAfter is Subscribe for a client resuming after the event with
+// sequence number seq; it also returns the recent events it missed (see
+// Hub.SubscribeAfter).
+func (s *Service) SubscribeAfter(seq uint64, locs ...Location) (*Subscription, []SnapshotEvent) {
+	return s.hub.SubscribeAfter(seq, locs...)
+}
 
-	return nil, fmt.Errorf("getForecastPlaceholder is deprecated and should not be used")
+// CloseSubscriptions ends all live subscriptions, e.g. on shutdown so that
+// streaming clients are disconnected.
+func (s *Service) CloseSubscriptions() {
+	s.hub.Close()
 }
 
 // GetForecast fetches multi-day forecasts from providers that support it,
-// aggregates them per day, and returns a normalized Forecast.
-func (s *Service) GetForecast(loc Location, days int) (Forecast, error) {
+// aggregates them per day, and returns a normalized Forecast. The CacheStatus
+// reports whether provider forecasts came from the forecast cache. Provider
+// calls are bound by ctx, up to forecastTimeout.
+func (s *Service) GetForecast(ctx context.Context, loc Location, days int) (Forecast, CacheStatus, error) {
 	if days <= 0 {
-		return nil, fmt.Errorf("days must be greater than zero")
+		return nil, CacheDisabled, fmt.Errorf("days must be greater than zero")
 	}
 
-	log.Printf("DEBUG: GetForecast called for %s for %d days", loc.Key(), days)
-
-	// Use a bounded context for outbound provider calls.
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, forecastTimeout)
 	defer cancel()
 
 	type dayKey string
@@ -123,11 +264,14 @@ func (s *Service) GetForecast(loc Location, days int) (Forecast, error) {
 	var (
 		wg            sync.WaitGroup
 		mu            sync.Mutex
-		dayReadings   = make(map[dayKey][]ProviderReading)
+		dayReadings   = make(map[dayKey][]DailyReading)
 		dayTimestamps = make(map[dayKey]time.Time)
+		failures      []*ProviderError
+		cacheStatus   CacheStatus
 	)
 
-	for _, p := range s.providers {
+	providers, aggregator, cache := s.components()
+	for _, p := range providers {
 		fp, ok := p.(ForecastProvider)
 		if !ok {
 			continue
@@ -139,9 +283,21 @@ func (s *Service) GetForecast(loc Location, days int) (Forecast, error) {
 		go func(fp ForecastProvider, providerName string) {
 			defer wg.Done()
 
-			readings, err := fp.FetchForecast(ctx, loc, days)
+			key := forecastCacheKey("daily", providerName, loc, days)
+			readings, status, err := cachedFetch(ctx, cache, providerName, key,
+				func(ctx context.Context) ([]DailyReading, error) {
+					return fp.FetchForecast(ctx, loc, days)
+				})
+
+			mu.Lock()
+			cacheStatus = cacheStatus.merge(status)
+			mu.Unlock()
+
 			if err != nil {
 				log.Printf("provider %s forecast failed for %s: %v", providerName, loc.Key(), err)
+				mu.Lock()
+				failures = append(failures, AsProviderError(providerName, OperationForecast, err))
+				mu.Unlock()
 				return
 			}
 
@@ -153,7 +309,7 @@ func (s *Service) GetForecast(loc Location, days int) (Forecast, error) {
 			defer mu.Unlock()
 
 			for _, r := range readings {
-				ts := r.Timestamp.UTC()
+				ts := r.Date.UTC()
 				k := dayKey(ts.Format("2006-01-02"))
 
 				dayReadings[k] = append(dayReadings[k], r)
@@ -169,7 +325,7 @@ func (s *Service) GetForecast(loc Location, days int) (Forecast, error) {
 
 	if len(dayReadings) == 0 {
 		log.Printf("no successful forecast readings for %s", loc.Key())
-		return nil, fmt.Errorf("no forecast data available")
+		return nil, cacheStatus, noDataError("no forecast data available", failures)
 	}
 
 	// Collect and sort all date keys.
@@ -192,28 +348,107 @@ func (s *Service) GetForecast(loc Location, days int) (Forecast, error) {
 			continue
 		}
 
-		snapshot := AggregateReadings(loc, readings)
-		if ts, ok := dayTimestamps[dk]; ok {
-			snapshot.Timestamp = ts
+		forecast = append(forecast, aggregator.AggregateDaily(loc, dayTimestamps[dk], readings))
+	}
+
+	if len(forecast) == 0 {
+		log.Printf("forecast aggregation produced no entries for %s", loc.Key())
+		return nil, cacheStatus, fmt.Errorf("no forecast data available")
+	}
+
+	return forecast, cacheStatus, nil
+}
+
+// GetHourlyForecast fetches hourly forecasts from providers that support it,
+// aligns every provider onto a common UTC hourly grid (interpolating coarser
+// slots), and aggregates each hour. The CacheStatus reports whether provider
+// forecasts came from the forecast cache. Provider calls are bound by ctx, up
+// to forecastTimeout.
+func (s *Service) GetHourlyForecast(ctx context.Context, loc Location, hours int) (HourlyForecast, CacheStatus, error) {
+	if hours <= 0 {
+		return nil, CacheDisabled, fmt.Errorf("hours must be greater than zero")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, forecastTimeout)
+	defer cancel()
+
+	grid := hourlyGrid(time.Now(), hours)
+
+	var (
+		wg           sync.WaitGroup
+		mu           sync.Mutex
+		hourReadings = make(map[time.Time][]ProviderReading)
+		failures     []*ProviderError
+		cacheStatus  CacheStatus
+	)
+
+	providers, aggregator, cache := s.components()
+	for _, p := range providers {
+		hp, ok := p.(HourlyForecastProvider)
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(hp HourlyForecastProvider) {
+			defer wg.Done()
+
+			key := forecastCacheKey("hourly", hp.Name(), loc, hours)
+			readings, status, err := cachedFetch(ctx, cache, hp.Name(), key,
+				func(ctx context.Context) ([]ProviderReading, error) {
+					return hp.FetchHourlyForecast(ctx, loc, hours)
+				})
+
+			mu.Lock()
+			cacheStatus = cacheStatus.merge(status)
+			mu.Unlock()
+
+			if err != nil {
+				log.Printf("provider %s hourly forecast failed for %s: %v", hp.Name(), loc.Key(), err)
+				mu.Lock()
+				failures = append(failures, AsProviderError(hp.Name(), OperationHourly, err))
+				mu.Unlock()
+				return
+			}
+
+			aligned := alignToGrid(readings, grid)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for ts, r := range aligned {
+				hourReadings[ts] = append(hourReadings[ts], r)
+			}
+		}(hp)
+	}
+
+	wg.Wait()
+
+	forecast := make(HourlyForecast, 0, hours)
+	for _, ts := range grid {
+		readings := hourReadings[ts]
+		if len(readings) == 0 {
+			continue
 		}
 
+		snapshot := aggregator.Aggregate(loc, readings)
+		snapshot.Timestamp = ts
 		forecast = append(forecast, snapshot)
 	}
 
 	if len(forecast) == 0 {
-		log.Printf("forecast aggregation produced no entries for %s", loc.Key())
-		return nil, fmt.Errorf("no forecast data available")
+		log.Printf("no successful hourly forecast readings for %s", loc.Key())
+		return nil, cacheStatus, noDataError("no forecast data available", failures)
 	}
 
-	return forecast, nil
+	return forecast, cacheStatus, nil
 }
 
 // GetLatest delegates to the underlying store.
-func (s *Service) GetLatest(loc Location) (WeatherSnapshot, error) {
-	return s.store.GetLatest(loc)
+func (s *Service) GetLatest(ctx context.Context, loc Location) (WeatherSnapshot, error) {
+	return s.store.GetLatest(ctx, loc)
 }
 
 // GetRange delegates to the underlying store.
-func (s *Service) GetRange(loc Location, from, to time.Time) ([]WeatherSnapshot, error) {
-	return s.store.GetRange(loc, from, to)
+func (s *Service) GetRange(ctx context.Context, loc Location, from, to time.Time) ([]WeatherSnapshot, error) {
+	return s.store.GetRange(ctx, loc, from, to)
 }
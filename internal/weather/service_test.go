@@ -0,0 +1,75 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// switchProvider fails its current weather calls while fail is set, counts
+// them if calls is set, and holds them until release is closed if set.
+type switchProvider struct {
+	name    string
+	fail    *atomic.Bool
+	calls   *atomic.Int32
+	release chan struct{}
+}
+
+func (p switchProvider) Name() string { return p.name }
+
+func (p switchProvider) Fetch(ctx context.Context, loc Location) (ProviderReading, error) {
+	if p.calls != nil {
+		p.calls.Add(1)
+	}
+	if p.release != nil {
+		<-p.release
+	}
+	if p.fail.Load() {
+		return ProviderReading{}, errors.New("upstream down")
+	}
+	return ProviderReading{ProviderName: p.name, TemperatureC: Float64(10)}, nil
+}
+
+// TestFetchErrorsArePruned verifies that provider failures are forgotten once
+// a location's providers all succeed, and that the number of locations with
+// remembered failures is capped.
+func TestFetchErrorsArePruned(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	s := NewService(&sliceStore{}, []Provider{historyProvider{name: "good"}, switchProvider{name: "flaky", fail: &fail}})
+	ctx := context.Background()
+	paris := Location{City: "Paris", Country: "FR"}
+
+	if err := s.FetchAndStore(ctx, paris); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if failures := s.LastFetchErrors(paris); len(failures) != 1 || failures[0].Provider != "flaky" {
+		t.Fatalf("expected the flaky provider to have failed, got %+v", failures)
+	}
+
+	fail.Store(false)
+	if err := s.FetchAndStore(ctx, paris); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if failures := s.LastFetchErrors(paris); failures != nil || len(s.fetchErrors) != 0 {
+		t.Fatalf("expected the failures to be forgotten, got %+v", s.fetchErrors)
+	}
+
+	fail.Store(true)
+	var locs []Location
+	for i := 0; i < maxFetchErrors+5; i++ {
+		loc := Location{City: fmt.Sprintf("City %d", i)}
+		locs = append(locs, loc)
+		if err := s.FetchAndStore(ctx, loc); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(s.fetchErrors) != maxFetchErrors {
+		t.Fatalf("expected %d locations with failures, got %d", maxFetchErrors, len(s.fetchErrors))
+	}
+	if s.LastFetchErrors(locs[len(locs)-1]) == nil {
+		t.Fatalf("expected the latest location to keep its failures")
+	}
+}